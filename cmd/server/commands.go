@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+)
+
+const usage = `Usage: vpsmyth [command]
+
+Without a command, vpsmyth migrates the database and starts the server.
+
+Commands:
+  migrate status   List the schema migrations and whether they are applied
+  rotate-key       Re-encrypt stored credentials and secrets with a new key.
+                   Stop the server first. When the key is given in
+                   VPSMYTH_SECRET_KEY, pass the new one in VPSMYTH_NEW_SECRET_KEY
+`
+
+// runCommand runs an admin command and returns the exit code.
+func runCommand(args []string) int {
+	switch {
+	case len(args) == 2 && args[0] == "migrate" && args[1] == "status":
+		return migrateStatus()
+	case len(args) == 1 && args[0] == "rotate-key":
+		return rotateKey()
+	case args[0] == "help" || args[0] == "-h" || args[0] == "--help":
+		fmt.Print(usage)
+		return 0
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
+
+// migrateStatus prints the schema migrations of vpsmyth.db without
+// applying them.
+func migrateStatus() int {
+	if err := db.Open("vpsmyth.db"); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.DB.Close()
+
+	migrations, err := db.MigrationStatus()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+	pending := 0
+	for _, m := range migrations {
+		status := "pending"
+		switch {
+		case !m.Known:
+			status = "unknown (applied by a newer version)"
+		case m.AppliedAt != nil && m.AppliedAt.IsZero():
+			status = "applied"
+		case m.AppliedAt != nil:
+			status = "applied " + m.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		default:
+			pending++
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", m.Version, m.Name, status)
+	}
+	w.Flush()
+	if pending > 0 {
+		fmt.Printf("\n%d pending migration(s) will be applied when the server starts.\n", pending)
+	}
+	return 0
+}
+
+// rotateKey re-encrypts the credentials and secrets of vpsmyth.db with a new
+// master key.
+func rotateKey() int {
+	if err := db.InitDB("vpsmyth.db"); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.DB.Close()
+
+	n, err := db.RotateKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to rotate key: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Re-encrypted %d value(s) with the new key.\n", n)
+	if os.Getenv(db.SecretKeyEnv) != "" {
+		fmt.Printf("Set %s to the value of %s before starting the server.\n", db.SecretKeyEnv, db.NewSecretKeyEnv)
+	}
+	return 0
+}
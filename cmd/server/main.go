@@ -8,7 +8,11 @@ import (
 
 	"github.com/prashanta0234/vpsmyth/internal/api"
 	"github.com/prashanta0234/vpsmyth/internal/auth"
+	"github.com/prashanta0234/vpsmyth/internal/config"
 	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/redact"
+	"github.com/prashanta0234/vpsmyth/internal/system"
 	"bufio"
 	"strings"
 )
@@ -86,6 +90,11 @@ func setupWizard() {
 }
 
 func main() {
+	// Admin commands, e.g. "vpsmyth migrate status"
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	// Initialize database
 	if err := db.InitDB("vpsmyth.db"); err != nil {
 		log.Fatal(err)
@@ -94,6 +103,30 @@ func main() {
 	// Run setup wizard
 	setupWizard()
 
+	// Prefer the Docker Engine API, fall back to the docker CLI
+	system.Runtime = system.DetectRuntime()
+
+	// Adopt the metadata files of apps deployed by earlier versions
+	if n, err := deploy.ImportMetadataFiles(); err != nil {
+		log.Printf("Failed to import app metadata: %v", err)
+	} else if n > 0 {
+		log.Printf("Imported metadata of %d app(s) into the database", n)
+	}
+
+	// Route traffic of blue/green apps to their active containers
+	deploy.RestoreProxies()
+
+	// Reserve the ports of apps deployed before ports were reserved
+	deploy.ReservePorts()
+
+	// Probe app health checks in the background
+	deploy.StartHealthChecker()
+
+	// Start background deployment workers
+	if err := api.StartDeployWorkers(config.EnvInt("VPSMYTH_DEPLOY_WORKERS", 2)); err != nil {
+		log.Fatal(err)
+	}
+
 	// Register all routes
 	mux := http.DefaultServeMux
 	api.RegisterRoutes(mux)
@@ -104,5 +137,5 @@ func main() {
 	}
 
 	fmt.Printf("VPSMyth server starting on http://localhost:%s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, api.AuthMiddleware(mux)))
+	log.Fatal(http.ListenAndServe(":"+port, api.AuthMiddleware(redact.Middleware(mux, api.SecretRevealPath))))
 }
@@ -2,23 +2,31 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
-	"github.com/prashanta0234/vpsmyth/internal/db"
 	"github.com/prashanta0234/vpsmyth/internal/deploy"
 )
 
 // DeployRequest represents the expected JSON body for the /apps/deploy endpoint.
 type DeployRequest struct {
-	AppName    string            `json:"appName"`
-	DeployType string            `json:"deployType"` // "git" or "image"
-	Category   string            `json:"category"`
-	Framework  string            `json:"framework"`
-	RepoURL    string            `json:"repoURL"`
-	ImageName  string            `json:"imageName"`
-	Port       int               `json:"port"`
-	Env        map[string]string `json:"env"`
+	AppName     string                          `json:"appName"`
+	DeployType  string                          `json:"deployType"` // "git" or "image"
+	Category    string                          `json:"category"`
+	Framework   string                          `json:"framework"`
+	RepoURL     string                          `json:"repoURL"`
+	Ref         string                          `json:"ref"`                   // branch, tag or commit SHA; empty for the default branch
+	ArchivePath string                          `json:"archivePath,omitempty"` // set by HandleDeployUpload only
+	ImageName   string                          `json:"imageName"`
+	Port        int                             `json:"port"` // 0 allocates a port
+	Env         map[string]string               `json:"env"`
+	EnvOptions  map[string]deploy.EnvVarOptions `json:"envOptions"` // scope of env vars; runtime-only by default
+	Strategy    string                          `json:"strategy"`   // "recreate" or "bluegreen"; empty keeps the current one
+	HealthCheck *deploy.HealthCheck             `json:"healthCheck"`
+	Build       deploy.BuildSettings            `json:"build"`
+	// SecretGroups are the groups whose secrets the app gets; omitted keeps the current ones
+	SecretGroups []string `json:"secretGroups,omitempty"`
 }
 
 func HandleDeploy(w http.ResponseWriter, r *http.Request) {
@@ -33,42 +41,69 @@ func HandleDeploy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.AppName == "" || req.RepoURL == "" || req.Port == 0 {
+	if req.AppName == "" || req.RepoURL == "" {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
-
-	fmt.Printf("Received deployment request for: %s\n", req.AppName)
-
-	// Inject global secrets
-	globalSecrets, _ := db.GetGlobalSecrets()
-	if req.Env == nil {
-		req.Env = make(map[string]string)
+	if req.Port < 0 || req.Port > 65535 {
+		http.Error(w, "Invalid port", http.StatusBadRequest)
+		return
+	}
+	if req.DeployType == "upload" || req.ArchivePath != "" {
+		http.Error(w, "Archives must be sent to /api/apps/deploy/upload", http.StatusBadRequest)
+		return
+	}
+	if !deploy.ValidStrategy(req.Strategy) {
+		http.Error(w, "Invalid strategy: "+req.Strategy, http.StatusBadRequest)
+		return
 	}
-	for k, v := range globalSecrets {
-		if _, exists := req.Env[k]; !exists {
-			req.Env[k] = v
+	if req.HealthCheck != nil {
+		if err := req.HealthCheck.Validate(); err != nil {
+			http.Error(w, "Invalid health check: "+err.Error(), http.StatusBadRequest)
+			return
 		}
 	}
 
-	var err error
-	if req.DeployType == "image" {
-		err = deploy.DeployFromImage(req.AppName, req.ImageName, req.Port, req.Env)
-	} else {
-		err = deploy.DeployNodeDocker(req.AppName, req.Category, req.Framework, req.RepoURL, req.Port, req.Env)
+	if err := req.Build.Validate(); err != nil {
+		http.Error(w, "Invalid build settings: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := deploy.ValidateEnvOptions(req.Env, req.EnvOptions); err != nil {
+		http.Error(w, "Invalid env options: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := deploy.ValidateSecretRefs(req.AppName, req.SecretGroups, req.Env); err != nil {
+		http.Error(w, "Invalid env: "+err.Error(), http.StatusBadRequest)
+		return
 	}
 
+	previous, err := deploy.ReservedPort(req.AppName)
 	if err != nil {
-		fmt.Printf("Deployment failed: %v\n", err)
+		http.Error(w, "Failed to load port reservation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	port, err := deploy.AllocatePort(req.AppName, req.Port)
+	if err != nil {
+		http.Error(w, "Failed to allocate port: "+err.Error(), errorStatus(err))
+		return
+	}
+	req.Port = port
+
+	fmt.Printf("Received deployment request for: %s\n", req.AppName)
+
+	jobID, err := deployQueue.Submit(req.AppName, req)
+	if err != nil {
+		fmt.Printf("Failed to queue deployment: %v\n", err)
+		restorePort(req.AppName, previous)
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(errorStatus(err))
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Deployment started successfully", "appName": req.AppName})
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Deployment started successfully", "appName": req.AppName, "port": req.Port, "jobId": jobID})
 }
 
 func HandleListApps(w http.ResponseWriter, r *http.Request) {
@@ -82,6 +117,9 @@ func HandleListApps(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to list apps: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	for i := range apps {
+		apps[i].Env = deploy.MaskEnv(apps[i].Env)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{"apps": apps})
@@ -115,7 +153,7 @@ func HandleAppAction(action string) http.HandlerFunc {
 		}
 
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to %s app: %v", action, err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to %s app: %v", action, err), errorStatus(err))
 			return
 		}
 
@@ -141,7 +179,7 @@ func HandleUpdateEnv(w http.ResponseWriter, r *http.Request) {
 
 	err := deploy.UpdateAppEnv(req.AppName, req.Env)
 	if err != nil {
-		http.Error(w, "Failed to update environment variables: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Failed to update environment variables: "+err.Error(), errorStatus(err))
 		return
 	}
 
@@ -170,3 +208,114 @@ func HandleAppLogs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"logs": logs})
 }
+
+func HandleListReleases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	appName := r.URL.Query().Get("appName")
+	if appName == "" {
+		http.Error(w, "Missing appName parameter", http.StatusBadRequest)
+		return
+	}
+
+	releases, err := deploy.ListReleases(appName)
+	if err != nil {
+		http.Error(w, "Failed to list releases: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range releases {
+		releases[i].Env = deploy.MaskEnv(releases[i].Env)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"releases": releases})
+}
+
+func HandleRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		AppName string `json:"appName"`
+		Release int    `json:"release"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.AppName == "" || req.Release <= 0 {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	number, err := deploy.Rollback(req.AppName, req.Release)
+	if err != nil {
+		http.Error(w, "Failed to roll back app: "+err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Rolled back to release r%d", req.Release),
+		"release": number,
+	})
+}
+
+func HandleAppHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	appName := r.URL.Query().Get("appName")
+	if appName == "" {
+		http.Error(w, "Missing appName parameter", http.StatusBadRequest)
+		return
+	}
+
+	history, err := deploy.HealthHistory(appName, 50)
+	if err != nil {
+		http.Error(w, "Failed to get health history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"health": deploy.AppHealth(appName), "history": history})
+}
+
+func HandleSetHealthCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		AppName     string              `json:"appName"`
+		HealthCheck *deploy.HealthCheck `json:"healthCheck"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.AppName == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	if err := deploy.SetHealthCheck(req.AppName, req.HealthCheck); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, deploy.ErrAppBusy) {
+			status = http.StatusConflict
+		}
+		http.Error(w, "Failed to update health check: "+err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Health check updated successfully"})
+}
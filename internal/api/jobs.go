@@ -0,0 +1,244 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prashanta0234/vpsmyth/internal/config"
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/jobs"
+)
+
+var deployQueue *jobs.Queue
+
+// StartDeployWorkers starts the background workers that execute deployments.
+// It must be called before the deploy routes are served. A deploy of an app
+// that already has one queued or running follows VPSMYTH_DEPLOY_POLICY
+// (queue, reject or cancel; default queue).
+func StartDeployWorkers(workers int) error {
+	q, err := jobs.NewQueue(workers, runDeployJob)
+	if err != nil {
+		return err
+	}
+	if err := q.SetPolicy(config.EnvString("VPSMYTH_DEPLOY_POLICY", jobs.PolicyQueue)); err != nil {
+		return err
+	}
+	deployQueue = q
+	return nil
+}
+
+// errorStatus returns the HTTP status for an error of an app operation:
+// 409 when the app is busy with another deployment or operation, or its
+// port is taken.
+func errorStatus(err error) int {
+	var conflict *deploy.PortConflictError
+	if errors.Is(err, jobs.ErrAppBusy) || errors.Is(err, deploy.ErrAppBusy) || errors.As(err, &conflict) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// restorePort gives an app back the port reservation it had before a deploy
+// request that was not queued.
+func restorePort(appName string, previous int) {
+	if err := deploy.RestorePort(appName, previous); err != nil {
+		fmt.Printf("Failed to restore the port reservation of %s: %v\n", appName, err)
+	}
+}
+
+// runDeployJob executes a queued DeployRequest.
+func runDeployJob(job *jobs.Job) error {
+	var req DeployRequest
+	if err := job.Decode(&req); err != nil {
+		return err
+	}
+
+	spec := deploy.Spec{
+		AppName:     req.AppName,
+		Category:    req.Category,
+		Framework:   req.Framework,
+		RepoURL:     req.RepoURL,
+		Ref:         req.Ref,
+		ArchivePath: req.ArchivePath,
+		ImageName:   req.ImageName,
+		Port:        req.Port,
+		Env:         req.Env,
+		EnvOptions:  req.EnvOptions,
+		Strategy:    req.Strategy,
+		HealthCheck: req.HealthCheck,
+		Build:       req.Build,
+		JobID:       job.ID,
+
+		SecretGroups: req.SecretGroups,
+	}
+	switch req.DeployType {
+	case "image":
+		return deploy.DeployImage(spec, job)
+	case "upload":
+		return deploy.DeployUpload(spec, job)
+	}
+	return deploy.DeployGit(spec, job)
+}
+
+func HandleGetDeployJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Missing or invalid id parameter", http.StatusBadRequest)
+		return
+	}
+
+	job, err := db.GetDeployJob(id)
+	if err != nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleCancelDeployJob cancels a queued or running deployment. A cancelled
+// deploy removes its partial image and container and leaves the previous
+// release running.
+func HandleCancelDeployJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Missing or invalid id parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := deployQueue.Cancel(id); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Job not found", http.StatusNotFound)
+		case errors.Is(err, jobs.ErrNotCancellable):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Failed to cancel job: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Cancellation requested", "id": id})
+}
+
+func HandleListDeployJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, err := db.ListDeployJobs(r.URL.Query().Get("appName"), 50)
+	if err != nil {
+		http.Error(w, "Failed to list jobs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"jobs": list})
+}
+
+// HandleDeployLogs streams the output of a deployment job as Server-Sent Events.
+// Stored output is replayed first, then new lines are sent as they are
+// produced. A final "done" event carries the job's state.
+func HandleDeployLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Missing or invalid id parameter", http.StatusBadRequest)
+		return
+	}
+	if _, err := db.GetDeployJob(id); err != nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	// Subscribe before replaying so no line falls between the two.
+	live, cancel := jobs.Subscribe(id)
+	defer cancel()
+
+	last := 0
+	replay := func() {
+		stored, err := db.GetDeployLogs(id)
+		if err != nil {
+			return
+		}
+		for _, l := range stored {
+			if l.Seq > last {
+				writeLogEvent(w, l.Seq, l.Line)
+				last = l.Seq
+			}
+		}
+		flusher.Flush()
+	}
+	replay()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+stream:
+	for {
+		select {
+		case l, ok := <-live:
+			if !ok {
+				break stream
+			}
+			switch {
+			case l.Seq == last+1:
+				writeLogEvent(w, l.Seq, l.Line)
+				last = l.Seq
+				flusher.Flush()
+			case l.Seq > last+1:
+				// Lines were dropped for a slow connection; fill the gap from storage.
+				replay()
+			}
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	// Pick up lines written after the last live event.
+	replay()
+
+	job, _ := db.GetDeployJob(id)
+	done, _ := json.Marshal(map[string]string{"state": job.State, "error": job.Error})
+	fmt.Fprintf(w, "event: done\ndata: %s\n\n", done)
+	flusher.Flush()
+}
+
+func writeLogEvent(w http.ResponseWriter, seq int, line string) {
+	fmt.Fprintf(w, "id: %d\ndata: %s\n\n", seq, line)
+}
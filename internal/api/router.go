@@ -13,7 +13,7 @@ import (
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Public routes
-		if r.URL.Path == "/login.html" || r.URL.Path == "/api/auth/login" || strings.HasPrefix(r.URL.Path, "/css/") || strings.HasPrefix(r.URL.Path, "/js/") || strings.HasPrefix(r.URL.Path, "/assets/") {
+		if r.URL.Path == "/login.html" || r.URL.Path == "/api/auth/login" || strings.HasPrefix(r.URL.Path, "/css/") || strings.HasPrefix(r.URL.Path, "/js/") || strings.HasPrefix(r.URL.Path, "/assets/") || strings.HasPrefix(r.URL.Path, WebhookPathPrefix) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -49,6 +49,11 @@ func RegisterRoutes(mux *http.ServeMux) {
 
 	// App routes
 	mux.HandleFunc("/api/apps/deploy", HandleDeploy)
+	mux.HandleFunc("/api/apps/deploy/upload", HandleDeployUpload)
+	mux.HandleFunc("/api/apps/deploy/job", HandleGetDeployJob)
+	mux.HandleFunc("/api/apps/deploy/jobs", HandleListDeployJobs)
+	mux.HandleFunc("/api/apps/deploy/cancel", HandleCancelDeployJob)
+	mux.HandleFunc("/api/apps/deploy/logs", HandleDeployLogs)
 	mux.HandleFunc("/api/apps", HandleListApps)
 	mux.HandleFunc("/api/apps/stop", HandleAppAction("stop"))
 	mux.HandleFunc("/api/apps/start", HandleAppAction("start"))
@@ -56,6 +61,16 @@ func RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/apps/delete", HandleAppAction("delete"))
 	mux.HandleFunc("/api/apps/update-env", HandleUpdateEnv)
 	mux.HandleFunc("/api/apps/logs", HandleAppLogs)
+	mux.HandleFunc("/api/apps/releases", HandleListReleases)
+	mux.HandleFunc("/api/apps/rollback", HandleRollback)
+	mux.HandleFunc("/api/apps/health", HandleAppHealth)
+	mux.HandleFunc("/api/apps/health-check", HandleSetHealthCheck)
+	mux.HandleFunc("/api/apps/webhook", HandleAppWebhook)
+	mux.HandleFunc("/api/templates", HandleListTemplates)
+	mux.HandleFunc("/api/templates/preview", HandlePreviewTemplate)
+
+	// Push webhooks, authenticated by the app's webhook secret
+	mux.HandleFunc(WebhookPathPrefix, HandleWebhook)
 
 	// System routes
 	mux.HandleFunc("/api/system/install-node", HandleInstallNode)
@@ -74,6 +89,8 @@ func RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/system/settings/dockerhub", HandleDockerHubSettings)
 	mux.HandleFunc("/api/system/settings/github", HandleGitHubSettings)
 	mux.HandleFunc("/api/system/settings/secrets", HandleSecretsSettings)
+	mux.HandleFunc(SecretRevealPath, HandleRevealSecret)
+	mux.HandleFunc("/api/system/audit", HandleListAudit)
 
 	// Stats route
 	mux.HandleFunc("/api/stats", HandleStats)
@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/prashanta0234/vpsmyth/internal/auth"
 	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/redact"
 	"github.com/prashanta0234/vpsmyth/internal/system"
 )
 
@@ -77,41 +80,152 @@ func HandleGitHubSettings(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// HandleSecretsSettings lists, saves and deletes the secrets of a scope:
+// global (the default), a group or an app, selected by scope and name.
+// Saving a secret reports the apps using it and, with restart, recreates
+// their containers with the new value.
 func HandleSecretsSettings(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		secrets, err := db.GetGlobalSecrets()
+		scope, name := r.URL.Query().Get("scope"), r.URL.Query().Get("name")
+		if scope == "" {
+			scope = db.SecretScopeGlobal
+		}
+		if !deploy.ValidSecretScope(scope, name) {
+			http.Error(w, "Invalid secret scope", http.StatusBadRequest)
+			return
+		}
+		secrets, err := db.GetSecrets(scope, name)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		// Values are only returned by HandleRevealSecret, which audits it
+		for key := range secrets {
+			secrets[key] = redact.Mask
+		}
 		json.NewEncoder(w).Encode(secrets)
 		return
 	}
 
 	if r.Method == http.MethodPost {
 		var req struct {
-			Action string `json:"action"` // "save" or "delete"
-			Key    string `json:"key"`
-			Value  string `json:"value"`
+			Action    string `json:"action"` // "save" or "delete"
+			Key       string `json:"key"`
+			Value     string `json:"value"`
+			Scope     string `json:"scope"`     // "global" (default), "group" or "app"
+			ScopeName string `json:"scopeName"` // group or app name
+			Restart   bool   `json:"restart"`   // recreate the apps using the secret
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
+		if req.Scope == "" {
+			req.Scope = db.SecretScopeGlobal
+		}
+		if req.Scope == db.SecretScopeApp {
+			req.ScopeName = deploy.SanitizeAppName(req.ScopeName)
+		}
+		if req.Key == "" || !deploy.ValidSecretScope(req.Scope, req.ScopeName) {
+			http.Error(w, "Invalid secret key or scope", http.StatusBadRequest)
+			return
+		}
 
-		var err error
 		if req.Action == "delete" {
-			err = db.DeleteSecret(req.Key)
-		} else {
-			err = db.SaveSecret(req.Key, req.Value)
+			// Apps referencing the secret fail to deploy until it is replaced
+			users, _ := deploy.SecretUsers(req.Scope, req.ScopeName, req.Key)
+			if err := db.DeleteScopedSecret(req.Scope, req.ScopeName, req.Key); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"apps": users})
+			return
 		}
 
+		users, err := deploy.SaveSecret(req.Scope, req.ScopeName, req.Key, req.Value, req.Restart)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), errorStatus(err))
 			return
 		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"apps": users, "restarted": req.Restart})
+		return
+	}
+}
 
-		w.WriteHeader(http.StatusOK)
+// SecretRevealPath serves secret values. Responses to it are not redacted.
+const SecretRevealPath = "/api/system/settings/secrets/reveal"
+
+// HandleRevealSecret returns the value of a secret and records who asked for
+// it in the audit log.
+func HandleRevealSecret(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Key       string `json:"key"`
+		Scope     string `json:"scope"`
+		ScopeName string `json:"scopeName"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Scope == "" {
+		req.Scope = db.SecretScopeGlobal
+	}
+	if req.Scope == db.SecretScopeApp {
+		req.ScopeName = deploy.SanitizeAppName(req.ScopeName)
+	}
+	if req.Key == "" || !deploy.ValidSecretScope(req.Scope, req.ScopeName) {
+		http.Error(w, "Invalid secret key or scope", http.StatusBadRequest)
+		return
+	}
+
+	secrets, err := db.GetSecrets(req.Scope, req.ScopeName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	value, ok := secrets[req.Key]
+	if !ok {
+		http.Error(w, "Secret not found", http.StatusNotFound)
+		return
+	}
+
+	target := req.Scope + ":" + req.Key
+	if req.ScopeName != "" {
+		target = req.Scope + ":" + req.ScopeName + ":" + req.Key
+	}
+	if err := db.RecordAudit(requestUser(r), "reveal-secret", target, r.RemoteAddr); err != nil {
+		http.Error(w, "Failed to record audit entry: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	json.NewEncoder(w).Encode(map[string]string{"key": req.Key, "value": value})
+}
+
+// HandleListAudit returns the most recent audit entries.
+func HandleListAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries, err := db.ListAudit(100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries})
+}
+
+// requestUser returns the user whose session cookie authenticated r.
+func requestUser(r *http.Request) string {
+	cookie, err := r.Cookie("vpsmyth_token")
+	if err != nil {
+		return ""
+	}
+	username, _ := auth.ValidateToken(cookie.Value)
+	return username
 }
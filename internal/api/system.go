@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
 	"github.com/prashanta0234/vpsmyth/internal/stats"
 	"github.com/prashanta0234/vpsmyth/internal/system"
 )
@@ -131,18 +131,14 @@ func HandlePullRunContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Inject global secrets
-	globalSecrets, _ := db.GetGlobalSecrets()
-	if req.Env == nil {
-		req.Env = make(map[string]string)
-	}
-	for k, v := range globalSecrets {
-		if _, exists := req.Env[k]; !exists {
-			req.Env[k] = v
-		}
+	// The container gets the global secrets and those scoped to its name
+	env, err := deploy.ResolveEnv(req.ContainerName, req.Env)
+	if err != nil {
+		http.Error(w, "Invalid env: "+err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	err := system.PullAndRunImage(req.ImageName, req.ContainerName, req.Port, req.Env)
+	err = system.PullAndRunImage(req.ImageName, req.ContainerName, req.Port, env)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
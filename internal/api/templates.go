@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+)
+
+func HandleListTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	templates, err := deploy.ListTemplates()
+	if err != nil {
+		http.Error(w, "Failed to list templates: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"templates": templates, "templateDir": deploy.TemplateDir()})
+}
+
+// HandlePreviewTemplate renders the Dockerfile a deploy request would build
+// with, without deploying.
+func HandlePreviewTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DeployRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RepoURL == "" || req.Port == 0 {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+	if err := req.Build.Validate(); err != nil {
+		http.Error(w, "Invalid build settings: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plan, err := deploy.PreviewDockerfile(deploy.Spec{
+		AppName:   req.AppName,
+		Framework: req.Framework,
+		RepoURL:   req.RepoURL,
+		Ref:       req.Ref,
+		Port:      req.Port,
+		Build:     req.Build,
+	})
+	if err != nil {
+		http.Error(w, "Failed to preview Dockerfile: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prashanta0234/vpsmyth/internal/config"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+)
+
+// uploadDir returns the directory holding uploaded archives until their
+// deploy job extracts them.
+func uploadDir() string {
+	return config.EnvString("VPSMYTH_UPLOAD_DIR", filepath.Join("deployments", ".uploads"))
+}
+
+// archiveExt returns the extension of a supported archive file name, or "".
+func archiveExt(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// HandleDeployUpload deploys an app from a .zip or .tar.gz archive sent as
+// the "archive" field of a multipart form. The other fields match
+// DeployRequest; env is a JSON object.
+func HandleDeployUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	maxUpload := int64(config.EnvInt("VPSMYTH_MAX_UPLOAD_MB", 200)) << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxUpload+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid upload (the limit is %d MB): %v", maxUpload>>20, err), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("archive")
+	if err != nil {
+		http.Error(w, "Missing archive file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	ext := archiveExt(header.Filename)
+	if ext == "" {
+		http.Error(w, "Archive must be a .zip or .tar.gz file", http.StatusBadRequest)
+		return
+	}
+	if header.Size > maxUpload {
+		http.Error(w, fmt.Sprintf("Archive is larger than %d MB", maxUpload>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	port, _ := strconv.Atoi(r.FormValue("port"))
+	req := DeployRequest{
+		AppName:    r.FormValue("appName"),
+		DeployType: "upload",
+		Category:   r.FormValue("category"),
+		Framework:  r.FormValue("framework"),
+		RepoURL:    deploy.UploadPrefix + filepath.Base(header.Filename),
+		Port:       port,
+		Strategy:   r.FormValue("strategy"),
+	}
+	if req.AppName == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+	if req.Port < 0 || req.Port > 65535 {
+		http.Error(w, "Invalid port", http.StatusBadRequest)
+		return
+	}
+	if !deploy.ValidStrategy(req.Strategy) {
+		http.Error(w, "Invalid strategy: "+req.Strategy, http.StatusBadRequest)
+		return
+	}
+	if env := r.FormValue("env"); env != "" {
+		if err := json.Unmarshal([]byte(env), &req.Env); err != nil {
+			http.Error(w, "Invalid env JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	if options := r.FormValue("envOptions"); options != "" {
+		if err := json.Unmarshal([]byte(options), &req.EnvOptions); err != nil {
+			http.Error(w, "Invalid envOptions JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	if groups := r.FormValue("secretGroups"); groups != "" {
+		if err := json.Unmarshal([]byte(groups), &req.SecretGroups); err != nil {
+			http.Error(w, "Invalid secretGroups JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	if build := r.FormValue("build"); build != "" {
+		if err := json.Unmarshal([]byte(build), &req.Build); err != nil {
+			http.Error(w, "Invalid build JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := req.Build.Validate(); err != nil {
+		http.Error(w, "Invalid build settings: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := deploy.ValidateEnvOptions(req.Env, req.EnvOptions); err != nil {
+		http.Error(w, "Invalid env options: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := deploy.ValidateSecretRefs(req.AppName, req.SecretGroups, req.Env); err != nil {
+		http.Error(w, "Invalid env: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Keep the archive until the deploy job has extracted it
+	if err := os.MkdirAll(uploadDir(), 0700); err != nil {
+		http.Error(w, "Failed to store archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dst, err := os.CreateTemp(uploadDir(), "upload-*"+ext)
+	if err != nil {
+		http.Error(w, "Failed to store archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = io.Copy(dst, file)
+	dst.Close()
+	if err != nil {
+		os.Remove(dst.Name())
+		http.Error(w, "Failed to store archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.ArchivePath = dst.Name()
+
+	previous, err := deploy.ReservedPort(req.AppName)
+	if err != nil {
+		os.Remove(req.ArchivePath)
+		http.Error(w, "Failed to load port reservation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	port, err = deploy.AllocatePort(req.AppName, req.Port)
+	if err != nil {
+		os.Remove(req.ArchivePath)
+		http.Error(w, "Failed to allocate port: "+err.Error(), errorStatus(err))
+		return
+	}
+	req.Port = port
+
+	fmt.Printf("Received upload deployment for: %s (%s)\n", req.AppName, header.Filename)
+
+	jobID, err := deployQueue.Submit(req.AppName, req)
+	if err != nil {
+		os.Remove(req.ArchivePath)
+		restorePort(req.AppName, previous)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(errorStatus(err))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Deployment started successfully", "appName": req.AppName, "port": req.Port, "jobId": jobID})
+}
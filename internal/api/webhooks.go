@@ -0,0 +1,320 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/jobs"
+)
+
+// WebhookPathPrefix is the public path prefix of app push webhooks,
+// followed by the app name.
+const WebhookPathPrefix = "/api/webhooks/"
+
+// maxWebhookBody bounds the size of a webhook payload.
+const maxWebhookBody = 5 << 20
+
+// pushEvent holds the fields used from GitHub, GitLab and Gitea/Forgejo push payloads.
+type pushEvent struct {
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Repository struct {
+		DefaultBranch string `json:"default_branch"` // GitHub, Gitea, Forgejo
+	} `json:"repository"`
+	Project struct {
+		DefaultBranch string `json:"default_branch"` // GitLab
+	} `json:"project"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
+	} `json:"commits"`
+}
+
+// changedFiles returns the files changed by the pushed commits, and false
+// when the payload does not list them (GitHub and GitLab truncate the commit
+// list of large pushes, and list no files for forced pushes).
+func (p pushEvent) changedFiles() ([]string, bool) {
+	var files []string
+	for _, c := range p.Commits {
+		files = append(files, c.Added...)
+		files = append(files, c.Removed...)
+		files = append(files, c.Modified...)
+	}
+	return files, len(files) > 0
+}
+
+// webhookSender identifies the git host that sent a webhook request from its
+// headers. Gitea and Forgejo also send GitHub-style headers, so they are
+// checked first.
+func webhookSender(r *http.Request) (provider, event, deliveryID string) {
+	switch {
+	case r.Header.Get("X-Forgejo-Event") != "":
+		return "forgejo", r.Header.Get("X-Forgejo-Event"), r.Header.Get("X-Forgejo-Delivery")
+	case r.Header.Get("X-Gitea-Event") != "":
+		return "gitea", r.Header.Get("X-Gitea-Event"), r.Header.Get("X-Gitea-Delivery")
+	case r.Header.Get("X-Gitlab-Event") != "":
+		return "gitlab", r.Header.Get("X-Gitlab-Event"), r.Header.Get("X-Gitlab-Event-UUID")
+	case r.Header.Get("X-GitHub-Event") != "":
+		return "github", r.Header.Get("X-GitHub-Event"), r.Header.Get("X-GitHub-Delivery")
+	}
+	return "", "", ""
+}
+
+// verifyWebhook checks that a request was signed with the app's secret:
+// an HMAC-SHA256 of the body for GitHub, Gitea and Forgejo, and the secret
+// token itself for GitLab.
+func verifyWebhook(provider string, r *http.Request, body []byte, secret string) bool {
+	var signature string
+	switch provider {
+	case "github":
+		signature = strings.TrimPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	case "gitea":
+		signature = r.Header.Get("X-Gitea-Signature")
+	case "forgejo":
+		signature = r.Header.Get("X-Forgejo-Signature")
+		if signature == "" {
+			signature = r.Header.Get("X-Gitea-Signature")
+		}
+	case "gitlab":
+		token := r.Header.Get("X-Gitlab-Token")
+		return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	default:
+		return false
+	}
+
+	got, err := hex.DecodeString(signature)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func isPushEvent(provider, event string) bool {
+	if provider == "gitlab" {
+		return event == "Push Hook"
+	}
+	return event == "push"
+}
+
+// HandleWebhook receives push webhooks at /api/webhooks/<appName> and
+// redeploys the app when its tracked branch was pushed. It is public; requests
+// are authenticated by the app's webhook secret. Every delivery is logged.
+func HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	appName := deploy.SanitizeAppName(strings.TrimPrefix(r.URL.Path, WebhookPathPrefix))
+	provider, event, deliveryID := webhookSender(r)
+	delivery := db.WebhookDelivery{AppName: appName, Provider: provider, Event: event, DeliveryID: deliveryID}
+
+	// Deliveries are only logged for apps with a webhook, so that requests
+	// for made-up app names cannot grow the log
+	configured := false
+	respond := func(code int, status, message string) {
+		delivery.Status = status
+		delivery.Message = message
+		if configured {
+			if err := db.RecordWebhookDelivery(delivery); err != nil {
+				fmt.Printf("Failed to record webhook delivery for %s: %v\n", appName, err)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		resp := map[string]interface{}{"status": status, "message": message}
+		if delivery.JobID != 0 {
+			resp["jobId"] = delivery.JobID
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+
+	hook, err := db.GetWebhook(appName)
+	if err == sql.ErrNoRows {
+		respond(http.StatusNotFound, "rejected", "no webhook is configured for this app")
+		return
+	} else if err != nil {
+		respond(http.StatusInternalServerError, "error", err.Error())
+		return
+	}
+	configured = true
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		respond(http.StatusRequestEntityTooLarge, "rejected", "payload too large")
+		return
+	}
+	if provider == "" {
+		respond(http.StatusBadRequest, "rejected", "unknown webhook sender")
+		return
+	}
+	if !verifyWebhook(provider, r, body, hook.Secret) {
+		respond(http.StatusUnauthorized, "rejected", "invalid signature")
+		return
+	}
+
+	if provider != "gitlab" && event == "ping" {
+		respond(http.StatusOK, "ok", "pong")
+		return
+	}
+	if !isPushEvent(provider, event) {
+		respond(http.StatusOK, "ignored", fmt.Sprintf("%s events are not handled", event))
+		return
+	}
+
+	var push pushEvent
+	if err := json.Unmarshal(body, &push); err != nil {
+		respond(http.StatusBadRequest, "rejected", "invalid payload: "+err.Error())
+		return
+	}
+	delivery.Ref = push.Ref
+	delivery.CommitSHA = push.After
+
+	branch := hook.Branch
+	if branch == "" {
+		branch = push.Repository.DefaultBranch
+		if branch == "" {
+			branch = push.Project.DefaultBranch
+		}
+	}
+	if branch == "" || push.Ref != "refs/heads/"+branch {
+		respond(http.StatusOK, "ignored", fmt.Sprintf("push to %s does not match tracked branch %q", push.Ref, branch))
+		return
+	}
+	if strings.Trim(push.After, "0") == "" {
+		respond(http.StatusOK, "ignored", "branch was deleted")
+		return
+	}
+
+	meta, err := deploy.GetApp(appName)
+	if err != nil {
+		respond(http.StatusNotFound, "rejected", "app is not deployed")
+		return
+	}
+	if !meta.FromGit() {
+		respond(http.StatusBadRequest, "rejected", "app is not deployed from a git repository")
+		return
+	}
+	if files, ok := push.changedFiles(); ok && !meta.Build.Watches(files) {
+		respond(http.StatusOK, "ignored", "no changes under watched paths")
+		return
+	}
+
+	jobID, err := deployQueue.Submit(meta.AppName, DeployRequest{
+		AppName:    meta.AppName,
+		DeployType: "git",
+		Framework:  meta.Framework,
+		RepoURL:    meta.RepoURL,
+		Ref:        branch,
+		Port:       meta.Port,
+		Env:        meta.Env,
+		EnvOptions: meta.EnvOptions,
+		Build:      meta.Build,
+	})
+	if errors.Is(err, jobs.ErrAppBusy) {
+		respond(http.StatusConflict, "rejected", err.Error())
+		return
+	} else if err != nil {
+		respond(http.StatusInternalServerError, "error", "failed to queue deployment: "+err.Error())
+		return
+	}
+	delivery.JobID = jobID
+	respond(http.StatusAccepted, "queued", fmt.Sprintf("deploying %s at %s", branch, push.After))
+}
+
+// HandleAppWebhook shows (GET), creates or updates (POST) and removes
+// (DELETE) the push webhook of an app.
+func HandleAppWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		appName := deploy.SanitizeAppName(r.URL.Query().Get("appName"))
+		hook, err := db.GetWebhook(appName)
+		if err == sql.ErrNoRows {
+			http.Error(w, "No webhook configured", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		deliveries, err := db.ListWebhookDeliveries(appName, 50)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"webhook": hook, "url": WebhookPathPrefix + appName, "deliveries": deliveries})
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			AppName      string `json:"appName"`
+			Branch       string `json:"branch"`
+			RotateSecret bool   `json:"rotateSecret"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if _, err := deploy.GetApp(req.AppName); err != nil {
+			http.Error(w, "App not found", http.StatusNotFound)
+			return
+		}
+
+		appName := deploy.SanitizeAppName(req.AppName)
+		hook, err := db.GetWebhook(appName)
+		if err != nil && err != sql.ErrNoRows {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		hook.AppName = appName
+		hook.Branch = req.Branch
+		if hook.Secret == "" || req.RotateSecret {
+			if hook.Secret, err = generateWebhookSecret(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := db.SaveWebhook(hook); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"url": WebhookPathPrefix + appName, "secret": hook.Secret, "branch": hook.Branch})
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := db.DeleteWebhook(deploy.SanitizeAppName(r.URL.Query().Get("appName"))); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Webhook removed successfully"})
+		return
+	}
+
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
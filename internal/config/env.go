@@ -0,0 +1,25 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+// EnvString returns the value of the environment variable name, or def if it
+// is unset or empty.
+func EnvString(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// EnvInt returns the integer value of the environment variable name, or def
+// if it is unset or not a valid integer.
+func EnvInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
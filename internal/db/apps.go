@@ -0,0 +1,186 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// App is the stored state of a deployed app. Settings holds the deploy
+// settings (build, health check, container...) as JSON owned by the deploy
+// package.
+type App struct {
+	Name         string // sanitized name, also used for containers and directories
+	DisplayName  string
+	ContainerID  string
+	Port         int
+	RepoURL      string
+	Framework    string
+	Image        string
+	Release      int
+	Ref          string
+	CommitSHA    string
+	CommitMsg    string
+	Strategy     string
+	Color        string
+	InternalPort int
+	Settings     string
+	Env          map[string]string
+	Domains      []string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+const appColumns = "name, display_name, container_id, port, repo_url, framework, image, release, ref, commit_sha, commit_message, strategy, color, internal_port, settings, created_at, updated_at"
+
+func scanApp(row interface{ Scan(...interface{}) error }) (App, error) {
+	var a App
+	var displayName, containerID, repoURL, framework, image, ref, commitSHA, commitMsg, strategy, color, settings sql.NullString
+	var port, release, internalPort sql.NullInt64
+	err := row.Scan(&a.Name, &displayName, &containerID, &port, &repoURL, &framework, &image, &release, &ref,
+		&commitSHA, &commitMsg, &strategy, &color, &internalPort, &settings, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return a, err
+	}
+	a.DisplayName, a.ContainerID, a.RepoURL, a.Framework = displayName.String, containerID.String, repoURL.String, framework.String
+	a.Image, a.Ref, a.CommitSHA, a.CommitMsg = image.String, ref.String, commitSHA.String, commitMsg.String
+	a.Strategy, a.Color, a.Settings = strategy.String, color.String, settings.String
+	a.Port, a.Release, a.InternalPort = int(port.Int64), int(release.Int64), int(internalPort.Int64)
+	return a, nil
+}
+
+// SaveApp creates or replaces the stored state of an app, with its env vars
+// and domains, in one transaction.
+func SaveApp(a App) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec(`INSERT INTO apps (`+appColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET display_name = excluded.display_name, container_id = excluded.container_id,
+		port = excluded.port, repo_url = excluded.repo_url, framework = excluded.framework, image = excluded.image,
+		release = excluded.release, ref = excluded.ref, commit_sha = excluded.commit_sha, commit_message = excluded.commit_message,
+		strategy = excluded.strategy, color = excluded.color, internal_port = excluded.internal_port,
+		settings = excluded.settings, updated_at = excluded.updated_at`,
+		a.Name, a.DisplayName, a.ContainerID, a.Port, a.RepoURL, a.Framework, a.Image, a.Release, a.Ref,
+		a.CommitSHA, a.CommitMsg, a.Strategy, a.Color, a.InternalPort, a.Settings, now, now)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM app_env WHERE app_name = ?", a.Name); err != nil {
+		return err
+	}
+	for name, value := range a.Env {
+		if _, err := tx.Exec("INSERT INTO app_env (app_name, name, value) VALUES (?, ?, ?)", a.Name, name, value); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM app_domains WHERE app_name = ?", a.Name); err != nil {
+		return err
+	}
+	for _, domain := range a.Domains {
+		if _, err := tx.Exec("INSERT INTO app_domains (domain, app_name, created_at) VALUES (?, ?, ?)", domain, a.Name, now); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	// The app's env may hold secret values
+	secretsVersion.Add(1)
+	return nil
+}
+
+// GetApp retrieves the stored state of an app. It returns sql.ErrNoRows if
+// the app does not exist.
+func GetApp(name string) (App, error) {
+	a, err := scanApp(DB.QueryRow("SELECT "+appColumns+" FROM apps WHERE name = ?", name))
+	if err != nil {
+		return a, err
+	}
+	return a, loadAppRelations(&a)
+}
+
+// ListApps returns every stored app, ordered by name.
+func ListApps() ([]App, error) {
+	rows, err := DB.Query("SELECT " + appColumns + " FROM apps ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	var apps []App
+	for rows.Next() {
+		a, err := scanApp(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		apps = append(apps, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range apps {
+		if err := loadAppRelations(&apps[i]); err != nil {
+			return nil, err
+		}
+	}
+	return apps, nil
+}
+
+func loadAppRelations(a *App) error {
+	rows, err := DB.Query("SELECT name, value FROM app_env WHERE app_name = ?", a.Name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return err
+		}
+		if a.Env == nil {
+			a.Env = make(map[string]string)
+		}
+		a.Env[name] = value
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	domains, err := DB.Query("SELECT domain FROM app_domains WHERE app_name = ? ORDER BY domain", a.Name)
+	if err != nil {
+		return err
+	}
+	defer domains.Close()
+	for domains.Next() {
+		var domain string
+		if err := domains.Scan(&domain); err != nil {
+			return err
+		}
+		a.Domains = append(a.Domains, domain)
+	}
+	return domains.Err()
+}
+
+// DeleteApp removes the stored state of an app with its env vars and domains.
+func DeleteApp(name string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"app_env", "app_domains"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE app_name = ?", name); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM apps WHERE name = ?", name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
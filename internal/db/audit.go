@@ -0,0 +1,44 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AuditEntry records a sensitive action taken by a user.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	Target     string    `json:"target"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// RecordAudit stores an audit entry.
+func RecordAudit(actor, action, target, remoteAddr string) error {
+	_, err := DB.Exec("INSERT INTO audit_log (actor, action, target, remote_addr, created_at) VALUES (?, ?, ?, ?, ?)",
+		actor, action, target, remoteAddr, time.Now())
+	return err
+}
+
+// ListAudit returns the most recent audit entries, newest first.
+func ListAudit(limit int) ([]AuditEntry, error) {
+	rows, err := DB.Query("SELECT id, actor, action, target, remote_addr, created_at FROM audit_log ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var target, remoteAddr sql.NullString
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &target, &remoteAddr, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Target, e.RemoteAddr = target.String, remoteAddr.String
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
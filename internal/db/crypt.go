@@ -0,0 +1,329 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prashanta0234/vpsmyth/internal/config"
+)
+
+// Encrypted values are "enc:v1:" followed by the base64 of the master key ID,
+// the data key sealed with the master key, and the value sealed with the
+// data key. Each value gets its own data key.
+const encryptedPrefix = "enc:v1:"
+
+const (
+	keySize   = 32 // AES-256
+	keyIDSize = 4
+	nonceSize = 12
+	tagSize   = 16
+)
+
+// SecretKeyEnv holds the base64 master key. Without it the key is read from
+// the key file, which is created next to the database on first run.
+const SecretKeyEnv = "VPSMYTH_SECRET_KEY"
+
+// NewSecretKeyEnv holds the key that RotateKey switches to when the master
+// key comes from SecretKeyEnv.
+const NewSecretKeyEnv = "VPSMYTH_NEW_SECRET_KEY"
+
+// encryptedColumns are the columns encrypted at rest. The value is bound to
+// its row: rowKey, an SQL expression, is mixed into the authentication tag,
+// so a value copied to another row does not decrypt.
+var encryptedColumns = []struct {
+	table, column, rowKey string
+}{
+	{"credentials", "password", "service"},
+	{"secrets", "value", secretRowKeySQL},
+}
+
+// masterKey encrypts new values; keyring decrypts values sealed with the
+// master key or with a key left by an interrupted rotation.
+var (
+	masterKey []byte
+	keyring   map[string][]byte
+	keyFile   string // "" when the key comes from SecretKeyEnv
+)
+
+// ErrUnknownKey is returned for a value encrypted with a key that is not
+// configured.
+var ErrUnknownKey = errors.New("value is encrypted with an unknown key")
+
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return string(sum[:keyIDSize])
+}
+
+func parseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("the key must be %d base64-encoded bytes", keySize)
+	}
+	return key, nil
+}
+
+func newKey() []byte {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// writeKeyFile writes a key readable only by its owner.
+func writeKeyFile(path string, key []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadKey sets the master key from SecretKeyEnv, or from vpsmyth.key next to
+// the database, creating it on first run.
+func loadKey(dbPath string) error {
+	keyring = make(map[string][]byte)
+	if encoded := config.EnvString(SecretKeyEnv, ""); encoded != "" {
+		key, err := parseKey(encoded)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", SecretKeyEnv, err)
+		}
+		masterKey, keyFile = key, ""
+		keyring[keyID(key)] = key
+		return nil
+	}
+
+	keyFile = filepath.Join(filepath.Dir(dbPath), "vpsmyth.key")
+	data, err := os.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		key := newKey()
+		if err := writeKeyFile(keyFile, key); err != nil {
+			return fmt.Errorf("failed to create key file: %w", err)
+		}
+		data = []byte(base64.StdEncoding.EncodeToString(key))
+	} else if err != nil {
+		return fmt.Errorf("failed to read key file: %w", err)
+	}
+	key, err := parseKey(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid key file %s: %w", keyFile, err)
+	}
+	masterKey = key
+	keyring[keyID(key)] = key
+
+	// A rotation interrupted after committing leaves the new key here
+	if data, err := os.ReadFile(keyFile + ".new"); err == nil {
+		if key, err := parseKey(string(data)); err == nil {
+			keyring[keyID(key)] = key
+		}
+	}
+	return nil
+}
+
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, sealed, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < nonceSize+tagSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:nonceSize], sealed[nonceSize:], aad)
+}
+
+// encryptWith seals a value of a row with a fresh data key wrapped by key.
+func encryptWith(key []byte, value, rowKey string) (string, error) {
+	dataKey := newKey()
+	wrapped, err := seal(key, dataKey, []byte(rowKey))
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dataKey, []byte(value), []byte(rowKey))
+	if err != nil {
+		return "", err
+	}
+	blob := append([]byte(keyID(key)), wrapped...)
+	blob = append(blob, sealed...)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(blob), nil
+}
+
+func encrypt(value, rowKey string) (string, error) {
+	if masterKey == nil {
+		return "", errors.New("encryption key not loaded")
+	}
+	return encryptWith(masterKey, value, rowKey)
+}
+
+// sealedWith reports whether a stored value is encrypted with key.
+func sealedWith(stored string, key []byte) bool {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return false
+	}
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	return err == nil && len(blob) >= keyIDSize && string(blob[:keyIDSize]) == keyID(key)
+}
+
+// decrypt opens a value stored by encrypt. Plaintext values stored before
+// encryption are returned as they are.
+func decrypt(stored, rowKey string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil
+	}
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	wrappedSize := nonceSize + keySize + tagSize
+	if err != nil || len(blob) < keyIDSize+wrappedSize {
+		return "", errors.New("malformed encrypted value")
+	}
+	key, ok := keyring[string(blob[:keyIDSize])]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+	dataKey, err := open(key, blob[keyIDSize:keyIDSize+wrappedSize], []byte(rowKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	value, err := open(dataKey, blob[keyIDSize+wrappedSize:], []byte(rowKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(value), nil
+}
+
+// reencryptRows rewrites every encrypted column with key. Unless all is set,
+// only plaintext values and values sealed with another key are rewritten.
+func reencryptRows(tx *sql.Tx, key []byte, all bool) (int, error) {
+	count := 0
+	for _, c := range encryptedColumns {
+		rows, err := tx.Query(fmt.Sprintf("SELECT id, %s, %s FROM %s WHERE %s IS NOT NULL", c.rowKey, c.column, c.table, c.column))
+		if err != nil {
+			return count, err
+		}
+		type row struct {
+			id            int64
+			rowKey, value string
+		}
+		var stored []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.rowKey, &r.value); err != nil {
+				rows.Close()
+				return count, err
+			}
+			stored = append(stored, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return count, err
+		}
+
+		for _, r := range stored {
+			if !all && sealedWith(r.value, key) {
+				continue
+			}
+			value, err := decrypt(r.value, c.table+":"+r.rowKey)
+			if err != nil {
+				return count, fmt.Errorf("%s of %s %q: %w", c.column, c.table, r.rowKey, err)
+			}
+			sealed, err := encryptWith(key, value, c.table+":"+r.rowKey)
+			if err != nil {
+				return count, err
+			}
+			if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", c.table, c.column), sealed, r.id); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// encryptStoredValues encrypts the values stored in plaintext by earlier
+// versions, and those left with another key by an interrupted rotation.
+func encryptStoredValues() error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := reencryptRows(tx, masterKey, false); err != nil {
+		return fmt.Errorf("failed to encrypt stored secrets: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RotateKey re-encrypts every credential and secret with a new master key
+// and returns the number of values rewritten. With a key file, the new key
+// replaces the file once the database is updated; with SecretKeyEnv, the new
+// key is read from NewSecretKeyEnv and must replace SecretKeyEnv before the
+// next start.
+func RotateKey() (int, error) {
+	var key []byte
+	if keyFile == "" {
+		encoded := config.EnvString(NewSecretKeyEnv, "")
+		if encoded == "" {
+			return 0, fmt.Errorf("set %s to the new key to rotate a key given in %s", NewSecretKeyEnv, SecretKeyEnv)
+		}
+		var err error
+		if key, err = parseKey(encoded); err != nil {
+			return 0, fmt.Errorf("invalid %s: %w", NewSecretKeyEnv, err)
+		}
+	} else {
+		// Kept until the rename below, so an interrupted rotation can still
+		// decrypt what it committed
+		key = newKey()
+		if err := writeKeyFile(keyFile+".new", key); err != nil {
+			return 0, fmt.Errorf("failed to write new key file: %w", err)
+		}
+	}
+	keyring[keyID(key)] = key
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	count, err := reencryptRows(tx, key, true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to re-encrypt secrets: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if keyFile != "" {
+		if err := os.Rename(keyFile+".new", keyFile); err != nil {
+			return count, fmt.Errorf("failed to replace key file: %w", err)
+		}
+	}
+	masterKey = key
+	return count, nil
+}
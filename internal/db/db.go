@@ -10,47 +10,39 @@ import (
 
 var DB *sql.DB
 
-// InitDB initializes the SQLite database and creates necessary tables.
+// InitDB opens the SQLite database, migrates its schema to the current
+// version and loads the key encrypting credentials and secrets.
 func InitDB(dbPath string) error {
-	var err error
-	DB, err = sql.Open("sqlite", dbPath)
-	if err != nil {
+	if err := Open(dbPath); err != nil {
 		return err
 	}
 
-	createTables := `
-	CREATE TABLE IF NOT EXISTS credentials (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		service TEXT UNIQUE,
-		username TEXT,
-		password TEXT,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-	CREATE TABLE IF NOT EXISTS secrets (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		key TEXT UNIQUE,
-		value TEXT,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT UNIQUE,
-		password_hash TEXT,
-		failed_attempts INTEGER DEFAULT 0,
-		locked_until DATETIME,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-	`
-
-	_, err = DB.Exec(createTables)
-	if err != nil {
-		return fmt.Errorf("failed to create tables: %w", err)
+	if err := migrate(); err != nil {
+		return err
+	}
+
+	if err := loadKey(dbPath); err != nil {
+		return err
 	}
+	if err := encryptStoredValues(); err != nil {
+		return err
+	}
+	secretsVersion.Add(1)
 
 	fmt.Println("Database initialized successfully.")
 	return nil
 }
 
+// Open opens the SQLite database without migrating it, for admin commands
+// that inspect the schema.
+func Open(dbPath string) error {
+	var err error
+	// Background deploy workers write concurrently with API requests; wait
+	// for locks instead of failing with SQLITE_BUSY.
+	DB, err = sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+	return err
+}
+
 // GetDockerHubCredentials retrieves DockerHub username and password.
 func GetDockerHubCredentials() (string, string, error) {
 	var username, password string
@@ -58,12 +50,21 @@ func GetDockerHubCredentials() (string, string, error) {
 	if err == sql.ErrNoRows {
 		return "", "", nil
 	}
+	if err != nil {
+		return "", "", err
+	}
+	password, err = decrypt(password, "credentials:dockerhub")
 	return username, password, err
 }
 
 // SaveDockerHubCredentials saves DockerHub username and password.
 func SaveDockerHubCredentials(username, password string) error {
-	_, err := DB.Exec("INSERT OR REPLACE INTO credentials (service, username, password, updated_at) VALUES ('dockerhub', ?, ?, CURRENT_TIMESTAMP)", username, password)
+	sealed, err := encrypt(password, "credentials:dockerhub")
+	if err != nil {
+		return fmt.Errorf("failed to encrypt password: %w", err)
+	}
+	_, err = DB.Exec("INSERT OR REPLACE INTO credentials (service, username, password, updated_at) VALUES ('dockerhub', ?, ?, CURRENT_TIMESTAMP)", username, sealed)
+	secretsVersion.Add(1)
 	return err
 }
 
@@ -74,43 +75,20 @@ func GetGitHubCredentials() (string, error) {
 	if err == sql.ErrNoRows {
 		return "", nil
 	}
-	return token, err
+	if err != nil {
+		return "", err
+	}
+	return decrypt(token, "credentials:github")
 }
 
 // SaveGitHubCredentials saves GitHub token.
 func SaveGitHubCredentials(token string) error {
-	_, err := DB.Exec("INSERT OR REPLACE INTO credentials (service, username, password, updated_at) VALUES ('github', 'github_token', ?, CURRENT_TIMESTAMP)", token)
-	return err
-}
-
-// GetGlobalSecrets retrieves all global secrets as a map.
-func GetGlobalSecrets() (map[string]string, error) {
-	rows, err := DB.Query("SELECT key, value FROM secrets")
+	sealed, err := encrypt(token, "credentials:github")
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	secrets := make(map[string]string)
-	for rows.Next() {
-		var key, value string
-		if err := rows.Scan(&key, &value); err != nil {
-			return nil, err
-		}
-		secrets[key] = value
+		return fmt.Errorf("failed to encrypt token: %w", err)
 	}
-	return secrets, nil
-}
-
-// SaveSecret saves or updates a global secret.
-func SaveSecret(key, value string) error {
-	_, err := DB.Exec("INSERT OR REPLACE INTO secrets (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)", key, value)
-	return err
-}
-
-// DeleteSecret removes a global secret.
-func DeleteSecret(key string) error {
-	_, err := DB.Exec("DELETE FROM secrets WHERE key = ?", key)
+	_, err = DB.Exec("INSERT OR REPLACE INTO credentials (service, username, password, updated_at) VALUES ('github', 'github_token', ?, CURRENT_TIMESTAMP)", sealed)
+	secretsVersion.Add(1)
 	return err
 }
 
@@ -0,0 +1,54 @@
+package db
+
+import "time"
+
+// healthHistoryLimit is the number of health check results kept per app.
+const healthHistoryLimit = 100
+
+// HealthCheckResult is the outcome of one health check of an app, together
+// with the app's health status after it.
+type HealthCheckResult struct {
+	AppName   string    `json:"appName"`
+	Status    string    `json:"status"`
+	OK        bool      `json:"ok"`
+	Message   string    `json:"message,omitempty"`
+	LatencyMS int64     `json:"latencyMs"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// RecordHealthCheck stores a health check result and prunes old results of the app.
+func RecordHealthCheck(r HealthCheckResult) error {
+	_, err := DB.Exec("INSERT INTO health_checks (app_name, status, ok, message, latency_ms, checked_at) VALUES (?, ?, ?, ?, ?, ?)",
+		r.AppName, r.Status, r.OK, r.Message, r.LatencyMS, r.CheckedAt)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec(`DELETE FROM health_checks WHERE app_name = ? AND id NOT IN (
+		SELECT id FROM health_checks WHERE app_name = ? ORDER BY id DESC LIMIT ?)`, r.AppName, r.AppName, healthHistoryLimit)
+	return err
+}
+
+// GetHealthHistory returns the most recent health check results of an app, newest first.
+func GetHealthHistory(appName string, limit int) ([]HealthCheckResult, error) {
+	rows, err := DB.Query("SELECT app_name, status, ok, message, latency_ms, checked_at FROM health_checks WHERE app_name = ? ORDER BY id DESC LIMIT ?", appName, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []HealthCheckResult{}
+	for rows.Next() {
+		var r HealthCheckResult
+		if err := rows.Scan(&r.AppName, &r.Status, &r.OK, &r.Message, &r.LatencyMS, &r.CheckedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// DeleteHealthHistory removes the health check results of an app.
+func DeleteHealthHistory(appName string) error {
+	_, err := DB.Exec("DELETE FROM health_checks WHERE app_name = ?", appName)
+	return err
+}
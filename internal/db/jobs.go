@@ -0,0 +1,156 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// DeployJob is a deployment submitted for background execution.
+type DeployJob struct {
+	ID         int64           `json:"id"`
+	AppName    string          `json:"appName"`
+	State      string          `json:"state"`
+	Payload    string          `json:"-"`
+	Error      string          `json:"error,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"` // set by the runner, e.g. the detected framework
+	CreatedAt  time.Time       `json:"createdAt"`
+	StartedAt  *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+const deployJobColumns = "id, app_name, state, payload, error, result, created_at, started_at, finished_at"
+
+func scanDeployJob(row interface{ Scan(...interface{}) error }) (DeployJob, error) {
+	var job DeployJob
+	var errMsg, result sql.NullString
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.AppName, &job.State, &job.Payload, &errMsg, &result, &job.CreatedAt, &startedAt, &finishedAt)
+	job.Error = errMsg.String
+	if result.String != "" {
+		job.Result = json.RawMessage(result.String)
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return job, err
+}
+
+// CreateDeployJob stores a new job in the given state and returns its ID.
+func CreateDeployJob(appName, state, payload string) (int64, error) {
+	res, err := DB.Exec("INSERT INTO deploy_jobs (app_name, state, payload, created_at) VALUES (?, ?, ?, ?)",
+		appName, state, payload, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// GetDeployJob retrieves a job by ID.
+func GetDeployJob(id int64) (DeployJob, error) {
+	return scanDeployJob(DB.QueryRow("SELECT "+deployJobColumns+" FROM deploy_jobs WHERE id = ?", id))
+}
+
+// ListDeployJobs returns the most recent jobs, newest first. An empty appName lists jobs for all apps.
+func ListDeployJobs(appName string, limit int) ([]DeployJob, error) {
+	query := "SELECT " + deployJobColumns + " FROM deploy_jobs"
+	args := []interface{}{}
+	if appName != "" {
+		query += " WHERE app_name = ?"
+		args = append(args, appName)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []DeployJob{}
+	for rows.Next() {
+		job, err := scanDeployJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// StartDeployJob moves a job into its first running state and records the start time.
+func StartDeployJob(id int64, state string) error {
+	_, err := DB.Exec("UPDATE deploy_jobs SET state = ?, started_at = ? WHERE id = ?", state, time.Now(), id)
+	return err
+}
+
+// UpdateDeployJobState records a state transition of a running job.
+func UpdateDeployJobState(id int64, state string) error {
+	_, err := DB.Exec("UPDATE deploy_jobs SET state = ? WHERE id = ?", state, id)
+	return err
+}
+
+// SetDeployJobResult stores the JSON result reported by a running job.
+func SetDeployJobResult(id int64, result string) error {
+	_, err := DB.Exec("UPDATE deploy_jobs SET result = ? WHERE id = ?", result, id)
+	return err
+}
+
+// FinishDeployJob records the final state of a job and its error, if any.
+func FinishDeployJob(id int64, state, errMsg string) error {
+	_, err := DB.Exec("UPDATE deploy_jobs SET state = ?, error = ?, finished_at = ? WHERE id = ?", state, errMsg, time.Now(), id)
+	return err
+}
+
+// InterruptDeployJobs marks every job that is not in one of the given final
+// states as interrupted. It is called at startup, when no job can still be running.
+func InterruptDeployJobs(interrupted string, finalStates ...string) (int64, error) {
+	query := "UPDATE deploy_jobs SET state = ?, error = ?, finished_at = ? WHERE state NOT IN (?"
+	args := []interface{}{interrupted, "server restarted before the deployment finished", time.Now(), interrupted}
+	for _, s := range finalStates {
+		query += ", ?"
+		args = append(args, s)
+	}
+	query += ")"
+
+	res, err := DB.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeployLogLine is one line of output captured from a deployment.
+type DeployLogLine struct {
+	Seq  int    `json:"seq"`
+	Line string `json:"line"`
+}
+
+// AppendDeployLog stores a line of deployment output.
+func AppendDeployLog(jobID int64, seq int, line string) error {
+	_, err := DB.Exec("INSERT INTO deploy_logs (job_id, seq, line, created_at) VALUES (?, ?, ?, ?)", jobID, seq, line, time.Now())
+	return err
+}
+
+// GetDeployLogs returns the stored output of a job in order.
+func GetDeployLogs(jobID int64) ([]DeployLogLine, error) {
+	rows, err := DB.Query("SELECT seq, line FROM deploy_logs WHERE job_id = ? ORDER BY seq", jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []DeployLogLine{}
+	for rows.Next() {
+		var l DeployLogLine
+		if err := rows.Scan(&l.Seq, &l.Line); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
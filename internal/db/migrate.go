@@ -0,0 +1,205 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations are the files migrations/<version>_<name>.sql, applied in
+// version order. Released migrations must not change: add a new file instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationFixups run after the SQL of a migration, in the same transaction,
+// for changes that depend on the existing schema.
+var migrationFixups = map[int]func(tx *sql.Tx) error{
+	// Databases created before schema versions existed got this column at startup
+	1: func(tx *sql.Tx) error { return addColumn(tx, "deploy_jobs", "result", "TEXT") },
+}
+
+// Migration is a schema migration and when it was applied to the database.
+type Migration struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"` // nil while pending
+	Known     bool       `json:"known"`               // false when applied by a newer build
+
+	sql string
+}
+
+// loadMigrations returns the embedded migrations ordered by version.
+func loadMigrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	var list []Migration
+	for _, e := range entries {
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration file name %s", e.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, Migration{Version: version, Name: name, Known: true, sql: string(data)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i, m := range list {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+	return list, nil
+}
+
+// appliedMigrations returns when each version recorded in schema_migrations
+// was applied. Databases from before schema_migrations existed have none,
+// or the versions counted by PRAGMA user_version.
+func appliedMigrations() (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+	var exists int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		var version int
+		if err := DB.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+			return nil, err
+		}
+		for v := 1; v <= version; v++ {
+			applied[v] = time.Time{}
+		}
+		return applied, nil
+	}
+
+	rows, err := DB.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatus lists the embedded migrations with when they were
+// applied, followed by versions applied by a newer build.
+func MigrationStatus() ([]Migration, error) {
+	list, err := loadMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	for i := range list {
+		if at, ok := applied[list[i].Version]; ok {
+			at := at
+			list[i].AppliedAt = &at
+			delete(applied, list[i].Version)
+		}
+	}
+	var unknown []int
+	for version := range applied {
+		unknown = append(unknown, version)
+	}
+	sort.Ints(unknown)
+	for _, version := range unknown {
+		at := applied[version]
+		list = append(list, Migration{Version: version, AppliedAt: &at})
+	}
+	return list, nil
+}
+
+// migrate applies the pending migrations, each in its own transaction with
+// its schema_migrations row. It refuses to touch a database with migrations
+// from a newer build.
+func migrate() error {
+	list, err := MigrationStatus()
+	if err != nil {
+		return err
+	}
+	latest := 0
+	for _, m := range list {
+		if m.Known {
+			latest = m.Version
+		} else {
+			return fmt.Errorf("database has schema migration %d, newer than this build supports (%d); upgrade VPSMyth", m.Version, latest)
+		}
+	}
+
+	if _, err := DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT,
+		applied_at DATETIME
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	for _, m := range list {
+		if err := applyMigration(m); err != nil {
+			return fmt.Errorf("failed to apply migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs a pending migration, or records one counted by PRAGMA
+// user_version.
+func applyMigration(m Migration) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var recorded int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version = ?", m.Version).Scan(&recorded); err != nil || recorded > 0 {
+		return err
+	}
+	appliedAt := time.Now()
+	if m.AppliedAt == nil {
+		if _, err := tx.Exec(m.sql); err != nil {
+			return err
+		}
+		if fixup := migrationFixups[m.Version]; fixup != nil {
+			if err := fixup(tx); err != nil {
+				return err
+			}
+		}
+	} else if !m.AppliedAt.IsZero() {
+		appliedAt = *m.AppliedAt
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, appliedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addColumn adds a column to a table created by an earlier version unless
+// it is already there.
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
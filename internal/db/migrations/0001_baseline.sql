@@ -0,0 +1,86 @@
+-- Tables created before schema versions existed. Databases from those
+-- releases already have some of them; deploy_jobs.result is added by a fixup.
+CREATE TABLE IF NOT EXISTS credentials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    service TEXT UNIQUE,
+    username TEXT,
+    password TEXT,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS secrets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    key TEXT UNIQUE,
+    value TEXT,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT UNIQUE,
+    password_hash TEXT,
+    failed_attempts INTEGER DEFAULT 0,
+    locked_until DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS deploy_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    app_name TEXT,
+    state TEXT,
+    payload TEXT,
+    error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    started_at DATETIME,
+    finished_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_deploy_jobs_app ON deploy_jobs (app_name);
+CREATE TABLE IF NOT EXISTS deploy_logs (
+    job_id INTEGER,
+    seq INTEGER,
+    line TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (job_id, seq)
+);
+CREATE TABLE IF NOT EXISTS releases (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    app_name TEXT,
+    number INTEGER,
+    job_id INTEGER,
+    status TEXT,
+    commit_sha TEXT,
+    image TEXT,
+    image_digest TEXT,
+    env TEXT,
+    framework TEXT,
+    rollback_of INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (app_name, number)
+);
+CREATE TABLE IF NOT EXISTS health_checks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    app_name TEXT,
+    status TEXT,
+    ok BOOLEAN,
+    message TEXT,
+    latency_ms INTEGER,
+    checked_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_health_checks_app ON health_checks (app_name, id);
+CREATE TABLE IF NOT EXISTS webhooks (
+    app_name TEXT PRIMARY KEY,
+    secret TEXT,
+    branch TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    app_name TEXT,
+    provider TEXT,
+    event TEXT,
+    delivery_id TEXT,
+    ref TEXT,
+    commit_sha TEXT,
+    status TEXT,
+    message TEXT,
+    job_id INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_app ON webhook_deliveries (app_name, id);
@@ -0,0 +1,38 @@
+-- Apps, formerly deployments/<name>.json, with their env vars, domains and
+-- port reservations.
+CREATE TABLE IF NOT EXISTS apps (
+    name TEXT PRIMARY KEY,
+    display_name TEXT,
+    container_id TEXT,
+    port INTEGER,
+    repo_url TEXT,
+    framework TEXT,
+    image TEXT,
+    release INTEGER,
+    ref TEXT,
+    commit_sha TEXT,
+    commit_message TEXT,
+    strategy TEXT,
+    color TEXT,
+    internal_port INTEGER,
+    settings TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS app_env (
+    app_name TEXT REFERENCES apps (name) ON DELETE CASCADE,
+    name TEXT,
+    value TEXT,
+    PRIMARY KEY (app_name, name)
+);
+CREATE TABLE IF NOT EXISTS app_domains (
+    domain TEXT PRIMARY KEY,
+    app_name TEXT REFERENCES apps (name) ON DELETE CASCADE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_app_domains_app ON app_domains (app_name);
+CREATE TABLE IF NOT EXISTS port_reservations (
+    port INTEGER PRIMARY KEY,
+    app_name TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,15 @@
+-- Secrets are scoped to every app (global), the apps of a named group, or a
+-- single app. The key is unique within its scope.
+CREATE TABLE secrets_scoped (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    key TEXT NOT NULL,
+    value TEXT,
+    scope TEXT NOT NULL DEFAULT 'global',
+    scope_name TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (scope, scope_name, key)
+);
+INSERT INTO secrets_scoped (id, key, value, updated_at)
+    SELECT id, key, value, updated_at FROM secrets WHERE key IS NOT NULL;
+DROP TABLE secrets;
+ALTER TABLE secrets_scoped RENAME TO secrets;
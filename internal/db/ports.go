@@ -0,0 +1,73 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ReservePort reserves a host port for an app, replacing the app's previous
+// reservation. It returns the app owning the port afterwards: appName, or
+// the app that had already reserved it, in which case nothing changes.
+func ReservePort(appName string, port int) (string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var owner string
+	err = tx.QueryRow("SELECT app_name FROM port_reservations WHERE port = ?", port).Scan(&owner)
+	if err == nil {
+		if owner != appName {
+			return owner, nil
+		}
+		return owner, tx.Commit()
+	} else if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	if _, err := tx.Exec("DELETE FROM port_reservations WHERE app_name = ?", appName); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("INSERT INTO port_reservations (port, app_name, created_at) VALUES (?, ?, ?)", port, appName, time.Now()); err != nil {
+		return "", fmt.Errorf("failed to reserve port %d: %w", port, err)
+	}
+	return appName, tx.Commit()
+}
+
+// GetAppPort returns the port reserved by an app, or 0 if it has none.
+func GetAppPort(appName string) (int, error) {
+	var port int
+	err := DB.QueryRow("SELECT port FROM port_reservations WHERE app_name = ?", appName).Scan(&port)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return port, err
+}
+
+// ListPortReservations returns the owner of every reserved port.
+func ListPortReservations() (map[int]string, error) {
+	rows, err := DB.Query("SELECT port, app_name FROM port_reservations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ports := make(map[int]string)
+	for rows.Next() {
+		var port int
+		var appName string
+		if err := rows.Scan(&port, &appName); err != nil {
+			return nil, err
+		}
+		ports[port] = appName
+	}
+	return ports, rows.Err()
+}
+
+// ReleasePort removes the port reservation of an app.
+func ReleasePort(appName string) error {
+	_, err := DB.Exec("DELETE FROM port_reservations WHERE app_name = ?", appName)
+	return err
+}
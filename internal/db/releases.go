@@ -0,0 +1,112 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Release is one numbered deployment of an app.
+type Release struct {
+	AppName     string            `json:"appName"`
+	Number      int               `json:"number"`
+	JobID       int64             `json:"jobId,omitempty"`
+	Status      string            `json:"status"`
+	CommitSHA   string            `json:"commitSha,omitempty"`
+	Image       string            `json:"image"`
+	ImageDigest string            `json:"imageDigest,omitempty"`
+	Env         map[string]string `json:"env"`
+	Framework   string            `json:"framework"`
+	RollbackOf  int               `json:"rollbackOf,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+}
+
+const releaseColumns = "app_name, number, job_id, status, commit_sha, image, image_digest, env, framework, rollback_of, created_at"
+
+func scanRelease(row interface{ Scan(...interface{}) error }) (Release, error) {
+	var r Release
+	var jobID, rollbackOf sql.NullInt64
+	var commitSHA, digest, env sql.NullString
+	err := row.Scan(&r.AppName, &r.Number, &jobID, &r.Status, &commitSHA, &r.Image, &digest, &env, &r.Framework, &rollbackOf, &r.CreatedAt)
+	if err != nil {
+		return r, err
+	}
+	r.JobID = jobID.Int64
+	r.RollbackOf = int(rollbackOf.Int64)
+	r.CommitSHA = commitSHA.String
+	r.ImageDigest = digest.String
+	if env.String != "" {
+		json.Unmarshal([]byte(env.String), &r.Env)
+	}
+	return r, nil
+}
+
+// CreateRelease stores r under the app's next release number and returns that number.
+func CreateRelease(r Release) (int, error) {
+	env, err := json.Marshal(r.Env)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var number int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(number), 0) + 1 FROM releases WHERE app_name = ?", r.AppName).Scan(&number); err != nil {
+		return 0, err
+	}
+
+	var jobID, rollbackOf interface{}
+	if r.JobID != 0 {
+		jobID = r.JobID
+	}
+	if r.RollbackOf != 0 {
+		rollbackOf = r.RollbackOf
+	}
+	_, err = tx.Exec("INSERT INTO releases ("+releaseColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		r.AppName, number, jobID, r.Status, r.CommitSHA, r.Image, r.ImageDigest, string(env), r.Framework, rollbackOf, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return number, tx.Commit()
+}
+
+// UpdateRelease records the outcome of a release's build.
+func UpdateRelease(appName string, number int, status, image, digest, commitSHA string) error {
+	_, err := DB.Exec("UPDATE releases SET status = ?, image = ?, image_digest = ?, commit_sha = ? WHERE app_name = ? AND number = ?",
+		status, image, digest, commitSHA, appName, number)
+	return err
+}
+
+// GetRelease retrieves a single release of an app.
+func GetRelease(appName string, number int) (Release, error) {
+	return scanRelease(DB.QueryRow("SELECT "+releaseColumns+" FROM releases WHERE app_name = ? AND number = ?", appName, number))
+}
+
+// ListReleases returns an app's releases, newest first.
+func ListReleases(appName string) ([]Release, error) {
+	rows, err := DB.Query("SELECT "+releaseColumns+" FROM releases WHERE app_name = ? ORDER BY number DESC", appName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releases := []Release{}
+	for rows.Next() {
+		r, err := scanRelease(rows)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return releases, rows.Err()
+}
+
+// DeleteReleases removes the release history of an app.
+func DeleteReleases(appName string) error {
+	_, err := DB.Exec("DELETE FROM releases WHERE app_name = ?", appName)
+	return err
+}
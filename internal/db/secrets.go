@@ -0,0 +1,173 @@
+package db
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Scopes of a secret.
+const (
+	SecretScopeGlobal = "global" // every app
+	SecretScopeGroup  = "group"  // the apps of a named group
+	SecretScopeApp    = "app"    // a single app
+)
+
+// secretRowKeySQL identifies a secret row for encryption. Global secrets
+// keep the key they were encrypted with before secrets had scopes.
+const secretRowKeySQL = "CASE scope WHEN 'global' THEN key ELSE scope || ':' || scope_name || ':' || key END"
+
+func secretRowKey(scope, scopeName, key string) string {
+	if scope == SecretScopeGlobal {
+		return "secrets:" + key
+	}
+	return "secrets:" + scope + ":" + scopeName + ":" + key
+}
+
+// secretsVersion changes whenever a secret, credential or app env is saved or
+// deleted, so that callers caching SecretValues know to reload them.
+var secretsVersion atomic.Int64
+
+// SecretsVersion returns the current version of the stored secret values.
+func SecretsVersion() int64 {
+	return secretsVersion.Load()
+}
+
+// secretEnvSQL selects the values of app env vars flagged secret in the env
+// options of the app's settings.
+const secretEnvSQL = `SELECT e.value FROM app_env e JOIN apps a ON a.name = e.app_name
+	WHERE json_valid(a.settings) AND json_extract(a.settings, '$.env_options.' || json_quote(e.name) || '.secret') = 1`
+
+// SecretValues returns the values of every secret, stored credential and
+// secret app env var.
+func SecretValues() ([]string, error) {
+	var values []string
+	for _, c := range encryptedColumns {
+		rows, err := DB.Query(fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s IS NOT NULL", c.rowKey, c.column, c.table, c.column))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var rowKey, stored string
+			if err := rows.Scan(&rowKey, &stored); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			value, err := decrypt(stored, c.table+":"+rowKey)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to decrypt %s of %s %q: %w", c.column, c.table, rowKey, err)
+			}
+			values = append(values, value)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := DB.Query(secretEnvSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// Secret describes a stored secret, without its value.
+type Secret struct {
+	Key       string    `json:"key"`
+	Scope     string    `json:"scope"`
+	ScopeName string    `json:"scopeName,omitempty"` // group or app name
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ListSecrets returns every secret, without values, ordered by scope and key.
+func ListSecrets() ([]Secret, error) {
+	rows, err := DB.Query("SELECT key, scope, scope_name, updated_at FROM secrets ORDER BY scope, scope_name, key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var secrets []Secret
+	for rows.Next() {
+		var s Secret
+		if err := rows.Scan(&s.Key, &s.Scope, &s.ScopeName, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, s)
+	}
+	return secrets, rows.Err()
+}
+
+// GetSecrets returns the secrets of a scope as a map.
+func GetSecrets(scope, scopeName string) (map[string]string, error) {
+	rows, err := DB.Query("SELECT key, value FROM secrets WHERE scope = ? AND scope_name = ?", scope, scopeName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	secrets := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		if value, err = decrypt(value, secretRowKey(scope, scopeName, key)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt secret %s: %w", key, err)
+		}
+		secrets[key] = value
+	}
+	return secrets, rows.Err()
+}
+
+// SaveScopedSecret saves or updates a secret of a scope.
+func SaveScopedSecret(scope, scopeName, key, value string) error {
+	sealed, err := encrypt(value, secretRowKey(scope, scopeName, key))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+	_, err = DB.Exec(`INSERT INTO secrets (key, value, scope, scope_name, updated_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (scope, scope_name, key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		key, sealed, scope, scopeName)
+	secretsVersion.Add(1)
+	return err
+}
+
+// DeleteScopedSecret removes a secret of a scope.
+func DeleteScopedSecret(scope, scopeName, key string) error {
+	_, err := DB.Exec("DELETE FROM secrets WHERE scope = ? AND scope_name = ? AND key = ?", scope, scopeName, key)
+	secretsVersion.Add(1)
+	return err
+}
+
+// DeleteAppSecrets removes the secrets scoped to an app.
+func DeleteAppSecrets(appName string) error {
+	_, err := DB.Exec("DELETE FROM secrets WHERE scope = ? AND scope_name = ?", SecretScopeApp, appName)
+	secretsVersion.Add(1)
+	return err
+}
+
+// GetGlobalSecrets retrieves all global secrets as a map.
+func GetGlobalSecrets() (map[string]string, error) {
+	return GetSecrets(SecretScopeGlobal, "")
+}
+
+// SaveSecret saves or updates a global secret.
+func SaveSecret(key, value string) error {
+	return SaveScopedSecret(SecretScopeGlobal, "", key, value)
+}
+
+// DeleteSecret removes a global secret.
+func DeleteSecret(key string) error {
+	return DeleteScopedSecret(SecretScopeGlobal, "", key)
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// webhookDeliveryLimit is the number of deliveries kept per app.
+const webhookDeliveryLimit = 100
+
+// Webhook is the push webhook configuration of an app.
+type Webhook struct {
+	AppName   string    `json:"appName"`
+	Secret    string    `json:"secret"`
+	Branch    string    `json:"branch"` // empty tracks the repository's default branch
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookDelivery is one received webhook request and what was done with it.
+type WebhookDelivery struct {
+	ID         int64     `json:"id"`
+	AppName    string    `json:"appName"`
+	Provider   string    `json:"provider"`
+	Event      string    `json:"event"`
+	DeliveryID string    `json:"deliveryId,omitempty"`
+	Ref        string    `json:"ref,omitempty"`
+	CommitSHA  string    `json:"commitSha,omitempty"`
+	Status     string    `json:"status"`
+	Message    string    `json:"message,omitempty"`
+	JobID      int64     `json:"jobId,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// SaveWebhook creates or updates the webhook of an app.
+func SaveWebhook(w Webhook) error {
+	_, err := DB.Exec(`INSERT INTO webhooks (app_name, secret, branch, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(app_name) DO UPDATE SET secret = excluded.secret, branch = excluded.branch`,
+		w.AppName, w.Secret, w.Branch, time.Now())
+	return err
+}
+
+// GetWebhook retrieves the webhook of an app. It returns sql.ErrNoRows if none is configured.
+func GetWebhook(appName string) (Webhook, error) {
+	var w Webhook
+	err := DB.QueryRow("SELECT app_name, secret, branch, created_at FROM webhooks WHERE app_name = ?", appName).
+		Scan(&w.AppName, &w.Secret, &w.Branch, &w.CreatedAt)
+	return w, err
+}
+
+// DeleteWebhook removes the webhook of an app and its delivery log.
+func DeleteWebhook(appName string) error {
+	if _, err := DB.Exec("DELETE FROM webhooks WHERE app_name = ?", appName); err != nil {
+		return err
+	}
+	_, err := DB.Exec("DELETE FROM webhook_deliveries WHERE app_name = ?", appName)
+	return err
+}
+
+// RecordWebhookDelivery stores a delivery and prunes old deliveries of the app.
+func RecordWebhookDelivery(d WebhookDelivery) error {
+	var jobID interface{}
+	if d.JobID != 0 {
+		jobID = d.JobID
+	}
+	_, err := DB.Exec(`INSERT INTO webhook_deliveries (app_name, provider, event, delivery_id, ref, commit_sha, status, message, job_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.AppName, d.Provider, d.Event, d.DeliveryID, d.Ref, d.CommitSHA, d.Status, d.Message, jobID, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec(`DELETE FROM webhook_deliveries WHERE app_name = ? AND id NOT IN (
+		SELECT id FROM webhook_deliveries WHERE app_name = ? ORDER BY id DESC LIMIT ?)`, d.AppName, d.AppName, webhookDeliveryLimit)
+	return err
+}
+
+// ListWebhookDeliveries returns the most recent deliveries of an app, newest first.
+func ListWebhookDeliveries(appName string, limit int) ([]WebhookDelivery, error) {
+	rows, err := DB.Query(`SELECT id, app_name, provider, event, delivery_id, ref, commit_sha, status, message, job_id, created_at
+		FROM webhook_deliveries WHERE app_name = ? ORDER BY id DESC LIMIT ?`, appName, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var jobID sql.NullInt64
+		if err := rows.Scan(&d.ID, &d.AppName, &d.Provider, &d.Event, &d.DeliveryID, &d.Ref, &d.CommitSHA, &d.Status, &d.Message, &jobID, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		d.JobID = jobID.Int64
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
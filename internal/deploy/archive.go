@@ -0,0 +1,314 @@
+package deploy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxArchiveEntries bounds the number of files and directories in an uploaded archive.
+const maxArchiveEntries = 50000
+
+// archiveLink is a symlink or hard link entry, created after all files.
+type archiveLink struct {
+	name, target string
+	hard         bool
+}
+
+// extractor writes archive entries below dest, enforcing the size and entry limits.
+type extractor struct {
+	dest    string
+	limit   int64 // maximum total size of extracted files in bytes
+	written int64
+	entries int
+	links   []archiveLink
+}
+
+// extractArchive safely extracts a .zip or .tar.gz archive into dest, which
+// must not exist yet. Entries escaping dest (absolute paths, "..", or links
+// pointing outside), special files and archives expanding to more than limit
+// bytes are rejected.
+func extractArchive(archivePath, dest string, limit int64) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+	x := &extractor{dest: dest, limit: limit}
+
+	switch {
+	case bytes.Equal(magic, []byte("PK\x03\x04")):
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		err = x.extractZip(f, info.Size())
+		if err != nil {
+			return err
+		}
+	case magic[0] == 0x1f && magic[1] == 0x8b:
+		gz, err := gzip.NewReader(bufio.NewReader(f))
+		if err != nil {
+			return fmt.Errorf("invalid gzip archive: %w", err)
+		}
+		defer gz.Close()
+		if err := x.extractTar(tar.NewReader(gz)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported archive format: expected .zip or .tar.gz")
+	}
+	return x.createLinks()
+}
+
+func (x *extractor) extractZip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %w", err)
+	}
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			if _, err := x.mkdir(zf.Name); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			target, err := io.ReadAll(io.LimitReader(rc, 4096))
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			if err := x.addLink(zf.Name, string(target), false); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			err = x.writeFile(zf.Name, rc, mode.Perm())
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry %s in archive", zf.Name)
+		}
+	}
+	return nil
+}
+
+func (x *extractor) extractTar(tr *tar.Reader) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if _, err := x.mkdir(hdr.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := x.writeFile(hdr.Name, tr, os.FileMode(hdr.Mode).Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := x.addLink(hdr.Name, hdr.Linkname, false); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			if err := x.addLink(hdr.Name, hdr.Linkname, true); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+			// Metadata only
+		default:
+			return fmt.Errorf("unsupported entry %s in archive", hdr.Name)
+		}
+	}
+}
+
+// path returns the location of an archive entry below dest, rejecting names that escape it.
+func (x *extractor) path(name string) (string, error) {
+	x.entries++
+	if x.entries > maxArchiveEntries {
+		return "", fmt.Errorf("archive has more than %d entries", maxArchiveEntries)
+	}
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal path %s in archive", name)
+	}
+	return filepath.Join(x.dest, clean), nil
+}
+
+func (x *extractor) mkdir(name string) (string, error) {
+	p, err := x.path(name)
+	if err != nil {
+		return "", err
+	}
+	return p, os.MkdirAll(p, 0755)
+}
+
+func (x *extractor) writeFile(name string, r io.Reader, perm os.FileMode) error {
+	p, err := x.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	// Keep the executable bits, drop everything else the archive asks for
+	mode := os.FileMode(0644)
+	if perm&0111 != 0 {
+		mode = 0755
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Header sizes can lie; count what is actually written
+	n, err := io.Copy(f, io.LimitReader(r, x.limit-x.written+1))
+	x.written += n
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	if x.written > x.limit {
+		return fmt.Errorf("archive expands to more than %d MB", x.limit>>20)
+	}
+	return nil
+}
+
+// addLink validates a link entry. Links are created after all files so that
+// no file is ever written through one.
+func (x *extractor) addLink(name, target string, hard bool) error {
+	p, err := x.path(name)
+	if err != nil {
+		return err
+	}
+
+	// Symlink targets are relative to the link, hard link targets to the archive root
+	resolved := filepath.Join(filepath.Dir(p), filepath.FromSlash(target))
+	if hard {
+		resolved = filepath.Join(x.dest, filepath.FromSlash(target))
+	}
+	if filepath.IsAbs(target) || !within(x.dest, resolved) {
+		return fmt.Errorf("link %s -> %s points outside the archive", name, target)
+	}
+	x.links = append(x.links, archiveLink{name: p, target: target, hard: hard})
+	return nil
+}
+
+// createLinks creates the links of the archive in order. Chains of links can
+// leave dest even if every target looks local (e.g. a -> "." and b ->
+// "a/.."), so each target is resolved on disk first: it must exist below
+// dest without passing through a link.
+func (x *extractor) createLinks() error {
+	realDest, err := filepath.EvalSymlinks(x.dest)
+	if err != nil {
+		return err
+	}
+	for _, l := range x.links {
+		if err := os.MkdirAll(filepath.Dir(l.name), 0755); err != nil {
+			return err
+		}
+		dir := filepath.Dir(l.name)
+		if l.hard {
+			dir = x.dest
+		}
+		if err := resolveLinkTarget(realDest, dir, l.target); err != nil {
+			return fmt.Errorf("link %s -> %s: %w", strings.TrimPrefix(l.name, x.dest+string(filepath.Separator)), l.target, err)
+		}
+		if l.hard {
+			err = os.Link(filepath.Join(x.dest, filepath.FromSlash(l.target)), l.name)
+		} else {
+			err = os.Symlink(filepath.FromSlash(l.target), l.name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create link %s: %w", l.name, err)
+		}
+	}
+	return nil
+}
+
+// resolveLinkTarget follows target from dir one element at a time, as the
+// kernel would, and checks that every step stays below realDest, exists and
+// is not itself a link.
+func resolveLinkTarget(realDest, dir, target string) error {
+	cur, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if !within(realDest, cur) {
+		return fmt.Errorf("link is outside the archive")
+	}
+	for _, elem := range strings.Split(filepath.FromSlash(target), string(filepath.Separator)) {
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+		default:
+			cur = filepath.Join(cur, elem)
+		}
+		if !within(realDest, cur) {
+			return fmt.Errorf("target is outside the archive")
+		}
+		info, err := os.Lstat(cur)
+		if err != nil {
+			return fmt.Errorf("target does not exist")
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("target passes through another link")
+		}
+	}
+	return nil
+}
+
+// within reports whether path is dir or below it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// sourceRoot returns the directory holding the extracted sources: dir itself,
+// or its only subdirectory when the archive wraps everything in one folder
+// (as GitHub's "Download ZIP" does).
+func sourceRoot(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return dir
+	}
+	return filepath.Join(dir, entries[0].Name())
+}
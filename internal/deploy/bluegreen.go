@@ -0,0 +1,252 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/prashanta0234/vpsmyth/internal/config"
+	"github.com/prashanta0234/vpsmyth/internal/proxy"
+	"github.com/prashanta0234/vpsmyth/internal/system"
+)
+
+// Deployment strategies.
+const (
+	// StrategyRecreate replaces the app's container in place; the app is down
+	// while the new container starts.
+	StrategyRecreate = "recreate"
+	// StrategyBlueGreen starts the new container next to the old one and only
+	// switches traffic to it once it is healthy.
+	StrategyBlueGreen = "bluegreen"
+)
+
+// AppLabelKey labels blue/green containers with the app they belong to.
+const AppLabelKey = "vpsmyth.app"
+
+// ValidStrategy reports whether s names a deployment strategy. An empty
+// strategy keeps the one the app was last deployed with.
+func ValidStrategy(s string) bool {
+	return s == "" || s == StrategyRecreate || s == StrategyBlueGreen
+}
+
+// appInstance describes the container serving an app after startApp.
+type appInstance struct {
+	ContainerID  string
+	Strategy     string
+	Color        string // "blue" or "green" for blue/green apps
+	InternalPort int    // loopback port the proxy forwards to
+	HealthCheck  *HealthCheck
+	Container    *ContainerSettings
+}
+
+func (inst appInstance) apply(meta *DeploymentMetadata) {
+	meta.ContainerID = inst.ContainerID
+	meta.Strategy = inst.Strategy
+	meta.Color = inst.Color
+	meta.InternalPort = inst.InternalPort
+	meta.HealthCheck = inst.HealthCheck
+	meta.Container = inst.Container
+}
+
+// startApp runs imageTag as the app's container using strategy, health
+// check hc and container settings ctr, or those of the previous deployment
+// when they are empty. Cancelling ctx abandons a blue/green deploy while it
+// waits for the new container, leaving the previous one serving.
+func startApp(ctx context.Context, sanitizedName, strategy string, hc *HealthCheck, ctr *ContainerSettings, imageTag string, port int, env map[string]string, rep Reporter) (appInstance, error) {
+	prev, _ := loadMetadata(sanitizedName)
+	if strategy == "" {
+		strategy = prev.Strategy
+	}
+	if hc == nil {
+		hc = prev.HealthCheck
+	}
+	if ctr == nil {
+		ctr = prev.Container
+	}
+	// A new container starts with a clean health record
+	defer forgetHealth(sanitizedName)
+
+	if strategy != StrategyBlueGreen {
+		// Leaving blue/green: the proxy and colored containers must give up the port.
+		if prev.Color != "" {
+			retireBlueGreen(sanitizedName, prev)
+		}
+		id, err := replaceAppContainer(sanitizedName, ctr, imageTag, port, env)
+		if err != nil {
+			return appInstance{}, err
+		}
+		return appInstance{ContainerID: id, Strategy: strategy, HealthCheck: hc, Container: ctr}, nil
+	}
+	return swapBlueGreen(ctx, sanitizedName, prev, hc, ctr, imageTag, port, env, rep)
+}
+
+// swapBlueGreen starts imageTag in the idle color on a loopback port, waits
+// for it to become healthy, routes the public port to it and then retires
+// the previous container. If the new container is not healthy, the previous
+// one keeps serving.
+func swapBlueGreen(ctx context.Context, sanitizedName string, prev DeploymentMetadata, hc *HealthCheck, ctr *ContainerSettings, imageTag string, port int, env map[string]string, rep Reporter) (appInstance, error) {
+	if port <= 0 {
+		return appInstance{}, fmt.Errorf("blue/green deployments require a port")
+	}
+
+	color := "blue"
+	if prev.Color == "blue" {
+		color = "green"
+	}
+	name := sanitizedName + "-" + color
+
+	// A container left in the idle color by an earlier failed deploy is not serving traffic.
+	system.Runtime.Remove(name, true)
+
+	internalPort, err := freePort()
+	if err != nil {
+		return appInstance{}, err
+	}
+	addr := fmt.Sprintf("127.0.0.1:%d", internalPort)
+
+	labels := system.ManagedLabels()
+	labels[AppLabelKey] = sanitizedName
+
+	fmt.Fprintf(rep, "Starting %s container %s on %s\n", color, name, addr)
+	opts := system.RunOptions{
+		Name:    name,
+		Image:   imageTag,
+		Env:     containerEnv(env, port),
+		Ports:   []system.Port{{HostIP: "127.0.0.1", HostPort: internalPort, ContainerPort: port}},
+		Labels:  labels,
+		Restart: "always",
+	}
+	ctr.applyTo(sanitizedName, &opts)
+	id, err := system.Runtime.Run(opts)
+	if err != nil {
+		return appInstance{}, err
+	}
+
+	rep.SetState(StateHealthCheck)
+	timeout := time.Duration(config.EnvInt("VPSMYTH_HEALTH_TIMEOUT", 60)) * time.Second
+	fmt.Fprintf(rep, "Waiting up to %s for %s to become healthy\n", timeout, name)
+	if err := waitHealthy(ctx, name, addr, hc, timeout); err != nil {
+		if logs, _ := system.Runtime.Logs(name, 50); logs != "" {
+			fmt.Fprintf(rep, "Last logs of %s:\n%s\n", name, logs)
+		}
+		system.Runtime.Remove(name, true)
+		return appInstance{}, fmt.Errorf("new container failed its health check, previous container kept running: %w", err)
+	}
+
+	// A container started with the recreate strategy publishes the public
+	// port itself: it is stopped to free the port and only removed once the
+	// proxy listens on it.
+	legacy := false
+	if prev.Color == "" {
+		if _, err := system.Runtime.Inspect(sanitizedName); err == nil {
+			legacy = true
+			system.Runtime.Stop(sanitizedName)
+		}
+	} else if prev.Port != port {
+		proxy.Remove(prev.Port)
+	}
+	if err := proxy.Set(port, addr); err != nil {
+		system.Runtime.Remove(name, true)
+		if legacy {
+			if startErr := system.Runtime.Start(sanitizedName); startErr != nil {
+				fmt.Fprintf(rep, "Failed to restart %s: %v\n", sanitizedName, startErr)
+			}
+		}
+		return appInstance{}, err
+	}
+	if legacy {
+		system.Runtime.Remove(sanitizedName, true)
+	}
+	fmt.Fprintf(rep, "Traffic on port %d switched to %s\n", port, name)
+
+	if prev.Color != "" {
+		oldName := sanitizedName + "-" + prev.Color
+		drain := time.Duration(config.EnvInt("VPSMYTH_DRAIN_TIMEOUT", 10)) * time.Second
+		if !proxy.Drain(port, fmt.Sprintf("127.0.0.1:%d", prev.InternalPort), drain) {
+			fmt.Fprintf(rep, "Connections to %s still open after %s, closing them\n", oldName, drain)
+		}
+		system.Runtime.Remove(oldName, true)
+		fmt.Fprintf(rep, "Retired %s\n", oldName)
+	}
+
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return appInstance{ContainerID: id, Strategy: StrategyBlueGreen, Color: color, InternalPort: internalPort, HealthCheck: hc, Container: ctr}, nil
+}
+
+// waitHealthy waits until the container is running and passes hc, or
+// accepts TCP connections on addr when the app has no health check. It gives
+// up when ctx ends.
+func waitHealthy(ctx context.Context, name, addr string, hc *HealthCheck, timeout time.Duration) error {
+	check := HealthCheck{Type: "tcp", Timeout: 1}
+	if hc != nil {
+		check = *hc
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		c, err := system.Runtime.Inspect(name)
+		if err != nil {
+			return err
+		}
+		if !c.Running {
+			return fmt.Errorf("container %s exited (%s)", name, c.Status)
+		}
+		err = probe(check, name, addr)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s was not healthy within %s: %w", name, timeout, err)
+		}
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// retireBlueGreen removes the proxy and colored containers of a blue/green app.
+func retireBlueGreen(sanitizedName string, meta DeploymentMetadata) {
+	if meta.Port > 0 {
+		proxy.Remove(meta.Port)
+	}
+	system.Runtime.Remove(sanitizedName+"-blue", true)
+	system.Runtime.Remove(sanitizedName+"-green", true)
+}
+
+// appContainerName returns the name of the container currently serving the app.
+func appContainerName(sanitizedName string) string {
+	if meta, err := loadMetadata(sanitizedName); err == nil && meta.Color != "" {
+		return sanitizedName + "-" + meta.Color
+	}
+	return sanitizedName
+}
+
+// freePort returns a loopback TCP port that is currently unused.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// RestoreProxies routes the public ports of blue/green apps to their active
+// containers again. It is called once at startup.
+func RestoreProxies() {
+	metas, _ := listMetadata()
+	for _, meta := range metas {
+		if meta.Color == "" || meta.Port == 0 {
+			continue
+		}
+		if err := proxy.Set(meta.Port, fmt.Sprintf("127.0.0.1:%d", meta.InternalPort)); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to restore proxy for %s: %v\n", meta.AppName, err)
+		}
+	}
+}
@@ -1,279 +1,587 @@
 package deploy
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/prashanta0234/vpsmyth/internal/config"
 	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/system"
 )
 
 // DeploymentMetadata stores information about a deployed application.
 type DeploymentMetadata struct {
-	AppName     string            `json:"app_name"`
-	ContainerID string            `json:"container_id"`
-	Port        int               `json:"port"`
-	Status      string            `json:"status"`
-	Env         map[string]string `json:"env"`
-	RepoURL     string            `json:"repo_url"`
-	Framework   string            `json:"framework"`
+	AppName     string                   `json:"app_name"`
+	ContainerID string                   `json:"container_id"`
+	Port        int                      `json:"port"`
+	Status      string                   `json:"status"`
+	Env         map[string]string        `json:"env"`
+	EnvOptions  map[string]EnvVarOptions `json:"env_options,omitempty"`
+	RepoURL     string                   `json:"repo_url"`
+	Framework   string                   `json:"framework"`
+	Image       string                   `json:"image,omitempty"`
+	Release     int                      `json:"release,omitempty"`
+	Ref         string                   `json:"ref,omitempty"` // branch, tag or commit requested; empty for the default branch
+	CommitSHA   string                   `json:"commit_sha,omitempty"`
+	CommitMsg   string                   `json:"commit_message,omitempty"`
+
+	Strategy     string `json:"strategy,omitempty"`
+	Color        string `json:"color,omitempty"`
+	InternalPort int    `json:"internal_port,omitempty"`
+
+	HealthCheck *HealthCheck  `json:"health_check,omitempty"`
+	Health      *HealthStatus `json:"health,omitempty"` // filled in by ListApps, not stored
+
+	Build BuildSettings `json:"build"`
+
+	Container *ContainerSettings `json:"container,omitempty"`
+	Cron      []CronJob          `json:"cron,omitempty"` // declared in the manifest
+	Domains   []string           `json:"domains,omitempty"`
+	// SecretGroups are the groups whose secrets the app gets
+	SecretGroups []string `json:"secret_groups,omitempty"`
+}
+
+// Steps reported to a Reporter while a deployment runs.
+const (
+	StateCloning    = "cloning"
+	StateExtracting = "extracting"
+	StatePulling    = "pulling"
+	StateBuilding   = "building"
+	StateStarting   = "starting"
+	// StateHealthCheck is reported while a blue/green deploy waits for the new container.
+	StateHealthCheck = "health_check"
+)
+
+// Spec describes an application to deploy, either from a git repository or
+// from a prebuilt image.
+type Spec struct {
+	AppName   string
+	Category  string
+	Framework string
+	RepoURL   string
+	Ref       string // branch, tag or commit SHA to deploy; empty for the default branch
+	// ArchivePath is the uploaded .zip or .tar.gz to deploy with DeployUpload
+	ArchivePath string
+	ImageName   string
+	Port        int
+	Env         map[string]string
+	EnvOptions  map[string]EnvVarOptions // scope of env vars; variables without options are runtime-only
+	Strategy    string                   // StrategyRecreate or StrategyBlueGreen; empty keeps the app's current one
+	// HealthCheck gates blue/green switches and is run by the health checker; nil keeps the app's current one
+	HealthCheck *HealthCheck
+	Build       BuildSettings
+	// Container sets volumes and resource limits; nil keeps the app's current ones
+	Container *ContainerSettings
+	// SecretGroups are the groups whose secrets the app gets; nil keeps the app's current ones
+	SecretGroups []string
+	JobID        int64 // deploy job running this deployment, if any
+}
+
+// Reporter receives progress updates from a running deployment. The output
+// of every step (git, docker build, ...) is written to it.
+type Reporter interface {
+	io.Writer
+	SetState(state string)
+}
+
+// Result summarizes a deployment for its deploy job.
+type Result struct {
+	Detection *Detection `json:"detection,omitempty"`
+	Manifest  string     `json:"manifest,omitempty"` // manifest file the settings were read from
+	Release   int        `json:"release,omitempty"`
+}
+
+// resultReporter is implemented by reporters that keep the Result of a
+// deployment, such as deploy jobs.
+type resultReporter interface {
+	SetResult(v interface{})
+}
+
+func reportResult(rep Reporter, result Result) {
+	if r, ok := rep.(resultReporter); ok {
+		r.SetResult(result)
+	}
+}
+
+// contextReporter is implemented by reporters that can cancel a deployment,
+// such as deploy jobs.
+type contextReporter interface {
+	Context() context.Context
+}
+
+// deployContext returns the context of a deployment run for rep, bounded by
+// VPSMYTH_DEPLOY_TIMEOUT seconds (default 3600).
+func deployContext(rep Reporter) (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	if r, ok := rep.(contextReporter); ok {
+		ctx = r.Context()
+	}
+	timeout := time.Duration(config.EnvInt("VPSMYTH_DEPLOY_TIMEOUT", 3600)) * time.Second
+	return context.WithTimeoutCause(ctx, timeout, fmt.Errorf("deployment timed out after %s", timeout))
+}
+
+// stepContext bounds a step of a deployment by the timeout in seconds set
+// by the env var name, or def.
+func stepContext(ctx context.Context, step, name string, def int) (context.Context, context.CancelFunc) {
+	timeout := time.Duration(config.EnvInt(name, def)) * time.Second
+	return context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%s timed out after %s", step, timeout))
+}
+
+// stepFailed returns why a step failed: the cause of its context when the
+// context ended (a timeout or a cancellation), else err.
+func stepFailed(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return err
+}
+
+func detectedFrom(det Detection) string {
+	if det.DetectedBy == "" {
+		return "missing build files"
+	}
+	return det.DetectedBy
+}
+
+// stdoutReporter prints progress to stdout; it is used for synchronous deployments.
+type stdoutReporter struct{}
+
+func (stdoutReporter) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+func (stdoutReporter) SetState(state string) {
+	fmt.Printf("Deployment step: %s\n", state)
 }
 
 // DeployNodeDocker deploys a Node.js application using Docker.
 func DeployNodeDocker(appName string, category string, framework string, repoURL string, port int, env map[string]string) error {
+	return DeployGit(Spec{
+		AppName:   appName,
+		Category:  category,
+		Framework: framework,
+		RepoURL:   repoURL,
+		Port:      port,
+		Env:       env,
+	}, stdoutReporter{})
+}
+
+// DeployGit clones spec.RepoURL, builds it with a generated or repo-provided
+// Dockerfile and runs the resulting image, reporting each step to rep.
+func DeployGit(spec Spec, rep Reporter) error {
+	appName, repoURL := spec.AppName, spec.RepoURL
+
 	// Sanitize app name for Docker and file system
-	sanitizedName := sanitizeAppName(appName)
+	sanitizedName := SanitizeAppName(appName)
 
 	baseDir := "deployments"
 	appDir := filepath.Join(baseDir, sanitizedName)
 	repoDir := filepath.Join(appDir, "repo")
-	metaFile := filepath.Join(baseDir, sanitizedName+".json")
+
+	ctx, cancel := deployContext(rep)
+	defer cancel()
+	unlock, err := lockApp(ctx, sanitizedName, rep)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	if err := os.MkdirAll(repoDir, 0755); err != nil {
 		return fmt.Errorf("failed to create directories: %w", err)
 	}
 
-	fmt.Printf("Cloning repository: %s\n", repoURL)
-	
-	// Fetch GitHub token for private repos
-	token, _ := db.GetGitHubCredentials()
-	cloneURL := repoURL
-	if token != "" && strings.Contains(repoURL, "github.com") {
-		// Inject token into URL: https://<token>@github.com/user/repo
-		cloneURL = strings.Replace(repoURL, "https://github.com", fmt.Sprintf("https://%s@github.com", token), 1)
+	rep.SetState(StateCloning)
+	if spec.Ref != "" {
+		fmt.Fprintf(rep, "Cloning repository: %s (ref: %s)\n", repoURL, spec.Ref)
+	} else {
+		fmt.Fprintf(rep, "Cloning repository: %s\n", repoURL)
 	}
 
-	cloneCmd := exec.Command("git", "clone", cloneURL, repoDir)
-	if _, err := os.Stat(filepath.Join(repoDir, ".git")); err == nil {
-		cloneCmd = exec.Command("git", "-C", repoDir, "pull")
+	cloneCtx, cancelClone := stepContext(ctx, "clone", "VPSMYTH_CLONE_TIMEOUT", 600)
+	err = checkoutRef(cloneCtx, repoDir, cloneURL(repoURL), spec.Ref, rep)
+	cancelClone()
+	if err != nil {
+		return fmt.Errorf("failed to clone/pull repository: %w", stepFailed(cloneCtx, err))
 	}
-	if err := cloneCmd.Run(); err != nil {
-		return fmt.Errorf("failed to clone/pull repository: %w", err)
+
+	commitSHA := gitOutput(repoDir, "rev-parse", "HEAD")
+	commitMessage := gitOutput(repoDir, "log", "-1", "--format=%s")
+	fmt.Fprintf(rep, "Checked out %s: %s\n", shortSHA(commitSHA), commitMessage)
+
+	return buildAndRun(ctx, spec, repoDir, source{
+		RepoURL:     repoURL,
+		Ref:         spec.Ref,
+		CommitSHA:   commitSHA,
+		CommitMsg:   commitMessage,
+		ProjectFile: gitTracked(repoDir),
+	}, rep)
+}
+
+// source describes where the code of a deployment came from.
+type source struct {
+	RepoURL   string
+	Ref       string
+	CommitSHA string
+	CommitMsg string
+	// ProjectFile reports whether a file, relative to the source directory,
+	// belongs to the project rather than to an earlier deployment (like a
+	// generated Dockerfile). Nil means every existing file does.
+	ProjectFile func(path string) bool
+}
+
+// buildAndRun builds the sources in repoDir with a generated or
+// project-provided Dockerfile, records a release and runs the image. When ctx
+// ends before the new container starts, the release is discarded and the
+// previous one keeps running.
+func buildAndRun(ctx context.Context, spec Spec, repoDir string, src source, rep Reporter) error {
+	// The metadata keeps the requested settings, so that settings removed
+	// from the manifest fall back to them on the next deploy.
+	requested := spec
+	spec, manifest, err := applyManifest(spec, repoDir)
+	if err != nil {
+		return err
+	}
+	if spec.Port != requested.Port {
+		// The manifest moves the app to another port: reserve it instead of
+		// the one allocated for the request, refusing ports in use
+		if _, err := AllocatePort(spec.AppName, spec.Port); err != nil {
+			return fmt.Errorf("manifest port: %w", err)
+		}
 	}
+	appName, category, framework := spec.AppName, spec.Category, spec.Framework
+	port, env := spec.Port, spec.Env
+	sanitizedName := SanitizeAppName(appName)
+	commitSHA := src.CommitSHA
 
-	dockerfilePath := filepath.Join(repoDir, "Dockerfile")
-	
-	// Check if Dockerfile is tracked by git
-	isGitTracked := false
-	checkGitCmd := exec.Command("git", "-C", repoDir, "ls-files", "--error-unmatch", "Dockerfile")
-	if err := checkGitCmd.Run(); err == nil {
-		isGitTracked = true
+	// Secret references are resolved for the build and the container only;
+	// the release and metadata keep them
+	groups := appSecretGroups(sanitizedName, spec.SecretGroups)
+	secrets, err := appSecrets(sanitizedName, groups)
+	if err != nil {
+		return err
+	}
+	resolved := spec
+	if resolved.Env, err = expandSecrets(env, secrets); err != nil {
+		return err
+	}
+
+	var cron []CronJob
+	if manifest != nil {
+		fmt.Fprintf(rep, "Using settings from %s\n", ManifestFile)
+		if missing := manifest.missingEnv(resolved.Env); len(missing) > 0 {
+			return fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+		}
+		cron = manifest.Cron
+		for _, job := range cron {
+			fmt.Fprintf(rep, "Warning: cron job %s declared but not scheduled, cron jobs are not run yet\n", job.Name)
+		}
 	}
 
-	// Generate/Overwrite Dockerfile if:
-	// - It doesn't exist
-	// - OR it's NOT tracked by git (meaning we probably created it)
+	// Generate/Overwrite the Dockerfile in the root directory if:
+	// - The project has none there (or at build.dockerfile)
+	// - OR it's not part of the project (meaning we probably created it)
 	// - OR the user explicitly selected a framework (they want our template)
-	if _, err := os.Stat(dockerfilePath); os.IsNotExist(err) || !isGitTracked || framework != "" {
-		fmt.Printf("Generating Dockerfile for framework: %s (%s)\n", framework, category)
-		dockerfileContent := generateSmartDockerfile(repoDir, port, category, framework)
-		if err := os.WriteFile(dockerfilePath, []byte(dockerfileContent), 0644); err != nil {
+	buildArgs, buildSecrets := buildArgs(resolved)
+	plan, err := planDockerfile(spec, repoDir, src.ProjectFile)
+	if err != nil {
+		return err
+	}
+	det := plan.Detection
+	if plan.Params != nil {
+		fmt.Fprintf(rep, "Generating Dockerfile for framework: %s (%s)\n", det.Framework, category)
+		if det.DetectedBy != "selected" {
+			fmt.Fprintf(rep, "Detected %s from %s, using the %s template\n", det.Framework, detectedFrom(det), det.Template)
+		}
+		if det.Template == "go" {
+			fmt.Fprintf(rep, "Building Go package %s (CGO enabled: %t)\n", plan.Params.GoMain, plan.Params.CGO)
+			goArgs := goBuildArgs(src.RepoURL, spec.Build)
+			if buildArgs == nil {
+				buildArgs = make(map[string]string, len(goArgs))
+			}
+			for k, v := range goArgs {
+				buildArgs[k] = v
+			}
+			// The token is mounted into the download and build steps only, so
+			// it ends up in neither an image layer nor the build args
+			if plan.Params.GitHubToken {
+				if buildSecrets == nil {
+					buildSecrets = make(map[string]string, 1)
+				}
+				buildSecrets[githubTokenSecret] = goGitHubToken(src.RepoURL)
+			}
+		}
+		if err := writeGeneratedFile(repoDir, plan.DockerfilePath, plan.Dockerfile); err != nil {
 			return fmt.Errorf("failed to create Dockerfile: %w", err)
 		}
+		framework = det.Framework
+	} else {
+		fmt.Fprintf(rep, "Using the project's Dockerfile %s\n", plan.DockerfilePath)
 	}
+	if plan.Context != "." {
+		fmt.Fprintf(rep, "Build context: %s\n", plan.Context)
+	}
+	contextDir := filepath.Join(repoDir, plan.Context)
+	dockerfile, _ := filepath.Rel(plan.Context, plan.DockerfilePath)
+	result := Result{Detection: &det}
+	if manifest != nil {
+		result.Manifest = filepath.Join(cleanRel(spec.Build.RootDir), ManifestFile)
+	}
+	reportResult(rep, result)
 
-	dockerIgnorePath := filepath.Join(repoDir, ".dockerignore")
-	if _, err := os.Stat(dockerIgnorePath); os.IsNotExist(err) {
+	dockerIgnorePath := filepath.Join(plan.Context, ".dockerignore")
+	if _, err := os.Lstat(filepath.Join(repoDir, dockerIgnorePath)); os.IsNotExist(err) {
 		dockerIgnoreContent := "node_modules\n.next\ndist\nbuild\n.git\n"
-		os.WriteFile(dockerIgnorePath, []byte(dockerIgnoreContent), 0644)
+		switch det.Template {
+		case "rust":
+			dockerIgnoreContent += "target\n"
+		case "python":
+			dockerIgnoreContent += "__pycache__\n.venv\n"
+		}
+		if err := writeGeneratedFile(repoDir, dockerIgnorePath, dockerIgnoreContent); err != nil {
+			return fmt.Errorf("failed to create .dockerignore: %w", err)
+		}
 	}
 
-	imageTag := fmt.Sprintf("vpsmyth/%s:latest", sanitizedName)
-	fmt.Printf("Building Docker image: %s\n", imageTag)
-	buildCmd := exec.Command("docker", "build", "-t", imageTag, repoDir)
-	if err := buildCmd.Run(); err != nil {
-		return fmt.Errorf("failed to build Docker image: %w", err)
+	number, err := db.CreateRelease(db.Release{
+		AppName:   sanitizedName,
+		JobID:     spec.JobID,
+		Status:    ReleasePending,
+		CommitSHA: commitSHA,
+		Env:       env,
+		Framework: framework,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record release: %w", err)
 	}
+	imageTag := releaseImage(sanitizedName, number)
+	fmt.Fprintf(rep, "Creating release r%d\n", number)
 
-	// 5. Run Docker container
-	fmt.Printf("Running Docker container for: %s (sanitized: %s)\n", appName, sanitizedName)
-	// Stop and remove existing container if it exists
-	exec.Command("docker", "stop", sanitizedName).Run()
-	exec.Command("docker", "rm", sanitizedName).Run()
-
-	runArgs := []string{"run", "-d", "--name", sanitizedName, "--label", "managed-by=vpsmyth", "-p", fmt.Sprintf("%d:%d", port, port), "--restart", "always"}
-	for k, v := range env {
-		runArgs = append(runArgs, "-e", fmt.Sprintf("%s=%s", k, v))
+	rep.SetState(StateBuilding)
+	fmt.Fprintf(rep, "Building Docker image: %s\n", imageTag)
+	buildOpts := system.BuildOptions{
+		Tag:        imageTag,
+		ContextDir: contextDir,
+		Dockerfile: dockerfile,
+		BuildArgs:  buildArgs,
+		Secrets:    buildSecrets,
+		Target:     spec.Build.Target,
+		Output:     rep,
+	}
+	releaseSlot, err := acquireBuildSlot(ctx, rep)
+	if err != nil {
+		failRelease(sanitizedName, number, imageTag, commitSHA)
+		return err
+	}
+	buildCtx, cancelBuild := stepContext(ctx, "build", "VPSMYTH_BUILD_TIMEOUT", 1800)
+	err = system.Runtime.Build(buildCtx, buildOpts)
+	cancelBuild()
+	releaseSlot()
+	if err != nil {
+		discardRelease(sanitizedName, number, imageTag, commitSHA, buildCtx.Err() != nil)
+		return fmt.Errorf("failed to build Docker image: %w", stepFailed(buildCtx, err))
+	}
+	if ctx.Err() != nil {
+		discardRelease(sanitizedName, number, imageTag, commitSHA, true)
+		return context.Cause(ctx)
 	}
-	runArgs = append(runArgs, "-e", fmt.Sprintf("PORT=%d", port))
-	runArgs = append(runArgs, imageTag)
 
-	runCmd := exec.Command("docker", runArgs...)
-	output, err := runCmd.CombinedOutput()
+	// 5. Run Docker container
+	rep.SetState(StateStarting)
+	fmt.Fprintf(rep, "Running Docker container for: %s (sanitized: %s)\n", appName, sanitizedName)
+	runEnv := runtimeEnv(resolved.Env, spec.EnvOptions)
+	inst, err := startApp(ctx, sanitizedName, spec.Strategy, spec.HealthCheck, spec.Container, imageTag, port, runEnv, rep)
 	if err != nil {
-		return fmt.Errorf("failed to run Docker container: %s: %w", string(output), err)
+		failRelease(sanitizedName, number, imageTag, commitSHA)
+		return fmt.Errorf("failed to run Docker container: %w", stepFailed(ctx, err))
 	}
-	containerID := string(output[:12]) // Get short container ID
+	db.UpdateRelease(sanitizedName, number, ReleaseSucceeded, imageTag, imageDigest(imageTag), commitSHA)
+	result.Release = number
+	reportResult(rep, result)
 
 	// 6. Store metadata
 	meta := DeploymentMetadata{
-		AppName:     appName,
-		ContainerID: containerID,
-		Port:        port,
-		Status:      "running",
-		Env:         env,
-		RepoURL:     repoURL,
-		Framework:   framework,
-	}
-	metaData, err := json.MarshalIndent(meta, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %w", err)
+		AppName:    appName,
+		Port:       port,
+		Status:     "running",
+		Env:        env,
+		EnvOptions: spec.EnvOptions,
+		RepoURL:    src.RepoURL,
+		Framework:  requested.Framework,
+		Image:      imageTag,
+		Release:    number,
+		Ref:        src.Ref,
+		CommitSHA:  commitSHA,
+		CommitMsg:  src.CommitMsg,
+		Build:      requested.Build,
+		Cron:       cron,
+
+		SecretGroups: groups,
 	}
-	if err := os.WriteFile(metaFile, metaData, 0644); err != nil {
-		return fmt.Errorf("failed to save metadata: %w", err)
+	inst.apply(&meta)
+	if err := saveMetadata(sanitizedName, meta); err != nil {
+		return err
 	}
 
-	fmt.Printf("Successfully deployed %s (Container ID: %s)\n", appName, containerID)
+	fmt.Fprintf(rep, "Successfully deployed %s r%d (Container ID: %s)\n", appName, number, inst.ContainerID)
 	return nil
 }
 
 // DeployFromImage pulls a Docker image and runs it as a container.
 func DeployFromImage(appName, imageName string, port int, env map[string]string) error {
-	// 1. Pull the image
-	pullCmd := exec.Command("docker", "pull", imageName)
-	if err := pullCmd.Run(); err != nil {
-		return fmt.Errorf("failed to pull image %s: %w", imageName, err)
+	return DeployImage(Spec{AppName: appName, ImageName: imageName, Port: port, Env: env}, stdoutReporter{})
+}
+
+// DeployImage pulls spec.ImageName and runs it as a container, reporting each step to rep.
+func DeployImage(spec Spec, rep Reporter) error {
+	appName, imageName, port, env := spec.AppName, spec.ImageName, spec.Port, spec.Env
+	sanitizedName := SanitizeAppName(appName)
+
+	ctx, cancel := deployContext(rep)
+	defer cancel()
+	unlock, err := lockApp(ctx, sanitizedName, rep)
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	// 2. Run the container
-	runArgs := []string{"run", "-d", "--name", appName, "--label", "managed-by=vpsmyth"}
-	for k, v := range env {
-		runArgs = append(runArgs, "-e", fmt.Sprintf("%s=%s", k, v))
+	number, err := db.CreateRelease(db.Release{
+		AppName:   sanitizedName,
+		JobID:     spec.JobID,
+		Status:    ReleasePending,
+		Image:     imageName,
+		Env:       env,
+		Framework: "Docker Image",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record release: %w", err)
 	}
-	if port > 0 {
-		runArgs = append(runArgs, "-p", fmt.Sprintf("%d:%d", port, port))
+
+	// 1. Pull the image
+	rep.SetState(StatePulling)
+	pullCtx, cancelPull := stepContext(ctx, "pull", "VPSMYTH_PULL_TIMEOUT", 900)
+	err = system.Runtime.Pull(pullCtx, imageName, rep)
+	cancelPull()
+	if err != nil {
+		failRelease(sanitizedName, number, imageName, "")
+		return stepFailed(pullCtx, err)
+	}
+	if ctx.Err() != nil {
+		failRelease(sanitizedName, number, imageName, "")
+		return context.Cause(ctx)
 	}
-	runArgs = append(runArgs, imageName)
 
-	runCmd := exec.Command("docker", runArgs...)
-	if err := runCmd.Run(); err != nil {
-		return fmt.Errorf("failed to run container: %w", err)
+	// 2. Run the container
+	rep.SetState(StateStarting)
+	groups := appSecretGroups(sanitizedName, spec.SecretGroups)
+	runEnv, err := appEnv(sanitizedName, groups, runtimeEnv(env, spec.EnvOptions))
+	if err != nil {
+		failRelease(sanitizedName, number, imageName, "")
+		return err
 	}
+	inst, err := startApp(ctx, sanitizedName, spec.Strategy, spec.HealthCheck, spec.Container, imageName, port, runEnv, rep)
+	if err != nil {
+		failRelease(sanitizedName, number, imageName, "")
+		return stepFailed(ctx, err)
+	}
+	db.UpdateRelease(sanitizedName, number, ReleaseSucceeded, imageName, imageDigest(imageName), "")
 
 	// 3. Save metadata
 	meta := DeploymentMetadata{
-		AppName:   appName,
-		RepoURL:   "Image: " + imageName,
-		Port:      port,
-		Env:       env,
-		Status:    "Running",
-		Framework: "Docker Image",
-	}
+		AppName:    appName,
+		RepoURL:    "Image: " + imageName,
+		Port:       port,
+		Env:        env,
+		EnvOptions: spec.EnvOptions,
+		Status:     "Running",
+		Framework:  "Docker Image",
+		Image:      imageName,
+		Release:    number,
 
-	metaDir := "deployments"
-	os.MkdirAll(metaDir, 0755)
-	metaPath := filepath.Join(metaDir, appName+".json")
-	metaData, _ := json.MarshalIndent(meta, "", "  ")
-	os.WriteFile(metaPath, metaData, 0644)
-
-	return nil
+		SecretGroups: groups,
+	}
+	inst.apply(&meta)
+	return saveMetadata(sanitizedName, meta)
 }
 
-// sanitizeAppName converts a string to a Docker-compatible name.
-func sanitizeAppName(name string) string {
-	// Replace spaces with hyphens
-	sanitized := strings.ReplaceAll(name, " ", "-")
-	// Convert to lowercase
-	sanitized = strings.ToLower(sanitized)
-	// Remove non-alphanumeric/hyphen characters
-	reg := regexp.MustCompile("[^a-z0-9-]")
-	sanitized = reg.ReplaceAllString(sanitized, "")
-	return sanitized
-}
+// replaceAppContainer removes any existing container for the app and starts a
+// new one from imageTag. It returns the short ID of the new container.
+func replaceAppContainer(sanitizedName string, ctr *ContainerSettings, imageTag string, port int, env map[string]string) (string, error) {
+	// Stop and remove existing container if it exists
+	system.Runtime.Remove(sanitizedName, true)
 
-// generateSmartDockerfile analyzes the repository and returns a suitable Dockerfile.
-func generateSmartDockerfile(repoDir string, port int, category string, framework string) string {
-	// If user explicitly selected a framework, use it
-	if framework != "" {
-		switch framework {
-		case "nextjs":
-			return `FROM node:18-alpine
-WORKDIR /app
-RUN apk add --no-cache libc6-compat
-COPY package*.json ./
-RUN npm install
-COPY . .
-RUN npm run build
-EXPOSE ` + fmt.Sprint(port) + `
-ENV PORT ` + fmt.Sprint(port) + `
-CMD ["npm", "start"]
-`
-		case "react":
-			return `FROM node:18-alpine
-WORKDIR /app
-COPY package*.json ./
-RUN npm install
-COPY . .
-RUN npm run build
-RUN npm install -g serve
-EXPOSE ` + fmt.Sprint(port) + `
-CMD ["serve", "-s", "dist", "-p", "` + fmt.Sprint(port) + `"]
-`
-		case "html":
-			return `FROM pierotofy/static-base
-COPY . /public
-EXPOSE ` + fmt.Sprint(port) + `
-CMD ["-p", "` + fmt.Sprint(port) + `"]
-`
-		case "nestjs":
-			return `FROM node:18-alpine
-WORKDIR /app
-COPY package*.json ./
-RUN npm install
-COPY . .
-RUN npm run build
-EXPOSE ` + fmt.Sprint(port) + `
-CMD ["npm", "run", "start:prod"]
-`
-		case "express", "nodejs":
-			return `FROM node:18-alpine
-WORKDIR /app
-COPY package*.json ./
-RUN npm install
-COPY . .
-EXPOSE ` + fmt.Sprint(port) + `
-CMD ["npm", "start"]
-`
-		}
+	opts := system.RunOptions{
+		Name:    sanitizedName,
+		Image:   imageTag,
+		Env:     containerEnv(env, port),
+		Labels:  system.ManagedLabels(),
+		Restart: "always",
+	}
+	if port > 0 {
+		opts.Ports = []system.Port{{HostPort: port, ContainerPort: port}}
 	}
+	ctr.applyTo(sanitizedName, &opts)
 
-	// Fallback to auto-detection if framework is empty
-	packageJSONPath := filepath.Join(repoDir, "package.json")
-	data, err := os.ReadFile(packageJSONPath)
+	id, err := system.Runtime.Run(opts)
 	if err != nil {
-		// No package.json, assume static HTML
-		return `FROM pierotofy/static-base
-COPY . /public
-EXPOSE ` + fmt.Sprint(port) + `
-CMD ["-p", "` + fmt.Sprint(port) + `"]
-`
+		return "", err
 	}
-
-	var pkg struct {
-		Dependencies    map[string]string `json:"dependencies"`
-		DevDependencies map[string]string `json:"devDependencies"`
-		Scripts         map[string]string `json:"scripts"`
+	if len(id) > 12 {
+		id = id[:12] // Get short container ID
 	}
-	json.Unmarshal(data, &pkg)
-
-	isNext := pkg.Dependencies["next"] != "" || pkg.DevDependencies["next"] != ""
-	isVite := pkg.Dependencies["vite"] != "" || pkg.DevDependencies["vite"] != ""
-	isReact := pkg.Dependencies["react-scripts"] != "" || pkg.DevDependencies["react-scripts"] != ""
-	isNest := pkg.Dependencies["@nestjs/core"] != ""
+	return id, nil
+}
 
-	if isNext {
-		return generateSmartDockerfile(repoDir, port, "frontend", "nextjs")
+// writeGeneratedFile writes a file vpsmyth generates, at a path relative to
+// repoDir. Uploaded and cloned sources can hold symlinks, so the file must
+// not be one and its directory must really be inside repoDir.
+func writeGeneratedFile(repoDir, rel, content string) error {
+	path := filepath.Join(repoDir, rel)
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%s is a symlink", rel)
+	}
+	realRepo, err := filepath.EvalSymlinks(repoDir)
+	if err != nil {
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return err
 	}
-	if isNest {
-		return generateSmartDockerfile(repoDir, port, "backend", "nestjs")
+	if !within(realRepo, realDir) {
+		return fmt.Errorf("%s is outside the sources", rel)
 	}
-	if isVite || isReact {
-		return generateSmartDockerfile(repoDir, port, "frontend", "react")
+	return os.WriteFile(filepath.Join(realDir, filepath.Base(path)), []byte(content), 0644)
+}
+
+// containerEnv returns the environment of an app container: the app's
+// variables, with its secrets resolved by appEnv, and PORT.
+func containerEnv(env map[string]string, port int) map[string]string {
+	runEnv := make(map[string]string, len(env)+1)
+	for k, v := range env {
+		runEnv[k] = v
+	}
+
+	if port > 0 {
+		runEnv["PORT"] = fmt.Sprint(port)
 	}
+	return runEnv
+}
 
-	return generateSmartDockerfile(repoDir, port, "backend", "nodejs")
+// SanitizeAppName converts a string to a Docker-compatible name. It identifies
+// an app in container names, metadata files and the database.
+func SanitizeAppName(name string) string {
+	// Replace spaces with hyphens
+	sanitized := strings.ReplaceAll(name, " ", "-")
+	// Convert to lowercase
+	sanitized = strings.ToLower(sanitized)
+	// Remove non-alphanumeric/hyphen characters
+	reg := regexp.MustCompile("[^a-z0-9-]")
+	sanitized = reg.ReplaceAllString(sanitized, "")
+	return sanitized
 }
@@ -0,0 +1,111 @@
+package deploy
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Scopes of an app's environment variables.
+const (
+	EnvScopeRuntime = "runtime" // set in the container only (the default)
+	EnvScopeBuild   = "build"   // passed to the image build only
+	EnvScopeBoth    = "both"
+)
+
+// EnvVarOptions says when an environment variable is available. Build-time
+// variables are passed as build args, visible in the image history, unless
+// they are secret: secret ones are mounted with BuildKit --secret for the
+// build steps and never stored in the image.
+type EnvVarOptions struct {
+	Scope  string `json:"scope,omitempty"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+func (o EnvVarOptions) atRuntime() bool {
+	return o.Scope != EnvScopeBuild
+}
+
+func (o EnvVarOptions) atBuild() bool {
+	return o.Scope == EnvScopeBuild || o.Scope == EnvScopeBoth
+}
+
+// ValidateEnvOptions checks the options of an app's environment variables.
+func ValidateEnvOptions(env map[string]string, options map[string]EnvVarOptions) error {
+	for name, o := range options {
+		if _, ok := env[name]; !ok {
+			return fmt.Errorf("options given for %s, which is not in env", name)
+		}
+		switch o.Scope {
+		case "", EnvScopeRuntime, EnvScopeBuild, EnvScopeBoth:
+		default:
+			return fmt.Errorf("invalid scope %q for %s: use runtime, build or both", o.Scope, name)
+		}
+		if o.atBuild() && !envNamePattern.MatchString(name) {
+			return fmt.Errorf("%s cannot be used at build time: not a valid variable name", name)
+		}
+	}
+	return nil
+}
+
+// runtimeEnv returns the variables of env set in the app's containers.
+func runtimeEnv(env map[string]string, options map[string]EnvVarOptions) map[string]string {
+	if len(options) == 0 {
+		return env
+	}
+	runEnv := make(map[string]string, len(env))
+	for name, value := range env {
+		if options[name].atRuntime() {
+			runEnv[name] = value
+		}
+	}
+	return runEnv
+}
+
+// buildEnv splits the build-time variables of env into build args and
+// secrets.
+func buildEnv(env map[string]string, options map[string]EnvVarOptions) (args, secrets map[string]string) {
+	for name, o := range options {
+		value, ok := env[name]
+		if !ok || !o.atBuild() {
+			continue
+		}
+		if o.Secret {
+			if secrets == nil {
+				secrets = map[string]string{}
+			}
+			secrets[name] = value
+		} else {
+			if args == nil {
+				args = map[string]string{}
+			}
+			args[name] = value
+		}
+	}
+	return args, secrets
+}
+
+// buildArgs returns the build args of spec: the app's build args, then its
+// build-time variables, which win; and its build secrets.
+func buildArgs(spec Spec) (args, secrets map[string]string) {
+	envArgs, secrets := buildEnv(spec.Env, spec.EnvOptions)
+	if len(spec.Build.BuildArgs) == 0 {
+		return envArgs, secrets
+	}
+	args = make(map[string]string, len(spec.Build.BuildArgs)+len(envArgs))
+	for k, v := range spec.Build.BuildArgs {
+		args[k] = v
+	}
+	for k, v := range envArgs {
+		args[k] = v
+	}
+	return args, secrets
+}
+
+func sortedNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,116 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/system"
+)
+
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// checkoutRef makes repoDir an exact copy of ref (a branch, tag or commit
+// SHA) of the repository at remoteURL. An empty ref selects the remote's
+// default branch. Local changes and force-pushed history are overwritten.
+func checkoutRef(ctx context.Context, repoDir, remoteURL, ref string, out io.Writer) error {
+	if _, err := os.Stat(filepath.Join(repoDir, ".git")); os.IsNotExist(err) {
+		if err := runGit(ctx, out, "init", "-q", repoDir); err != nil {
+			return err
+		}
+		if err := runGit(ctx, out, "-C", repoDir, "remote", "add", "origin", remoteURL); err != nil {
+			return err
+		}
+	} else if err := runGit(ctx, out, "-C", repoDir, "remote", "set-url", "origin", remoteURL); err != nil {
+		// The URL may carry a new access token or point to a moved repository
+		return err
+	}
+
+	fetchRef := ref
+	if fetchRef == "" {
+		fetchRef = "HEAD"
+	}
+	if err := runGit(ctx, out, "-C", repoDir, "fetch", "--force", "--tags", "origin", fetchRef); err != nil {
+		// Not every server lets a client fetch a commit by SHA; fetch all
+		// branches and look the commit up locally instead.
+		if !commitSHAPattern.MatchString(ref) {
+			return err
+		}
+		if err := runGit(ctx, out, "-C", repoDir, "fetch", "--force", "--tags", "origin", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+			return err
+		}
+		fetchRef = ""
+	}
+
+	target := "FETCH_HEAD"
+	if fetchRef == "" {
+		target = ref
+	}
+	if err := runGit(ctx, out, "-C", repoDir, "checkout", "-q", "--force", "--detach", target); err != nil {
+		return err
+	}
+	return runGit(ctx, out, "-C", repoDir, "clean", "-q", "-ffd")
+}
+
+// cloneURL returns repoURL with the stored GitHub token for private repos.
+func cloneURL(repoURL string) string {
+	token, _ := db.GetGitHubCredentials()
+	if token != "" && strings.Contains(repoURL, "github.com") {
+		// Inject token into URL: https://<token>@github.com/user/repo
+		return strings.Replace(repoURL, "https://github.com", fmt.Sprintf("https://%s@github.com", token), 1)
+	}
+	return repoURL
+}
+
+// gitTracked returns a function reporting whether git tracks a file of repoDir.
+func gitTracked(repoDir string) func(path string) bool {
+	return func(path string) bool {
+		return exec.Command("git", "-C", repoDir, "ls-files", "--error-unmatch", filepath.ToSlash(path)).Run() == nil
+	}
+}
+
+// runGit runs git with its output sent to out, killing it when ctx ends.
+func runGit(ctx context.Context, out io.Writer, args ...string) error {
+	cmd := system.CommandContext(ctx, "git", args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %w", redactURL(args), err)
+	}
+	return nil
+}
+
+// redactURL joins git arguments for an error message, hiding credentials in URLs.
+func redactURL(args []string) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		if at := strings.Index(a, "@"); at > 0 && strings.Contains(a[:at], "://") {
+			a = a[:strings.Index(a, "://")+3] + "***" + a[at:]
+		}
+		parts[i] = a
+	}
+	return strings.Join(parts, " ")
+}
+
+// gitOutput runs a git command in repoDir and returns its trimmed output,
+// or "" if the command fails.
+func gitOutput(repoDir string, args ...string) string {
+	out, err := exec.Command("git", append([]string{"-C", repoDir}, args...)...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -0,0 +1,144 @@
+package deploy
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+)
+
+// githubTokenSecret is the build secret holding the stored GitHub token in
+// the install and build steps of the go template.
+const githubTokenSecret = "VPSMYTH_GITHUB_TOKEN"
+
+// goMainPackage returns the package to build: the configured one, the module
+// root when it holds package main, or a package under cmd/ (the one named
+// after the app, or the first one when there are several).
+func goMainPackage(repoDir, appName, configured string) string {
+	if configured != "" {
+		main := path.Clean(filepath.ToSlash(configured))
+		if main == "." {
+			return main
+		}
+		return "./" + main
+	}
+	if hasMainPackage(repoDir) {
+		return "."
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(repoDir, "cmd"))
+	var commands []string
+	for _, e := range entries {
+		if e.IsDir() && hasMainPackage(filepath.Join(repoDir, "cmd", e.Name())) {
+			commands = append(commands, e.Name())
+		}
+	}
+	if len(commands) == 0 {
+		return "."
+	}
+	sort.Strings(commands)
+	for _, name := range commands {
+		if name == appName {
+			return "./cmd/" + name
+		}
+	}
+	return "./cmd/" + commands[0]
+}
+
+// hasMainPackage reports whether dir contains a non-test file of package main.
+func hasMainPackage(dir string) bool {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "package" {
+				if fields[1] == "main" {
+					return true
+				}
+				break
+			}
+		}
+	}
+	return false
+}
+
+// goVersion returns the major.minor Go version required by go.mod, or an
+// empty string when it cannot be read.
+func goVersion(repoDir string) string {
+	data, err := os.ReadFile(filepath.Join(repoDir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "go" {
+			parts := strings.SplitN(fields[1], ".", 3)
+			if len(parts) >= 2 {
+				return parts[0] + "." + parts[1]
+			}
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// goBuildArgs returns the build args of the Go template: the GOPRIVATE
+// patterns.
+func goBuildArgs(repoURL string, settings BuildSettings) map[string]string {
+	args := map[string]string{}
+	goPrivate := settings.GoPrivate
+	if goPrivate == "" {
+		goPrivate = githubOwnerPattern(repoURL)
+	}
+	if goPrivate != "" {
+		args["GOPRIVATE"] = goPrivate
+	}
+	return args
+}
+
+// goGitHubToken returns the stored GitHub token when repoURL is a GitHub
+// repository, whose private modules it may fetch, and "" otherwise.
+func goGitHubToken(repoURL string) string {
+	if githubOwnerPattern(repoURL) == "" {
+		return ""
+	}
+	token, _ := db.GetGitHubCredentials()
+	return token
+}
+
+// githubOwnerPattern returns "github.com/<owner>" for a GitHub repository URL.
+func githubOwnerPattern(repoURL string) string {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host != "github.com" {
+		return ""
+	}
+	owner, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if owner == "" {
+		return ""
+	}
+	return "github.com/" + owner
+}
+
+// goParams fills in the parameters of the go template.
+func goParams(p *TemplateParams, repoDir, appName string, settings BuildSettings) {
+	p.Version = goVersion(repoDir)
+	p.GoMain = goMainPackage(repoDir, appName, settings.GoMain)
+	p.CGO = settings.CGO
+	_, err := os.Stat(filepath.Join(repoDir, "vendor"))
+	p.Vendored = err == nil
+}
@@ -0,0 +1,275 @@
+package deploy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/system"
+)
+
+// Health statuses of an app.
+const (
+	HealthStarting  = "starting" // no check has passed or exhausted its retries yet
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// HealthCheck configures how the health of an app is probed.
+type HealthCheck struct {
+	Type           string   `json:"type" yaml:"type"`                               // "http", "tcp" or "cmd"
+	Path           string   `json:"path,omitempty" yaml:"path"`                     // http: request path, default "/"
+	ExpectedStatus int      `json:"expectedStatus,omitempty" yaml:"expectedStatus"` // http: default 200
+	Command        []string `json:"command,omitempty" yaml:"command"`               // cmd: run inside the container, must exit 0
+	Interval       int      `json:"interval,omitempty" yaml:"interval"`             // seconds between checks, default 30
+	Timeout        int      `json:"timeout,omitempty" yaml:"timeout"`               // seconds per check, default 5
+	Retries        int      `json:"retries,omitempty" yaml:"retries"`               // consecutive failures before unhealthy, default 3
+}
+
+// Validate reports whether the health check is usable.
+func (hc *HealthCheck) Validate() error {
+	switch hc.Type {
+	case "http":
+		if hc.Path != "" && !strings.HasPrefix(hc.Path, "/") {
+			return fmt.Errorf("health check path must start with /")
+		}
+	case "tcp":
+	case "cmd":
+		if len(hc.Command) == 0 {
+			return fmt.Errorf("cmd health check requires a command")
+		}
+	default:
+		return fmt.Errorf("unknown health check type %q", hc.Type)
+	}
+	if hc.Interval < 0 || hc.Timeout < 0 || hc.Retries < 0 {
+		return fmt.Errorf("health check interval, timeout and retries must not be negative")
+	}
+	return nil
+}
+
+func (hc HealthCheck) withDefaults() HealthCheck {
+	if hc.Path == "" {
+		hc.Path = "/"
+	}
+	if hc.ExpectedStatus == 0 {
+		hc.ExpectedStatus = http.StatusOK
+	}
+	if hc.Interval == 0 {
+		hc.Interval = 30
+	}
+	if hc.Timeout == 0 {
+		hc.Timeout = 5
+	}
+	if hc.Retries == 0 {
+		hc.Retries = 3
+	}
+	return hc
+}
+
+// probe runs one check against the container, reachable on addr from the host.
+func probe(hc HealthCheck, container, addr string) error {
+	hc = hc.withDefaults()
+	timeout := time.Duration(hc.Timeout) * time.Second
+
+	switch hc.Type {
+	case "http":
+		client := &http.Client{
+			Timeout: timeout,
+			// Report redirects as they are instead of following them
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+		resp, err := client.Get("http://" + addr + hc.Path)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != hc.ExpectedStatus {
+			return fmt.Errorf("GET %s returned %d, expected %d", hc.Path, resp.StatusCode, hc.ExpectedStatus)
+		}
+	case "tcp":
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	case "cmd":
+		code, out, err := system.Runtime.Exec(container, hc.Command, timeout)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return fmt.Errorf("command exited with %d: %s", code, strings.TrimSpace(out))
+		}
+	}
+	return nil
+}
+
+// HealthStatus is the current health of an app.
+type HealthStatus struct {
+	Status        string    `json:"status"`
+	Message       string    `json:"message,omitempty"`
+	FailingStreak int       `json:"failingStreak"`
+	CheckedAt     time.Time `json:"checkedAt"`
+
+	next time.Time // when the app is due for its next check
+}
+
+var (
+	healthMu    sync.Mutex
+	healthState = map[string]*HealthStatus{}
+)
+
+// StartHealthChecker checks the health of every app with a health check
+// configured, each at its own interval, until the process exits.
+func StartHealthChecker() {
+	go func() {
+		for range time.Tick(time.Second) {
+			runHealthChecks(time.Now(), false)
+		}
+	}()
+}
+
+// RunHealthChecks checks the health of every app with a health check
+// configured right away, regardless of its interval.
+func RunHealthChecks() {
+	runHealthChecks(time.Now(), true)
+}
+
+func runHealthChecks(now time.Time, all bool) {
+	metas, _ := listMetadata()
+	for _, meta := range metas {
+		if meta.HealthCheck == nil {
+			continue
+		}
+		sanitizedName := SanitizeAppName(meta.AppName)
+
+		healthMu.Lock()
+		st := healthState[sanitizedName]
+		due := all || st == nil || !now.Before(st.next)
+		healthMu.Unlock()
+		if due {
+			checkApp(sanitizedName, meta, now)
+		}
+	}
+}
+
+// checkApp probes one app and records the result.
+func checkApp(sanitizedName string, meta DeploymentMetadata, now time.Time) {
+	hc := meta.HealthCheck.withDefaults()
+	container := appContainerName(sanitizedName)
+
+	start := time.Now()
+	var err error
+	if c, inspectErr := system.Runtime.Inspect(container); inspectErr != nil {
+		err = inspectErr
+	} else if !c.Running {
+		err = fmt.Errorf("container is not running (%s)", c.Status)
+	} else {
+		err = probe(hc, container, appAddr(meta))
+	}
+	latency := time.Since(start)
+
+	healthMu.Lock()
+	st := healthState[sanitizedName]
+	if st == nil {
+		st = &HealthStatus{Status: HealthStarting}
+		healthState[sanitizedName] = st
+	}
+	st.CheckedAt = now
+	st.next = now.Add(time.Duration(hc.Interval) * time.Second)
+	if err == nil {
+		st.Status = HealthHealthy
+		st.Message = ""
+		st.FailingStreak = 0
+	} else {
+		st.Message = err.Error()
+		st.FailingStreak++
+		if st.FailingStreak >= hc.Retries {
+			st.Status = HealthUnhealthy
+		}
+	}
+	result := db.HealthCheckResult{
+		AppName:   sanitizedName,
+		Status:    st.Status,
+		OK:        err == nil,
+		Message:   st.Message,
+		LatencyMS: latency.Milliseconds(),
+		CheckedAt: now,
+	}
+	healthMu.Unlock()
+
+	if err := db.RecordHealthCheck(result); err != nil {
+		fmt.Printf("Failed to record health check for %s: %v\n", sanitizedName, err)
+	}
+}
+
+// appAddr returns the host address the app's container is reachable on.
+func appAddr(meta DeploymentMetadata) string {
+	if meta.Color != "" {
+		return fmt.Sprintf("127.0.0.1:%d", meta.InternalPort)
+	}
+	return fmt.Sprintf("127.0.0.1:%d", meta.Port)
+}
+
+// AppHealth returns the current health of an app, or nil if it has no
+// health check or has not been checked yet.
+func AppHealth(appName string) *HealthStatus {
+	sanitizedName := SanitizeAppName(appName)
+
+	healthMu.Lock()
+	st, ok := healthState[sanitizedName]
+	if ok {
+		copied := *st
+		healthMu.Unlock()
+		return &copied
+	}
+	healthMu.Unlock()
+
+	// Not checked since startup; fall back to the last recorded result
+	history, err := db.GetHealthHistory(sanitizedName, 1)
+	if err != nil || len(history) == 0 {
+		return nil
+	}
+	return &HealthStatus{Status: history[0].Status, Message: history[0].Message, CheckedAt: history[0].CheckedAt}
+}
+
+// HealthHistory returns the recent health check results of an app, newest first.
+func HealthHistory(appName string, limit int) ([]db.HealthCheckResult, error) {
+	return db.GetHealthHistory(SanitizeAppName(appName), limit)
+}
+
+// SetHealthCheck configures the health check of a deployed app. A nil check
+// disables health checking.
+func SetHealthCheck(appName string, hc *HealthCheck) error {
+	if hc != nil {
+		if err := hc.Validate(); err != nil {
+			return err
+		}
+	}
+	sanitizedName := SanitizeAppName(appName)
+	unlock, err := tryLockApp(sanitizedName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	meta, err := loadMetadata(sanitizedName)
+	if err != nil {
+		return err
+	}
+	meta.HealthCheck = hc
+	if err := saveMetadata(sanitizedName, meta); err != nil {
+		return err
+	}
+	forgetHealth(sanitizedName)
+	return nil
+}
+
+func forgetHealth(sanitizedName string) {
+	healthMu.Lock()
+	delete(healthState, sanitizedName)
+	healthMu.Unlock()
+}
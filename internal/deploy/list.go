@@ -1,72 +1,76 @@
 package deploy
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"regexp"
-	"strconv"
-	"strings"
+
+	"github.com/prashanta0234/vpsmyth/internal/system"
 )
 
-// ListApps returns a list of all deployed applications by inspecting Docker containers and metadata files.
+// StatusMissing is the status of a stored app whose container is gone.
+const StatusMissing = "missing"
+
+// ListApps returns every deployed app from the database, reconciled with the
+// containers managed by VPSMyth: stored apps get the ID and status of their
+// active container (StatusMissing without one), and managed containers
+// without a stored app are listed from their labels and ports.
 func ListApps() ([]DeploymentMetadata, error) {
 	// 1. Get all containers managed by VPSMyth
-	out, err := exec.Command("docker", "ps", "-a", "--filter", "label=managed-by=vpsmyth", "--format", "{{.Names}}|{{.ID}}|{{.Status}}|{{.Ports}}").Output()
+	containers, err := system.Runtime.List(system.ListOptions{All: true, Label: system.ManagedLabel})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list docker containers: %w", err)
 	}
+	byName := make(map[string]system.Container)
+	for _, c := range containers {
+		byName[c.Name] = c
+	}
 
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	// 2. Stored apps, with the state of their active container
+	metas, err := listMetadata()
+	if err != nil {
+		return nil, err
+	}
 	var apps []DeploymentMetadata
-	baseDir := "deployments"
+	known := make(map[string]bool)
+	for _, meta := range metas {
+		sanitizedName := SanitizeAppName(meta.AppName)
+		known[sanitizedName] = true
 
-	for _, line := range lines {
-		if line == "" {
-			continue
+		name := sanitizedName
+		if meta.Color != "" {
+			name = sanitizedName + "-" + meta.Color
 		}
-		parts := strings.Split(line, "|")
-		if len(parts) < 4 {
-			continue
+		if c, ok := byName[name]; ok {
+			meta.ContainerID = c.ID
+			meta.Status = c.Status
+		} else {
+			meta.ContainerID = ""
+			meta.Status = StatusMissing
 		}
-
-		containerName := parts[0]
-		containerID := parts[1]
-		status := parts[2]
-		portsStr := parts[3] // e.g., "0.0.0.0:3000->3000/tcp" or "3000/tcp"
-
-		// 2. Try to find metadata file
-		metaFile := filepath.Join(baseDir, containerName+".json")
-		var meta DeploymentMetadata
-		data, err := os.ReadFile(metaFile)
-		if err == nil {
-			// Metadata exists, use it
-			if err := json.Unmarshal(data, &meta); err != nil {
-				fmt.Printf("Warning: failed to parse metadata for %s: %v\n", containerName, err)
-			}
+		if meta.HealthCheck != nil {
+			meta.Health = AppHealth(sanitizedName)
 		}
+		apps = append(apps, meta)
+	}
 
-		// 3. Fill in missing info from Docker if metadata is missing or incomplete
-		if meta.AppName == "" {
-			meta.AppName = containerName // Fallback to container name
+	// 3. Managed containers of apps that are not stored
+	for _, c := range containers {
+		appName := c.Name
+		// Blue/green containers are named <app>-blue and <app>-green
+		if app := c.Labels[AppLabelKey]; app != "" {
+			appName = app
 		}
-		meta.ContainerID = containerID
-		meta.Status = status
+		if known[appName] {
+			continue
+		}
+		known[appName] = true
 
-		// Parse port from Docker ports string if missing from metadata
-		if meta.Port == 0 && portsStr != "" {
-			// Example portsStr: "0.0.0.0:3000->3000/tcp"
-			// We want the host port (3000)
-			re := regexp.MustCompile(`:(\d+)->`)
-			match := re.FindStringSubmatch(portsStr)
-			if len(match) > 1 {
-				p, _ := strconv.Atoi(match[1])
-				meta.Port = p
+		meta := DeploymentMetadata{AppName: appName, ContainerID: c.ID, Status: c.Status}
+		for _, p := range c.PortBindings {
+			if p.HostPort != 0 {
+				meta.Port = p.HostPort
+				break
 			}
 		}
-
 		apps = append(apps, meta)
 	}
 
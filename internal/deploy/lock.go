@@ -0,0 +1,103 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/prashanta0234/vpsmyth/internal/config"
+)
+
+// ErrAppBusy is returned by operations on an app while a deployment or
+// another operation holds the app's lock.
+var ErrAppBusy = errors.New("another operation on this app is in progress")
+
+var (
+	appLocksMu sync.Mutex
+	appLocks   = map[string]chan struct{}{}
+)
+
+// appLock returns the lock of an app: a channel holding a value while the
+// lock is taken.
+func appLock(sanitizedName string) chan struct{} {
+	appLocksMu.Lock()
+	defer appLocksMu.Unlock()
+	l, ok := appLocks[sanitizedName]
+	if !ok {
+		l = make(chan struct{}, 1)
+		appLocks[sanitizedName] = l
+	}
+	return l
+}
+
+// lockApp takes the lock of an app for a deployment, waiting for the
+// operation holding it to finish or for ctx to end.
+func lockApp(ctx context.Context, sanitizedName string, out io.Writer) (unlock func(), err error) {
+	l := appLock(sanitizedName)
+	select {
+	case l <- struct{}{}:
+		return func() { <-l }, nil
+	default:
+	}
+	fmt.Fprintf(out, "Waiting for another operation on %s to finish\n", sanitizedName)
+	select {
+	case l <- struct{}{}:
+		return func() { <-l }, nil
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+// tryLockApp takes the lock of an app for a short operation such as start,
+// stop or an env update, returning ErrAppBusy when it is held.
+func tryLockApp(sanitizedName string) (unlock func(), err error) {
+	l := appLock(sanitizedName)
+	select {
+	case l <- struct{}{}:
+		return func() { <-l }, nil
+	default:
+		return nil, ErrAppBusy
+	}
+}
+
+var (
+	buildsMu     sync.Mutex
+	buildsActive int
+	buildFreed   = make(chan struct{}) // closed and replaced when a build ends
+)
+
+// acquireBuildSlot waits until fewer than VPSMYTH_MAX_BUILDS (default 1)
+// images are being built, or for ctx to end. The returned func frees the slot.
+func acquireBuildSlot(ctx context.Context, out io.Writer) (release func(), err error) {
+	waiting := false
+	for {
+		buildsMu.Lock()
+		if buildsActive < max(config.EnvInt("VPSMYTH_MAX_BUILDS", 1), 1) {
+			buildsActive++
+			buildsMu.Unlock()
+			return releaseBuildSlot, nil
+		}
+		freed := buildFreed
+		buildsMu.Unlock()
+
+		if !waiting {
+			fmt.Fprintln(out, "Waiting for a build slot")
+			waiting = true
+		}
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+	}
+}
+
+func releaseBuildSlot() {
+	buildsMu.Lock()
+	defer buildsMu.Unlock()
+	buildsActive--
+	close(buildFreed)
+	buildFreed = make(chan struct{})
+}
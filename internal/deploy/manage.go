@@ -1,128 +1,132 @@
 package deploy
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/redact"
+	"github.com/prashanta0234/vpsmyth/internal/system"
 )
 
 // StopApp stops the Docker container for the given app.
 func StopApp(appName string) error {
-	sanitizedName := sanitizeAppName(appName)
-	cmd := exec.Command("docker", "stop", sanitizedName)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to stop container: %w", err)
+	sanitizedName := SanitizeAppName(appName)
+	unlock, err := tryLockApp(sanitizedName)
+	if err != nil {
+		return err
 	}
-	return nil
+	defer unlock()
+	return system.Runtime.Stop(appContainerName(sanitizedName))
 }
 
 // StartApp starts the Docker container for the given app.
 func StartApp(appName string) error {
-	sanitizedName := sanitizeAppName(appName)
-	cmd := exec.Command("docker", "start", sanitizedName)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to start container: %w", err)
+	sanitizedName := SanitizeAppName(appName)
+	unlock, err := tryLockApp(sanitizedName)
+	if err != nil {
+		return err
 	}
-	return nil
+	defer unlock()
+	return system.Runtime.Start(appContainerName(sanitizedName))
 }
 
 // RestartApp restarts the Docker container for the given app.
 func RestartApp(appName string) error {
-	sanitizedName := sanitizeAppName(appName)
-	cmd := exec.Command("docker", "restart", sanitizedName)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to restart container: %w", err)
+	sanitizedName := SanitizeAppName(appName)
+	unlock, err := tryLockApp(sanitizedName)
+	if err != nil {
+		return err
 	}
-	return nil
+	defer unlock()
+	return system.Runtime.Restart(appContainerName(sanitizedName))
 }
 
 // DeleteApp stops, removes the container, and deletes the app's metadata and files.
 func DeleteApp(appName string) error {
-	sanitizedName := sanitizeAppName(appName)
+	sanitizedName := SanitizeAppName(appName)
+	unlock, err := tryLockApp(sanitizedName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	// 1. Stop and remove container
-	exec.Command("docker", "stop", sanitizedName).Run()
-	exec.Command("docker", "rm", sanitizedName).Run()
+	// 1. Stop and remove containers, and the proxy of a blue/green app
+	if meta, err := loadMetadata(sanitizedName); err == nil && meta.Color != "" {
+		retireBlueGreen(sanitizedName, meta)
+	}
+	system.Runtime.Remove(sanitizedName, true)
 
-	// 2. Remove metadata file
+	// 2. Remove the stored app, with its env vars and domains
 	baseDir := "deployments"
-	metaFile := filepath.Join(baseDir, sanitizedName+".json")
-	os.Remove(metaFile)
+	db.DeleteApp(sanitizedName)
 
 	// 3. Remove app directory
 	appDir := filepath.Join(baseDir, sanitizedName)
 	os.RemoveAll(appDir)
 
+	// 4. Forget the release and health check history and the push webhook
+	db.DeleteReleases(sanitizedName)
+	db.DeleteHealthHistory(sanitizedName)
+	db.DeleteWebhook(sanitizedName)
+	db.ReleasePort(sanitizedName)
+	db.DeleteAppSecrets(sanitizedName)
+	forgetHealth(sanitizedName)
+
 	return nil
 }
 
-// GetLogs returns the last 100 lines of logs for the given app.
+// GetLogs returns the last 100 lines of logs for the given app, with secret
+// values masked.
 func GetLogs(appName string) (string, error) {
-	sanitizedName := sanitizeAppName(appName)
-	out, err := exec.Command("docker", "logs", "--tail", "100", sanitizedName).CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("failed to get logs: %w", err)
-	}
-	return string(out), nil
+	sanitizedName := SanitizeAppName(appName)
+	logs, err := system.Runtime.Logs(appContainerName(sanitizedName), 100)
+	return redact.String(logs), err
 }
 
 // UpdateAppEnv updates the environment variables for an app and restarts it.
+// Values equal to redact.Mask keep their current value.
 func UpdateAppEnv(appName string, newEnv map[string]string) error {
-	sanitizedName := sanitizeAppName(appName)
-	baseDir := "deployments"
-	metaFile := filepath.Join(baseDir, sanitizedName+".json")
-
-	// 1. Load existing metadata
-	data, err := os.ReadFile(metaFile)
+	sanitizedName := SanitizeAppName(appName)
+	unlock, err := tryLockApp(sanitizedName)
 	if err != nil {
-		return fmt.Errorf("failed to read metadata: %w", err)
-	}
-
-	var meta DeploymentMetadata
-	if err := json.Unmarshal(data, &meta); err != nil {
-		return fmt.Errorf("failed to parse metadata: %w", err)
+		return err
 	}
+	defer unlock()
 
-	// 2. Update env
-	meta.Env = newEnv
-
-	// 3. Save metadata
-	metaData, err := json.MarshalIndent(meta, "", "  ")
+	// 1. Load existing metadata
+	meta, err := loadMetadata(sanitizedName)
 	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %w", err)
+		return err
 	}
-	if err := os.WriteFile(metaFile, metaData, 0644); err != nil {
-		return fmt.Errorf("failed to save metadata: %w", err)
-	}
-
-	// 4. Restart container with new env
-	// We need the image tag. We can infer it from the sanitized name.
-	imageTag := fmt.Sprintf("vpsmyth/%s:latest", sanitizedName)
 
-	// Stop and remove existing container
-	exec.Command("docker", "stop", sanitizedName).Run()
-	exec.Command("docker", "rm", sanitizedName).Run()
+	newEnv = unmaskEnv(newEnv, meta.Env)
 
-	// Run new container
-	runArgs := []string{"run", "-d", "--name", sanitizedName, "--label", "managed-by=vpsmyth", "-p", fmt.Sprintf("%d:%d", meta.Port, meta.Port), "--restart", "always"}
-	for k, v := range newEnv {
-		runArgs = append(runArgs, "-e", fmt.Sprintf("%s=%s", k, v))
+	// 2. Restart container with new env, using the image of the current release.
+	// Apps deployed before releases were recorded only have the :latest tag.
+	imageTag := meta.Image
+	if imageTag == "" {
+		imageTag = fmt.Sprintf("vpsmyth/%s:latest", sanitizedName)
 	}
-	runArgs = append(runArgs, "-e", fmt.Sprintf("PORT=%d", meta.Port))
-	runArgs = append(runArgs, imageTag)
 
-	runCmd := exec.Command("docker", runArgs...)
-	output, err := runCmd.CombinedOutput()
+	runEnv, err := appEnv(sanitizedName, meta.SecretGroups, runtimeEnv(newEnv, meta.EnvOptions))
+	if err != nil {
+		return err
+	}
+	inst, err := startApp(context.Background(), sanitizedName, meta.Strategy, meta.HealthCheck, meta.Container, imageTag, meta.Port, runEnv, stdoutReporter{})
 	if err != nil {
-		return fmt.Errorf("failed to run Docker container: %s: %w", string(output), err)
+		return fmt.Errorf("failed to run Docker container: %w", err)
 	}
 
-	// Update container ID in metadata
-	meta.ContainerID = string(output[:12])
-	metaData, _ = json.MarshalIndent(meta, "", "  ")
-	os.WriteFile(metaFile, metaData, 0644)
+	// 3. Save the new env and container in metadata
+	meta.Env = newEnv
+	inst.apply(&meta)
+	return saveMetadata(sanitizedName, meta)
+}
 
-	return nil
+// GetApp returns the stored metadata of a deployed app.
+func GetApp(appName string) (DeploymentMetadata, error) {
+	return loadMetadata(SanitizeAppName(appName))
 }
@@ -0,0 +1,291 @@
+package deploy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prashanta0234/vpsmyth/internal/system"
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestFile is the deployment manifest read from the root directory of
+// an app's sources.
+const ManifestFile = ".vpsmyth.yml"
+
+// Manifest holds the settings an app declares in its .vpsmyth.yml. They take
+// precedence over the values of the deploy request; settings the manifest
+// leaves out keep the request's values, then the detected defaults.
+type Manifest struct {
+	Framework    string       `yaml:"framework"`
+	BuildCommand string       `yaml:"buildCommand"`
+	StartCommand string       `yaml:"startCommand"`
+	Port         int          `yaml:"port"`
+	HealthCheck  *HealthCheck `yaml:"healthCheck"`
+	Env          struct {
+		Required []string `yaml:"required"` // names of variables the app needs; values stay in the dashboard
+	} `yaml:"env"`
+	Cron      []CronJob      `yaml:"cron"`
+	Volumes   []VolumeMount  `yaml:"volumes"`
+	Resources ResourceLimits `yaml:"resources"`
+}
+
+// CronJob is a command run in the app's container on a schedule.
+type CronJob struct {
+	Name     string `json:"name" yaml:"name"`
+	Schedule string `json:"schedule" yaml:"schedule"` // five-field cron expression or @hourly, @daily, ...
+	Command  string `json:"command" yaml:"command"`
+}
+
+// VolumeMount mounts a named volume of the app at Path in its containers.
+// The Docker volume is vpsmyth-<app>-<name>, so data outlives redeploys.
+type VolumeMount struct {
+	Name string `json:"name" yaml:"name"`
+	Path string `json:"path" yaml:"path"`
+}
+
+// ResourceLimits bound the memory and CPU of an app's containers.
+type ResourceLimits struct {
+	Memory string  `json:"memory,omitempty" yaml:"memory"` // bytes with an optional k, m or g suffix, e.g. "512m"
+	CPUs   float64 `json:"cpus,omitempty" yaml:"cpus"`
+}
+
+// ContainerSettings are the volumes and resource limits an app's containers
+// run with.
+type ContainerSettings struct {
+	Volumes   []VolumeMount  `json:"volumes,omitempty"`
+	Resources ResourceLimits `json:"resources"`
+}
+
+var (
+	envNamePattern    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	volumeNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+	memoryPattern     = regexp.MustCompile(`^(\d+)([kmg]?)b?$`)
+	cronFieldPattern  = regexp.MustCompile(`^[0-9A-Za-z*/,-]+$`)
+	cronMacros        = map[string]bool{"@yearly": true, "@annually": true, "@monthly": true, "@weekly": true, "@daily": true, "@midnight": true, "@hourly": true}
+)
+
+// loadManifest reads the manifest in dir. It returns nil without error when
+// there is none.
+func loadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ManifestFile, err)
+	}
+	m, err := ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+	}
+	return m, nil
+}
+
+// ParseManifest decodes and validates a manifest. Unknown keys are errors, so
+// that typos do not silently fall back to defaults.
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil && err != io.EOF {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			return nil, errors.New(strings.Join(typeErr.Errors, "; "))
+		}
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Validate reports every problem of the manifest in one error.
+func (m *Manifest) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if m.Framework != "" && !templateNamePattern.MatchString(m.Framework) {
+		add("framework: invalid name %q", m.Framework)
+	}
+	if err := (BuildSettings{BuildCommand: m.BuildCommand, StartCommand: m.StartCommand}).Validate(); err != nil {
+		add("%v", err)
+	}
+	if m.Port < 0 || m.Port > 65535 {
+		add("port: must be between 1 and 65535, got %d", m.Port)
+	}
+	if m.HealthCheck != nil {
+		if err := m.HealthCheck.Validate(); err != nil {
+			add("healthCheck: %v", err)
+		}
+	}
+	for _, name := range m.Env.Required {
+		if !envNamePattern.MatchString(name) {
+			add("env.required: invalid variable name %q", name)
+		}
+	}
+
+	cronNames := map[string]bool{}
+	for i, job := range m.Cron {
+		switch {
+		case job.Name == "":
+			add("cron[%d]: name is required", i)
+		case cronNames[job.Name]:
+			add("cron[%d]: duplicate name %q", i, job.Name)
+		}
+		cronNames[job.Name] = true
+		if err := validCronSchedule(job.Schedule); err != nil {
+			add("cron[%d].schedule: %v", i, err)
+		}
+		if strings.TrimSpace(job.Command) == "" || strings.ContainsAny(job.Command, "\r\n") {
+			add("cron[%d].command: must be a single non-empty line", i)
+		}
+	}
+
+	volumeNames, volumePaths := map[string]bool{}, map[string]bool{}
+	for i, v := range m.Volumes {
+		if !volumeNamePattern.MatchString(v.Name) {
+			add("volumes[%d].name: invalid name %q (lowercase letters, digits, '.', '_' and '-')", i, v.Name)
+		} else if volumeNames[v.Name] {
+			add("volumes[%d].name: duplicate name %q", i, v.Name)
+		}
+		volumeNames[v.Name] = true
+		if !path.IsAbs(v.Path) || path.Clean(v.Path) == "/" || strings.ContainsAny(v.Path, ":,") {
+			add("volumes[%d].path: must be an absolute directory in the container, got %q", i, v.Path)
+		} else if volumePaths[path.Clean(v.Path)] {
+			add("volumes[%d].path: %s is mounted twice", i, v.Path)
+		}
+		volumePaths[path.Clean(v.Path)] = true
+	}
+
+	if _, err := parseMemory(m.Resources.Memory); err != nil {
+		add("resources.memory: %v", err)
+	}
+	if m.Resources.CPUs < 0 {
+		add("resources.cpus: must be positive, got %g", m.Resources.CPUs)
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validCronSchedule checks the shape of a cron schedule: a macro, or five
+// fields of numbers, names, ranges, steps and lists.
+func validCronSchedule(schedule string) error {
+	if cronMacros[schedule] {
+		return nil
+	}
+	fields := strings.Fields(schedule)
+	if len(fields) != 5 {
+		return fmt.Errorf("expected 5 fields or a macro like @daily, got %q", schedule)
+	}
+	for _, f := range fields {
+		if !cronFieldPattern.MatchString(f) {
+			return fmt.Errorf("invalid field %q", f)
+		}
+	}
+	return nil
+}
+
+// parseMemory converts a memory limit like "512m" to bytes; empty is 0, no limit.
+func parseMemory(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	m := memoryPattern.FindStringSubmatch(strings.ToLower(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q, use bytes or a k, m or g suffix", s)
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	switch m[2] {
+	case "k":
+		n <<= 10
+	case "m":
+		n <<= 20
+	case "g":
+		n <<= 30
+	}
+	if n < 6<<20 {
+		return 0, fmt.Errorf("%s is below the 6m minimum of Docker", s)
+	}
+	return n, nil
+}
+
+// apply merges the manifest into spec: every setting the manifest declares
+// replaces the request's value.
+func (m *Manifest) apply(spec Spec) Spec {
+	if m.Framework != "" {
+		spec.Framework = m.Framework
+	}
+	if m.BuildCommand != "" {
+		spec.Build.BuildCommand = m.BuildCommand
+	}
+	if m.StartCommand != "" {
+		spec.Build.StartCommand = m.StartCommand
+	}
+	if m.Port != 0 {
+		spec.Port = m.Port
+	}
+	if m.HealthCheck != nil {
+		spec.HealthCheck = m.HealthCheck
+	}
+	// The manifest owns volumes and limits: leaving them out removes them
+	spec.Container = &ContainerSettings{Volumes: m.Volumes, Resources: m.Resources}
+	return spec
+}
+
+// applyManifest merges the manifest in the root directory of the sources
+// in repoDir into spec. The manifest is nil when there is none.
+func applyManifest(spec Spec, repoDir string) (Spec, *Manifest, error) {
+	m, err := loadManifest(filepath.Join(repoDir, cleanRel(spec.Build.RootDir)))
+	if err != nil || m == nil {
+		return spec, nil, err
+	}
+	return m.apply(spec), m, nil
+}
+
+// missingEnv returns the required variables that are not set in env, the
+// app's variables with its secrets.
+func (m *Manifest) missingEnv(env map[string]string) []string {
+	var missing []string
+	for _, name := range m.Env.Required {
+		if _, ok := env[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// volumeName returns the Docker volume backing an app volume.
+func volumeName(sanitizedName, name string) string {
+	return "vpsmyth-" + sanitizedName + "-" + name
+}
+
+// applyTo sets the volumes and limits of the app's container options.
+func (c *ContainerSettings) applyTo(sanitizedName string, opts *system.RunOptions) {
+	if c == nil {
+		return
+	}
+	for _, v := range c.Volumes {
+		opts.Volumes = append(opts.Volumes, system.Volume{Source: volumeName(sanitizedName, v.Name), Target: v.Path})
+	}
+	// Validated with the manifest
+	opts.Memory, _ = parseMemory(c.Resources.Memory)
+	opts.CPUs = c.Resources.CPUs
+}
@@ -0,0 +1,132 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// nodeLockfiles maps lockfiles to the package manager that wrote them, in
+// the order they are looked for.
+var nodeLockfiles = []struct{ file, manager string }{
+	{"pnpm-lock.yaml", "pnpm"},
+	{"yarn.lock", "yarn"},
+	{"bun.lockb", "bun"},
+	{"bun.lock", "bun"},
+	{"package-lock.json", "npm"},
+	{"npm-shrinkwrap.json", "npm"},
+}
+
+var (
+	packageManagerPattern = regexp.MustCompile(`^(npm|pnpm|yarn|bun)(?:@((\d+)[\w.-]*))?`)
+	engineRangePattern    = regexp.MustCompile(`^(>=|\^|~|=|v)?\s*v?(\d+)(?:\.(\d+|x|\*))?`)
+)
+
+// nodeParams fills in the package manager and Node.js version of the Node
+// templates. The "packageManager" field of package.json wins over the
+// lockfile; installs are frozen to the lockfile when there is one.
+func nodeParams(p *TemplateParams, repoDir string, pkg nodePackage) {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(repoDir, name))
+		return err == nil
+	}
+
+	manager, version, major, lockfile := "npm", "", "", ""
+	for _, l := range nodeLockfiles {
+		if exists(l.file) {
+			manager, lockfile = l.manager, l.file
+			break
+		}
+	}
+	if m := packageManagerPattern.FindStringSubmatch(pkg.PackageManager); m != nil {
+		manager, version, major = m[1], m[2], m[3]
+		lockfile = ""
+		for _, l := range nodeLockfiles {
+			if l.manager == manager && exists(l.file) {
+				lockfile = l.file
+				break
+			}
+		}
+	}
+
+	p.PackageManager = manager
+	p.ManifestFiles = []string{"package.json"}
+	if lockfile != "" {
+		p.ManifestFiles = append(p.ManifestFiles, lockfile)
+	}
+	frozen := lockfile != ""
+	switch manager {
+	case "npm":
+		p.InstallCommand = "npm install"
+		if frozen {
+			p.InstallCommand = "npm ci"
+		}
+	case "pnpm":
+		p.NodeSetup = "npm install -g pnpm@" + orLatest(version)
+		p.InstallCommand = "pnpm install"
+		if frozen {
+			p.InstallCommand += " --frozen-lockfile"
+		}
+	case "yarn":
+		// Yarn 1 ships with the node images; Yarn 2+ (berry) is configured by
+		// .yarnrc.yml, installed through corepack and replaced --frozen-lockfile
+		p.InstallCommand = "yarn install"
+		berry := exists(".yarnrc.yml") || (major != "" && major != "1")
+		if berry {
+			// --force replaces the bundled yarn 1 binary
+			p.NodeSetup = "npm install -g corepack@latest --force && corepack enable"
+		}
+		if exists(".yarnrc.yml") {
+			p.ManifestFiles = append(p.ManifestFiles, ".yarnrc.yml")
+		}
+		if exists(".yarn") {
+			p.ManifestDirs = append(p.ManifestDirs, ".yarn")
+		}
+		if frozen && berry {
+			p.InstallCommand += " --immutable"
+		} else if frozen {
+			p.InstallCommand += " --frozen-lockfile"
+		}
+	case "bun":
+		p.NodeSetup = "npm install -g bun@" + orLatest(version)
+		p.InstallCommand = "bun install"
+		if frozen {
+			p.InstallCommand += " --frozen-lockfile"
+		}
+	}
+
+	if version := nodeVersion(pkg.Engines["node"]); version != "" {
+		p.NodeVersion = version
+	}
+}
+
+func orLatest(version string) string {
+	if version == "" {
+		return "latest"
+	}
+	return version
+}
+
+// nodeRun returns the command running a package.json script.
+func nodeRun(manager, script string) string {
+	if manager == "npm" && script == "start" {
+		return "npm start"
+	}
+	return manager + " run " + script
+}
+
+// nodeVersion picks the node image version for an engines.node range: the
+// major version of the last alternative (major.minor for ~ ranges). Ranges
+// with only an upper bound, and anything unparsable, return "".
+func nodeVersion(engines string) string {
+	alternatives := strings.Split(engines, "||")
+	m := engineRangePattern.FindStringSubmatch(strings.TrimSpace(alternatives[len(alternatives)-1]))
+	if m == nil {
+		return ""
+	}
+	if m[1] == "~" && m[3] != "" && m[3] != "x" && m[3] != "*" {
+		return m[2] + "." + m[3]
+	}
+	return m[2]
+}
@@ -0,0 +1,175 @@
+package deploy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prashanta0234/vpsmyth/internal/config"
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/system"
+)
+
+// PortConflictError is returned by AllocatePort for a port that another app
+// has reserved or that is bound on the host.
+type PortConflictError struct {
+	Port  int
+	Owner string // e.g. "app api", "container redis"
+}
+
+func (e *PortConflictError) Error() string {
+	return fmt.Sprintf("port %d is already in use by %s", e.Port, e.Owner)
+}
+
+// AllocatePort reserves the host port of an app. A port of 0 keeps the
+// app's reservation or picks a free port from VPSMYTH_PORT_RANGE (default
+// 3000-3999). A requested port must be neither reserved by another app nor
+// bound on the host.
+func AllocatePort(appName string, port int) (int, error) {
+	sanitizedName := SanitizeAppName(appName)
+	reserved, err := db.GetAppPort(sanitizedName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load port reservation: %w", err)
+	}
+	if port == 0 && reserved != 0 {
+		return reserved, nil
+	}
+	if port == 0 {
+		return pickPort(sanitizedName)
+	}
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %d", port)
+	}
+
+	if port != reserved {
+		reservations, err := db.ListPortReservations()
+		if err != nil {
+			return 0, fmt.Errorf("failed to load port reservations: %w", err)
+		}
+		if owner, ok := reservations[port]; ok {
+			return 0, &PortConflictError{Port: port, Owner: "app " + owner}
+		}
+		// The app's own container holds its reserved port
+		if owner := hostPortOwner(publishedPorts(sanitizedName), port); owner != "" {
+			return 0, &PortConflictError{Port: port, Owner: owner}
+		}
+	}
+	return reservePort(sanitizedName, port)
+}
+
+// ReservedPort returns the port reserved by an app, or 0 if it has none.
+func ReservedPort(appName string) (int, error) {
+	return db.GetAppPort(SanitizeAppName(appName))
+}
+
+// RestorePort undoes an AllocatePort whose deploy did not start: the app
+// gets back the reservation ReservedPort returned before, or none for 0.
+func RestorePort(appName string, previous int) error {
+	sanitizedName := SanitizeAppName(appName)
+	if previous == 0 {
+		return db.ReleasePort(sanitizedName)
+	}
+	_, err := reservePort(sanitizedName, previous)
+	return err
+}
+
+// pickPort reserves the first port of the configured range that is neither
+// reserved nor bound on the host.
+func pickPort(sanitizedName string) (int, error) {
+	first, last, err := portRange()
+	if err != nil {
+		return 0, err
+	}
+	reservations, err := db.ListPortReservations()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load port reservations: %w", err)
+	}
+	published := publishedPorts(sanitizedName)
+	for port := first; port <= last; port++ {
+		if _, ok := reservations[port]; ok || hostPortOwner(published, port) != "" {
+			continue
+		}
+		if _, err := reservePort(sanitizedName, port); err == nil {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free port in range %d-%d", first, last)
+}
+
+func reservePort(sanitizedName string, port int) (int, error) {
+	owner, err := db.ReservePort(sanitizedName, port)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve port: %w", err)
+	}
+	if owner != sanitizedName {
+		return 0, &PortConflictError{Port: port, Owner: "app " + owner}
+	}
+	return port, nil
+}
+
+// portRange parses VPSMYTH_PORT_RANGE, "first-last".
+func portRange() (int, int, error) {
+	value := config.EnvString("VPSMYTH_PORT_RANGE", "3000-3999")
+	from, to, ok := strings.Cut(value, "-")
+	first, err1 := strconv.Atoi(strings.TrimSpace(from))
+	last, err2 := strconv.Atoi(strings.TrimSpace(to))
+	if !ok || err1 != nil || err2 != nil || first < 1 || last > 65535 || first > last {
+		return 0, 0, fmt.Errorf("invalid VPSMYTH_PORT_RANGE %q", value)
+	}
+	return first, last, nil
+}
+
+// publishedPorts maps the host ports published by containers to the
+// container names, ignoring the app's own containers.
+func publishedPorts(sanitizedName string) map[int]string {
+	ports := map[int]string{}
+	containers, err := system.Runtime.List(system.ListOptions{All: true})
+	if err != nil {
+		return ports
+	}
+	for _, c := range containers {
+		if c.Name == sanitizedName || c.Labels[AppLabelKey] == sanitizedName {
+			continue
+		}
+		for _, b := range c.PortBindings {
+			ports[b.HostPort] = c.Name
+		}
+	}
+	return ports
+}
+
+// hostPortOwner describes what holds a host port: a container publishing
+// it, per publishedPorts, or another process listening on it. It returns ""
+// for a free port.
+func hostPortOwner(published map[int]string, port int) string {
+	if name, ok := published[port]; ok {
+		return "container " + name
+	}
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return "another process on the host"
+	}
+	l.Close()
+	return ""
+}
+
+// ReservePorts reserves the ports of apps deployed before ports were
+// reserved. Apps sharing a port keep running; only the first one gets the
+// reservation.
+func ReservePorts() {
+	metas, _ := listMetadata()
+	for _, meta := range metas {
+		if meta.Port == 0 {
+			continue
+		}
+		sanitizedName := SanitizeAppName(meta.AppName)
+		if reserved, err := db.GetAppPort(sanitizedName); err != nil || reserved != 0 {
+			continue
+		}
+		if _, err := reservePort(sanitizedName, meta.Port); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to reserve port of %s: %v\n", meta.AppName, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// pythonManifests are the files that mark a Python project, in the order
+// their dependencies are installed from.
+var pythonManifests = []string{"requirements.txt", "Pipfile", "pyproject.toml"}
+
+// detectPython returns the Python framework listed in the project's
+// dependencies: "django", "fastapi", "flask" or plain "python".
+func detectPython(repoDir string) string {
+	var deps strings.Builder
+	for _, name := range pythonManifests {
+		data, _ := os.ReadFile(filepath.Join(repoDir, name))
+		deps.WriteString(strings.ToLower(string(data)))
+	}
+	switch {
+	case strings.Contains(deps.String(), "django"):
+		return "django"
+	case strings.Contains(deps.String(), "fastapi"):
+		return "fastapi"
+	case strings.Contains(deps.String(), "flask"):
+		return "flask"
+	}
+	return "python"
+}
+
+// pythonVersion returns the major.minor version from .python-version or
+// runtime.txt, defaulting to 3.12.
+func pythonVersion(repoDir string) string {
+	for _, name := range []string{".python-version", "runtime.txt"} {
+		data, err := os.ReadFile(filepath.Join(repoDir, name))
+		if err != nil {
+			continue
+		}
+		if m := regexp.MustCompile(`(\d+)\.(\d+)`).FindStringSubmatch(string(data)); m != nil {
+			return m[1] + "." + m[2]
+		}
+	}
+	return "3.12"
+}
+
+// findAppObject looks for "<name> = <constructor>(" or a create_app factory
+// in the candidate files and returns the application as "module:object".
+func findAppObject(repoDir string, candidates []string, constructor string) (string, bool) {
+	assign := regexp.MustCompile(`(?m)^(\w+)\s*=\s*` + regexp.QuoteMeta(constructor) + `\(`)
+	for _, file := range candidates {
+		data, err := os.ReadFile(filepath.Join(repoDir, file))
+		if err != nil {
+			continue
+		}
+		module := strings.ReplaceAll(strings.TrimSuffix(file, ".py"), "/", ".")
+		if m := assign.FindSubmatch(data); m != nil {
+			return module + ":" + string(m[1]), true
+		}
+		if strings.Contains(string(data), "def create_app(") {
+			return module + ":create_app()", true
+		}
+	}
+	return "", false
+}
+
+// djangoWSGIModule returns the WSGI application of the Django project,
+// found by its <project>/wsgi.py file.
+func djangoWSGIModule(repoDir string) string {
+	matches, _ := filepath.Glob(filepath.Join(repoDir, "*", "wsgi.py"))
+	sort.Strings(matches)
+	if len(matches) == 0 {
+		return "wsgi:application"
+	}
+	return filepath.Base(filepath.Dir(matches[0])) + ".wsgi:application"
+}
+
+// pythonParams fills in the parameters of the python template: Django and
+// Flask are served with gunicorn, FastAPI with uvicorn, anything else with
+// python main.py (or app.py).
+func pythonParams(p *TemplateParams, repoDir, framework string) {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(repoDir, name))
+		return err == nil
+	}
+	candidates := []string{"main.py", "app.py", "wsgi.py", "asgi.py", "server.py", "application.py", "app/main.py", "src/main.py"}
+
+	p.Version = pythonVersion(repoDir)
+	switch {
+	case exists("requirements.txt"):
+		p.PythonDeps = "requirements"
+	case exists("Pipfile"):
+		p.PythonDeps = "pipfile"
+		p.PipfileLock = exists("Pipfile.lock")
+	default:
+		p.PythonDeps = "pyproject"
+	}
+
+	switch framework {
+	case "django":
+		p.Server = "gunicorn"
+		p.CollectStatic = exists("manage.py")
+		p.StartCommand = "gunicorn " + djangoWSGIModule(repoDir) + " --bind 0.0.0.0:${PORT} --workers 2"
+	case "flask":
+		p.Server = "gunicorn"
+		app, ok := findAppObject(repoDir, candidates, "Flask")
+		if !ok {
+			app = "app:app"
+		}
+		p.StartCommand = "gunicorn '" + app + "' --bind 0.0.0.0:${PORT} --workers 2"
+	case "fastapi":
+		p.Server = "uvicorn"
+		app, ok := findAppObject(repoDir, candidates, "FastAPI")
+		if !ok {
+			app = "main:app"
+		}
+		p.StartCommand = "uvicorn '" + app + "' --host 0.0.0.0 --port ${PORT}"
+	default:
+		script := "main.py"
+		if !exists(script) && exists("app.py") {
+			script = "app.py"
+		}
+		p.StartCommand = "python " + script
+	}
+}
@@ -0,0 +1,124 @@
+package deploy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/system"
+)
+
+// Release statuses.
+const (
+	ReleasePending   = "pending"
+	ReleaseSucceeded = "succeeded"
+	ReleaseFailed    = "failed"
+)
+
+// releaseImage returns the image tag of a numbered release, e.g. vpsmyth/app:r42.
+func releaseImage(sanitizedName string, number int) string {
+	return fmt.Sprintf("vpsmyth/%s:r%d", sanitizedName, number)
+}
+
+// imageDigest returns the content digest of a local image, or "" if it cannot be inspected.
+func imageDigest(ref string) string {
+	img, err := system.Runtime.InspectImage(ref)
+	if err != nil {
+		return ""
+	}
+	if len(img.RepoDigests) > 0 {
+		if _, digest, ok := strings.Cut(img.RepoDigests[0], "@"); ok {
+			return digest
+		}
+	}
+	return img.ID
+}
+
+func failRelease(sanitizedName string, number int, image, commitSHA string) {
+	db.UpdateRelease(sanitizedName, number, ReleaseFailed, image, "", commitSHA)
+}
+
+// discardRelease marks a release failed like failRelease and, when the
+// deploy was interrupted, removes the image it may have left behind.
+func discardRelease(sanitizedName string, number int, image, commitSHA string, interrupted bool) {
+	failRelease(sanitizedName, number, image, commitSHA)
+	if interrupted {
+		system.Runtime.RemoveImage(image)
+	}
+}
+
+// ListReleases returns the release history of an app, newest first.
+func ListReleases(appName string) ([]db.Release, error) {
+	return db.ListReleases(SanitizeAppName(appName))
+}
+
+// Rollback runs the image and environment of an earlier successful release
+// again, without rebuilding. The rollback is recorded as a new release,
+// whose number is returned.
+func Rollback(appName string, number int) (int, error) {
+	sanitizedName := SanitizeAppName(appName)
+	unlock, err := tryLockApp(sanitizedName)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	rel, err := db.GetRelease(sanitizedName, number)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("release r%d of %s not found", number, appName)
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to load release: %w", err)
+	}
+	if rel.Status != ReleaseSucceeded {
+		return 0, fmt.Errorf("release r%d did not deploy successfully (status: %s)", number, rel.Status)
+	}
+	if _, err := system.Runtime.InspectImage(rel.Image); err != nil {
+		return 0, fmt.Errorf("image %s of release r%d is no longer available: %w", rel.Image, number, err)
+	}
+
+	meta, err := loadMetadata(sanitizedName)
+	if err != nil {
+		return 0, err
+	}
+
+	runEnv, err := appEnv(sanitizedName, meta.SecretGroups, runtimeEnv(rel.Env, meta.EnvOptions))
+	if err != nil {
+		return 0, err
+	}
+	inst, err := startApp(context.Background(), sanitizedName, meta.Strategy, meta.HealthCheck, meta.Container, rel.Image, meta.Port, runEnv, stdoutReporter{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to run Docker container: %w", err)
+	}
+
+	newNumber, err := db.CreateRelease(db.Release{
+		AppName:     sanitizedName,
+		Status:      ReleaseSucceeded,
+		CommitSHA:   rel.CommitSHA,
+		Image:       rel.Image,
+		ImageDigest: rel.ImageDigest,
+		Env:         rel.Env,
+		Framework:   rel.Framework,
+		RollbackOf:  number,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to record release: %w", err)
+	}
+
+	inst.apply(&meta)
+	meta.Env = rel.Env
+	meta.Framework = rel.Framework
+	meta.Image = rel.Image
+	meta.CommitSHA = rel.CommitSHA
+	meta.CommitMsg = ""
+	if rel.CommitSHA != "" {
+		meta.CommitMsg = gitOutput(filepath.Join("deployments", sanitizedName, "repo"), "log", "-1", "--format=%s", rel.CommitSHA)
+	}
+	meta.Release = newNumber
+	if err := saveMetadata(sanitizedName, meta); err != nil {
+		return 0, err
+	}
+	return newNumber, nil
+}
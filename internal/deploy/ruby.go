@@ -0,0 +1,57 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// detectRuby returns "rails" for Rails apps and "ruby" for other Rack apps.
+func detectRuby(repoDir string) string {
+	if _, err := os.Stat(filepath.Join(repoDir, "config", "application.rb")); err == nil {
+		return "rails"
+	}
+	if gemfileHas(repoDir, "rails") {
+		return "rails"
+	}
+	return "ruby"
+}
+
+// gemfileHas reports whether the Gemfile declares the gem.
+func gemfileHas(repoDir, gem string) bool {
+	data, err := os.ReadFile(filepath.Join(repoDir, "Gemfile"))
+	if err != nil {
+		return false
+	}
+	return regexp.MustCompile(`(?m)^\s*gem\s+["']` + regexp.QuoteMeta(gem) + `["']`).Match(data)
+}
+
+// rubyVersion returns the major.minor version from .ruby-version,
+// defaulting to 3.3.
+func rubyVersion(repoDir string) string {
+	data, err := os.ReadFile(filepath.Join(repoDir, ".ruby-version"))
+	if err == nil {
+		if m := regexp.MustCompile(`(\d+)\.(\d+)`).FindStringSubmatch(string(data)); m != nil {
+			return m[1] + "." + m[2]
+		}
+	}
+	return "3.3"
+}
+
+// rubyParams fills in the parameters of the rails and rack templates: Rails
+// apps run rails server and precompile assets when they have the task, Rack
+// apps run puma or rackup.
+func rubyParams(p *TemplateParams, repoDir, framework string) {
+	p.Version = rubyVersion(repoDir)
+	_, err := os.Stat(filepath.Join(repoDir, "Gemfile.lock"))
+	p.GemfileLock = err == nil
+	switch {
+	case framework == "rails":
+		p.BuildCommand = "if bundle exec rails -T assets:precompile | grep -q assets:precompile; then SECRET_KEY_BASE_DUMMY=1 bundle exec rails assets:precompile; fi"
+		p.StartCommand = "bundle exec rails server -b 0.0.0.0 -p ${PORT}"
+	case gemfileHas(repoDir, "puma"):
+		p.StartCommand = "bundle exec puma -b tcp://0.0.0.0:${PORT}"
+	default:
+		p.StartCommand = "bundle exec rackup -o 0.0.0.0 -p ${PORT}"
+	}
+}
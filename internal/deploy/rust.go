@@ -0,0 +1,50 @@
+package deploy
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cargoBinary returns the binary built by Cargo.toml: the first [[bin]]
+// target, else the package name. It is empty for virtual workspaces.
+func cargoBinary(repoDir string) string {
+	data, err := os.ReadFile(filepath.Join(repoDir, "Cargo.toml"))
+	if err != nil {
+		return ""
+	}
+	var section, pkg string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = line
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) != "name" {
+			continue
+		}
+		name := strings.Trim(strings.TrimSpace(value), `"'`)
+		switch section {
+		case "[[bin]]":
+			return name
+		case "[package]":
+			if pkg == "" {
+				pkg = name
+			}
+		}
+	}
+	return pkg
+}
+
+// rustParams fills in the parameters of the rust template.
+func rustParams(p *TemplateParams, repoDir string) {
+	p.Version = "1"
+	p.Binary = cargoBinary(repoDir)
+	_, err := os.Stat(filepath.Join(repoDir, "Cargo.lock"))
+	p.Locked = err == nil
+	p.StartCommand = "/usr/local/bin/app"
+}
@@ -0,0 +1,223 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/redact"
+)
+
+// secretRefPattern matches a reference to a secret in an env value,
+// ${secret:name}. The value is resolved when the container starts, so the
+// app's stored env never holds it.
+var secretRefPattern = regexp.MustCompile(`\$\{secret:([A-Za-z0-9_.-]+)\}`)
+
+// ValidSecretScope reports whether scope and name select secrets: global
+// secrets have no name, group and app secrets need one.
+func ValidSecretScope(scope, name string) bool {
+	switch scope {
+	case db.SecretScopeGlobal:
+		return name == ""
+	case db.SecretScopeGroup, db.SecretScopeApp:
+		return name != ""
+	}
+	return false
+}
+
+// secretSource is a secret visible to an app and the scope it comes from.
+type secretSource struct {
+	value, scope, scopeName string
+}
+
+// appSecrets returns the secrets visible to an app by key: global ones,
+// overridden by those of its groups in order, overridden by its own.
+func appSecrets(sanitizedName string, groups []string) (map[string]secretSource, error) {
+	scopes := [][2]string{{db.SecretScopeGlobal, ""}}
+	for _, g := range groups {
+		scopes = append(scopes, [2]string{db.SecretScopeGroup, g})
+	}
+	scopes = append(scopes, [2]string{db.SecretScopeApp, sanitizedName})
+
+	visible := make(map[string]secretSource)
+	for _, s := range scopes {
+		secrets, err := db.GetSecrets(s[0], s[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to load secrets: %w", err)
+		}
+		for k, v := range secrets {
+			visible[k] = secretSource{value: v, scope: s[0], scopeName: s[1]}
+		}
+	}
+	return visible, nil
+}
+
+// expandSecrets replaces the secret references in the values of env.
+func expandSecrets(env map[string]string, secrets map[string]secretSource) (map[string]string, error) {
+	expanded := make(map[string]string, len(env))
+	var errs []error
+	for _, name := range sortedNames(env) {
+		expanded[name] = secretRefPattern.ReplaceAllStringFunc(env[name], func(ref string) string {
+			key := secretRefPattern.FindStringSubmatch(ref)[1]
+			s, ok := secrets[key]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s references unknown secret %s", name, key))
+				return ref
+			}
+			return s.value
+		})
+	}
+	return expanded, errors.Join(errs...)
+}
+
+// appEnv returns the environment of an app's container: env with secret
+// references resolved. Secrets env does not reference stay out of it.
+func appEnv(sanitizedName string, groups []string, env map[string]string) (map[string]string, error) {
+	secrets, err := appSecrets(sanitizedName, groups)
+	if err != nil {
+		return nil, err
+	}
+	return expandSecrets(env, secrets)
+}
+
+// ResolveEnv returns env with the secrets of appName resolved, as for the
+// container of an app deployed without groups.
+func ResolveEnv(appName string, env map[string]string) (map[string]string, error) {
+	return appEnv(SanitizeAppName(appName), nil, env)
+}
+
+// reloadAppEnv recreates the container of an app so that it gets the
+// current values of its secrets.
+func reloadAppEnv(sanitizedName string) error {
+	meta, err := loadMetadata(sanitizedName)
+	if err != nil {
+		return err
+	}
+	return UpdateAppEnv(sanitizedName, meta.Env)
+}
+
+// ValidateSecretRefs checks that the secret references in env name secrets
+// visible to the app, with groups or, when nil, its current groups.
+func ValidateSecretRefs(appName string, groups []string, env map[string]string) error {
+	sanitizedName := SanitizeAppName(appName)
+	for _, g := range groups {
+		if g == "" {
+			return errors.New("secret group names cannot be empty")
+		}
+	}
+	secrets, err := appSecrets(sanitizedName, appSecretGroups(sanitizedName, groups))
+	if err != nil {
+		return err
+	}
+	_, err = expandSecrets(env, secrets)
+	return err
+}
+
+// MaskEnv returns env as shown by the API: values are replaced by
+// redact.Mask, except empty ones and those referencing secrets, which hold
+// no secret value themselves.
+func MaskEnv(env map[string]string) map[string]string {
+	if env == nil {
+		return nil
+	}
+	masked := make(map[string]string, len(env))
+	for k, v := range env {
+		if v != "" && !secretRefPattern.MatchString(v) {
+			v = redact.Mask
+		}
+		masked[k] = v
+	}
+	return masked
+}
+
+// unmaskEnv restores from the app's current env the values that a client
+// saved back as MaskEnv showed them.
+func unmaskEnv(env, current map[string]string) map[string]string {
+	unmasked := make(map[string]string, len(env))
+	for k, v := range env {
+		if cur, ok := current[k]; ok && v == redact.Mask {
+			v = cur
+		}
+		unmasked[k] = v
+	}
+	return unmasked
+}
+
+// appSecretGroups returns groups, or the secret groups of the app's last
+// deployment when groups is nil.
+func appSecretGroups(sanitizedName string, groups []string) []string {
+	if groups != nil {
+		return groups
+	}
+	prev, _ := loadMetadata(sanitizedName)
+	return prev.SecretGroups
+}
+
+// usesSecret reports whether an app gets the value of a secret: the secret
+// is visible to the app under its key, not overridden by a narrower scope,
+// and referenced by the app's env.
+func usesSecret(meta DeploymentMetadata, secrets map[string]secretSource, scope, scopeName, key string) bool {
+	s, ok := secrets[key]
+	if !ok || s.scope != scope || s.scopeName != scopeName {
+		return false
+	}
+	for _, value := range meta.Env {
+		for _, m := range secretRefPattern.FindAllStringSubmatch(value, -1) {
+			if m[1] == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SecretUsers returns the names of the apps using a secret, sorted.
+func SecretUsers(scope, scopeName, key string) ([]string, error) {
+	metas, err := listMetadata()
+	if err != nil {
+		return nil, err
+	}
+	var users []string
+	for _, meta := range metas {
+		sanitizedName := SanitizeAppName(meta.AppName)
+		secrets, err := appSecrets(sanitizedName, meta.SecretGroups)
+		if err != nil {
+			return nil, err
+		}
+		if usesSecret(meta, secrets, scope, scopeName, key) {
+			users = append(users, sanitizedName)
+		}
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+// SaveSecret stores a secret and returns the apps using it. With restart,
+// their containers are recreated so they get the new value; otherwise they
+// get it when their container is next recreated (deploy, env update or
+// rollback), as restarting a container keeps its env.
+func SaveSecret(scope, scopeName, key, value string, restart bool) ([]string, error) {
+	if !ValidSecretScope(scope, scopeName) {
+		return nil, fmt.Errorf("invalid secret scope %q %q", scope, scopeName)
+	}
+	if err := db.SaveScopedSecret(scope, scopeName, key, value); err != nil {
+		return nil, fmt.Errorf("failed to save secret: %w", err)
+	}
+	users, err := SecretUsers(scope, scopeName, key)
+	if err != nil || !restart {
+		return users, err
+	}
+
+	var errs []error
+	for _, name := range users {
+		if err := reloadAppEnv(name); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restart %s: %w", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return users, fmt.Errorf("secret saved, but: %w", errors.Join(errs...))
+	}
+	return users, nil
+}
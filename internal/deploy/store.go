@@ -0,0 +1,173 @@
+package deploy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+)
+
+// appSettings are the deploy settings of an app, stored as JSON in the apps
+// table.
+type appSettings struct {
+	EnvOptions  map[string]EnvVarOptions `json:"env_options,omitempty"`
+	HealthCheck *HealthCheck             `json:"health_check,omitempty"`
+	Build       BuildSettings            `json:"build"`
+	Container   *ContainerSettings       `json:"container,omitempty"`
+	Cron        []CronJob                `json:"cron,omitempty"`
+	// SecretGroups are the groups whose secrets the app gets
+	SecretGroups []string `json:"secret_groups,omitempty"`
+}
+
+// loadMetadata reads the stored metadata of an app. The error wraps
+// sql.ErrNoRows when the app does not exist.
+func loadMetadata(sanitizedName string) (DeploymentMetadata, error) {
+	app, err := db.GetApp(sanitizedName)
+	if err != nil {
+		return DeploymentMetadata{}, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	return metadataFromApp(app)
+}
+
+// saveMetadata stores the metadata of an app.
+func saveMetadata(sanitizedName string, meta DeploymentMetadata) error {
+	settings, err := json.Marshal(appSettings{
+		EnvOptions:  meta.EnvOptions,
+		HealthCheck: meta.HealthCheck,
+		Build:       meta.Build,
+		Container:   meta.Container,
+		Cron:        meta.Cron,
+
+		SecretGroups: meta.SecretGroups,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	err = db.SaveApp(db.App{
+		Name:         sanitizedName,
+		DisplayName:  meta.AppName,
+		ContainerID:  meta.ContainerID,
+		Port:         meta.Port,
+		RepoURL:      meta.RepoURL,
+		Framework:    meta.Framework,
+		Image:        meta.Image,
+		Release:      meta.Release,
+		Ref:          meta.Ref,
+		CommitSHA:    meta.CommitSHA,
+		CommitMsg:    meta.CommitMsg,
+		Strategy:     meta.Strategy,
+		Color:        meta.Color,
+		InternalPort: meta.InternalPort,
+		Settings:     string(settings),
+		Env:          meta.Env,
+		Domains:      meta.Domains,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	return nil
+}
+
+func metadataFromApp(app db.App) (DeploymentMetadata, error) {
+	meta := DeploymentMetadata{
+		AppName:      app.DisplayName,
+		ContainerID:  app.ContainerID,
+		Port:         app.Port,
+		Env:          app.Env,
+		RepoURL:      app.RepoURL,
+		Framework:    app.Framework,
+		Image:        app.Image,
+		Release:      app.Release,
+		Ref:          app.Ref,
+		CommitSHA:    app.CommitSHA,
+		CommitMsg:    app.CommitMsg,
+		Strategy:     app.Strategy,
+		Color:        app.Color,
+		InternalPort: app.InternalPort,
+		Domains:      app.Domains,
+	}
+	if meta.AppName == "" {
+		meta.AppName = app.Name
+	}
+	if app.Settings != "" {
+		var settings appSettings
+		if err := json.Unmarshal([]byte(app.Settings), &settings); err != nil {
+			return meta, fmt.Errorf("failed to parse metadata of %s: %w", app.Name, err)
+		}
+		meta.EnvOptions = settings.EnvOptions
+		meta.HealthCheck = settings.HealthCheck
+		meta.Build = settings.Build
+		meta.Container = settings.Container
+		meta.Cron = settings.Cron
+		meta.SecretGroups = settings.SecretGroups
+	}
+	return meta, nil
+}
+
+// listMetadata returns the stored metadata of every app, ordered by name.
+// Apps whose metadata cannot be parsed are skipped with a warning.
+func listMetadata() ([]DeploymentMetadata, error) {
+	apps, err := db.ListApps()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list apps: %w", err)
+	}
+	var metas []DeploymentMetadata
+	for _, app := range apps {
+		meta, err := metadataFromApp(app)
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			continue
+		}
+		metas = append(metas, meta)
+	}
+	return metas, nil
+}
+
+// ImportMetadataFiles moves the metadata of apps deployed by earlier
+// versions from deployments/<name>.json into the database, and renames each
+// imported file to <name>.json.imported. Apps already in the database keep
+// their stored metadata, and their file is renamed too. It returns the
+// number of imported apps.
+func ImportMetadataFiles() (int, error) {
+	files, err := filepath.Glob(filepath.Join("deployments", "*.json"))
+	if err != nil {
+		return 0, err
+	}
+
+	imported := 0
+	var errs []error
+	for _, f := range files {
+		sanitizedName := SanitizeAppName(strings.TrimSuffix(filepath.Base(f), ".json"))
+		if _, err := db.GetApp(sanitizedName); err == nil {
+			os.Rename(f, f+".imported")
+			continue
+		}
+
+		data, err := os.ReadFile(f)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read %s: %w", f, err))
+			continue
+		}
+		var meta DeploymentMetadata
+		if err := json.Unmarshal(data, &meta); err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse %s: %w", f, err))
+			continue
+		}
+		if meta.AppName == "" {
+			meta.AppName = sanitizedName
+		}
+		if err := saveMetadata(sanitizedName, meta); err != nil {
+			errs = append(errs, fmt.Errorf("failed to import %s: %w", f, err))
+			continue
+		}
+		if err := os.Rename(f, f+".imported"); err != nil {
+			errs = append(errs, fmt.Errorf("failed to rename %s: %w", f, err))
+		}
+		imported++
+	}
+	return imported, errors.Join(errs...)
+}
@@ -0,0 +1,544 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/prashanta0234/vpsmyth/internal/config"
+)
+
+//go:embed templates/*.Dockerfile.tmpl
+var builtinTemplates embed.FS
+
+const templateExt = ".Dockerfile.tmpl"
+
+// TemplateDir returns the directory holding admin-provided templates. A
+// <name>.Dockerfile.tmpl file there replaces the built-in template of that
+// name, or adds a new one usable as a framework.
+func TemplateDir() string {
+	return config.EnvString("VPSMYTH_TEMPLATE_DIR", filepath.Join("data", "templates"))
+}
+
+// BuildSettings tune how the sources of an app are turned into an image.
+type BuildSettings struct {
+	// GoMain is the main package of a Go app, e.g. "./cmd/server".
+	// Empty picks the module root or the only cmd/<name> package.
+	GoMain string `json:"goMain,omitempty"`
+	// CGO builds Go apps with CGO_ENABLED=1 on a glibc runtime image.
+	CGO bool `json:"cgo,omitempty"`
+	// GoPrivate is passed as GOPRIVATE; empty uses the owner of a GitHub repository.
+	GoPrivate string `json:"goPrivate,omitempty"`
+
+	// Template parameters overriding the framework defaults
+	NodeVersion  string `json:"nodeVersion,omitempty"`
+	BuildCommand string `json:"buildCommand,omitempty"`
+	StartCommand string `json:"startCommand,omitempty"`
+	OutputDir    string `json:"outputDir,omitempty"`
+	// BuildArgs are passed to the image build as --build-arg; generated
+	// Dockerfiles declare them. Use secret build-time env vars for credentials.
+	BuildArgs map[string]string `json:"buildArgs,omitempty"`
+
+	// Monorepos: paths are relative to the repository root
+	RootDir    string `json:"rootDir,omitempty"`    // directory of the app; detection and templates use it
+	Dockerfile string `json:"dockerfile,omitempty"` // project Dockerfile, default <rootDir>/Dockerfile
+	Context    string `json:"context,omitempty"`    // build context of the project Dockerfile, default rootDir
+	Target     string `json:"target,omitempty"`     // stage of a multi-stage Dockerfile to build
+	// WatchPaths limit push webhooks to pushes changing files under these
+	// paths (or matching these patterns); empty redeploys on every push.
+	WatchPaths []string `json:"watchPaths,omitempty"`
+}
+
+var (
+	nodeVersionPattern = regexp.MustCompile(`^[0-9a-z][0-9a-z.-]*$`)
+	targetPattern      = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+)
+
+// insideRepo reports whether p is a relative path that stays inside the repository.
+func insideRepo(p string) bool {
+	p = path.Clean(filepath.ToSlash(p))
+	return !path.IsAbs(p) && p != ".." && !strings.HasPrefix(p, "../")
+}
+
+// Validate reports whether the build settings are usable.
+func (b BuildSettings) Validate() error {
+	if !insideRepo(b.GoMain) {
+		return fmt.Errorf("goMain must be a package inside the repository: %s", b.GoMain)
+	}
+	if strings.ContainsAny(b.GoPrivate, " \t\n\"'") {
+		return fmt.Errorf("goPrivate must be a comma-separated list of module path patterns")
+	}
+	if b.NodeVersion != "" && !nodeVersionPattern.MatchString(b.NodeVersion) {
+		return fmt.Errorf("invalid nodeVersion: %s", b.NodeVersion)
+	}
+	// Values are written into Dockerfile lines
+	for name, value := range map[string]string{"buildCommand": b.BuildCommand, "startCommand": b.StartCommand, "outputDir": b.OutputDir} {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%s must be a single line", name)
+		}
+	}
+	if strings.ContainsAny(b.OutputDir, " \"'") || !insideRepo(b.OutputDir) {
+		return fmt.Errorf("outputDir must be a directory inside the repository: %s", b.OutputDir)
+	}
+	for name, value := range map[string]string{"rootDir": b.RootDir, "dockerfile": b.Dockerfile, "context": b.Context} {
+		if !insideRepo(value) {
+			return fmt.Errorf("%s must be a path inside the repository: %s", name, value)
+		}
+	}
+	for name := range b.BuildArgs {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid build arg name: %q", name)
+		}
+	}
+	if b.Target != "" && !targetPattern.MatchString(b.Target) {
+		return fmt.Errorf("invalid target stage: %s", b.Target)
+	}
+	for _, p := range b.WatchPaths {
+		if _, err := path.Match(p, ""); err != nil || p == "" || !insideRepo(p) {
+			return fmt.Errorf("invalid watch path: %q", p)
+		}
+	}
+	return nil
+}
+
+// Watches reports whether a push changing files should redeploy the app:
+// always without watch paths, otherwise when a file is under a watch path
+// or matches a watch pattern.
+func (b BuildSettings) Watches(files []string) bool {
+	if len(b.WatchPaths) == 0 {
+		return true
+	}
+	for _, file := range files {
+		for _, watch := range b.WatchPaths {
+			watch = strings.TrimSuffix(path.Clean(watch), "/")
+			if watch == "." || file == watch || strings.HasPrefix(file, watch+"/") {
+				return true
+			}
+			if ok, _ := path.Match(watch, file); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TemplateParams are the values available to Dockerfile templates.
+type TemplateParams struct {
+	Framework string
+	Port      int
+
+	// Node.js
+	NodeVersion    string
+	PackageManager string   // npm, pnpm, yarn or bun
+	NodeSetup      string   // run before the install, e.g. "corepack enable"
+	ManifestFiles  []string // package.json and the lockfile, copied before the install
+	ManifestDirs   []string // directories the install needs, e.g. .yarn
+	InstallCommand string
+	BuildCommand   string // also used by rails and rack when set
+	StartCommand   string // rendered with {{cmd .StartCommand}}
+	OutputDir      string // built static files (react) or the served directory (html)
+
+	// Version of the language image for go, python, rust and ruby
+	Version string
+
+	// Go
+	GoMain      string
+	CGO         bool
+	Vendored    bool
+	GitHubToken bool // the GitHub token is one of the BuildSecrets
+
+	// Python
+	PythonDeps    string // "requirements", "pipfile" or "pyproject"
+	PipfileLock   bool
+	Server        string // app server installed with pip, e.g. gunicorn
+	CollectStatic bool
+
+	// Rust
+	Binary string
+	Locked bool
+
+	// Ruby
+	GemfileLock bool
+
+	// Build-time variables: BuildArgs are declared as ARG, BuildSecrets are
+	// mounted into the install and build steps with {{secrets .BuildSecrets}}
+	BuildArgs    []string
+	BuildSecrets []string
+}
+
+// Template describes a Dockerfile template of the registry.
+type Template struct {
+	Name       string   `json:"name"`
+	Source     string   `json:"source"` // "builtin" or "custom"
+	Frameworks []string `json:"frameworks,omitempty"`
+	Content    string   `json:"content"`
+}
+
+// Detection reports how the Dockerfile of a deployment was chosen.
+type Detection struct {
+	Framework string `json:"framework,omitempty"` // framework the template was picked for
+	Template  string `json:"template"`            // "dockerfile" when the project provides its own
+	// DetectedBy is the file that identified the framework, or "selected"
+	// when it was chosen in the deploy request.
+	DetectedBy string `json:"detectedBy,omitempty"`
+}
+
+// frameworkTemplates maps the supported frameworks to their Dockerfile template.
+var frameworkTemplates = map[string]string{
+	"nextjs":  "nextjs",
+	"react":   "react",
+	"html":    "html",
+	"nestjs":  "nestjs",
+	"express": "node",
+	"nodejs":  "node",
+	"go":      "go",
+	"django":  "python",
+	"flask":   "python",
+	"fastapi": "python",
+	"python":  "python",
+	"rust":    "rust",
+	"rails":   "rails",
+	"ruby":    "rack",
+}
+
+var templateNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+var templateFuncs = template.FuncMap{"cmd": execForm, "join": strings.Join, "secrets": secretMounts}
+
+// secretMounts renders the start of a RUN instruction that mounts the BuildKit
+// secrets and exports them to the command, e.g.
+// RUN {{secrets .BuildSecrets}}npm run build. It is empty without secrets.
+func secretMounts(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var mounts, exports []string
+	for _, name := range names {
+		mounts = append(mounts, "--mount=type=secret,id="+name)
+		exports = append(exports, fmt.Sprintf(`%s="$(cat /run/secrets/%s)"`, name, name))
+	}
+	return strings.Join(mounts, " ") + " export " + strings.Join(exports, " ") + " && "
+}
+
+// execForm renders a command as a JSON CMD array. Commands using shell
+// syntax, like ${PORT}, run through sh -c.
+func execForm(command string) string {
+	args := strings.Fields(command)
+	if strings.ContainsAny(command, "$&|;<>`'\"*?(){}\\") {
+		if !strings.ContainsAny(command, "&|;") {
+			command = "exec " + command
+		}
+		args = []string{"sh", "-c", command}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(args)
+	return strings.TrimSpace(buf.String())
+}
+
+// loadTemplate returns the source of a template, preferring the template
+// directory over the built-in one.
+func loadTemplate(name string) (string, string, error) {
+	data, err := os.ReadFile(filepath.Join(TemplateDir(), name+templateExt))
+	if err == nil {
+		return string(data), "custom", nil
+	}
+	if !os.IsNotExist(err) {
+		return "", "", fmt.Errorf("failed to read template %s: %w", name, err)
+	}
+	data, err = builtinTemplates.ReadFile("templates/" + name + templateExt)
+	if err != nil {
+		return "", "", fmt.Errorf("unknown template: %s", name)
+	}
+	return string(data), "builtin", nil
+}
+
+// renderTemplate renders the named template with params.
+func renderTemplate(name string, params TemplateParams) (string, error) {
+	text, _, err := loadTemplate(name)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, params); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// ListTemplates returns the built-in and custom templates by name.
+func ListTemplates() ([]Template, error) {
+	names := map[string]bool{}
+	builtin, _ := fs.Glob(builtinTemplates, "templates/*"+templateExt)
+	custom, _ := filepath.Glob(filepath.Join(TemplateDir(), "*"+templateExt))
+	for _, file := range append(builtin, custom...) {
+		names[strings.TrimSuffix(filepath.Base(file), templateExt)] = true
+	}
+
+	var list []Template
+	for name := range names {
+		content, source, err := loadTemplate(name)
+		if err != nil {
+			return nil, err
+		}
+		t := Template{Name: name, Source: source, Content: content}
+		for framework, tmpl := range frameworkTemplates {
+			if tmpl == name {
+				t.Frameworks = append(t.Frameworks, framework)
+			}
+		}
+		sort.Strings(t.Frameworks)
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// detectFramework picks the template for the sources in repoDir. A supported
+// framework (or custom template name) chosen by the user wins; otherwise the
+// project files decide, in order: go.mod, Cargo.toml, Gemfile, Python
+// manifests, package.json. Projects without any of them are served as static HTML.
+func detectFramework(repoDir, framework string) Detection {
+	if tmpl, ok := frameworkTemplates[framework]; ok {
+		return Detection{Framework: framework, Template: tmpl, DetectedBy: "selected"}
+	}
+	if templateNamePattern.MatchString(framework) {
+		if _, err := os.Stat(filepath.Join(TemplateDir(), framework+templateExt)); err == nil {
+			return Detection{Framework: framework, Template: framework, DetectedBy: "selected"}
+		}
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(repoDir, name))
+		return err == nil
+	}
+
+	detected, by := "html", ""
+	switch {
+	case exists("go.mod"):
+		detected, by = "go", "go.mod"
+	case exists("Cargo.toml"):
+		detected, by = "rust", "Cargo.toml"
+	case exists("Gemfile"):
+		detected, by = detectRuby(repoDir), "Gemfile"
+	case exists("package.json"):
+		detected, by = detectNode(repoDir), "package.json"
+	}
+	if by == "" || by == "package.json" {
+		// Python apps often carry a package.json for their frontend assets
+		for _, name := range pythonManifests {
+			if exists(name) {
+				detected, by = detectPython(repoDir), name
+				break
+			}
+		}
+	}
+	return Detection{Framework: detected, Template: frameworkTemplates[detected], DetectedBy: by}
+}
+
+// nodePackage holds the parts of package.json used for detection.
+type nodePackage struct {
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+	Scripts         map[string]string `json:"scripts"`
+	PackageManager  string            `json:"packageManager"`
+	Engines         map[string]string `json:"engines"`
+}
+
+func readNodePackage(repoDir string) nodePackage {
+	var pkg nodePackage
+	data, _ := os.ReadFile(filepath.Join(repoDir, "package.json"))
+	json.Unmarshal(data, &pkg)
+	return pkg
+}
+
+func (pkg nodePackage) has(dep string) bool {
+	return pkg.Dependencies[dep] != "" || pkg.DevDependencies[dep] != ""
+}
+
+// detectNode returns the Node.js framework used by package.json.
+func detectNode(repoDir string) string {
+	pkg := readNodePackage(repoDir)
+	switch {
+	case pkg.has("next"):
+		return "nextjs"
+	case pkg.Dependencies["@nestjs/core"] != "":
+		return "nestjs"
+	case pkg.has("vite"), pkg.has("react-scripts"):
+		return "react"
+	}
+	return "nodejs"
+}
+
+// templateParams returns the parameters for rendering the template of det,
+// with the defaults of the framework overridden by settings.
+func templateParams(repoDir, appName string, port int, det Detection, settings BuildSettings) TemplateParams {
+	p := TemplateParams{
+		Framework:      det.Framework,
+		Port:           port,
+		NodeVersion:    "18",
+		PackageManager: "npm",
+		InstallCommand: "npm install",
+		ManifestFiles:  []string{"package*.json"},
+		OutputDir:      ".",
+	}
+	switch det.Template {
+	case "nextjs", "react", "nestjs", "node":
+		pkg := readNodePackage(repoDir)
+		nodeParams(&p, repoDir, pkg)
+		pm := p.PackageManager
+		switch det.Template {
+		case "nextjs":
+			p.BuildCommand, p.StartCommand = nodeRun(pm, "build"), nodeRun(pm, "start")
+		case "react":
+			p.BuildCommand, p.OutputDir = nodeRun(pm, "build"), "dist"
+			if pkg.has("react-scripts") {
+				p.OutputDir = "build"
+			}
+		case "nestjs":
+			p.BuildCommand, p.StartCommand = nodeRun(pm, "build"), nodeRun(pm, "start:prod")
+		case "node":
+			p.StartCommand = nodeRun(pm, "start")
+		}
+	case "go":
+		goParams(&p, repoDir, appName, settings)
+	case "python":
+		pythonParams(&p, repoDir, det.Framework)
+	case "rust":
+		rustParams(&p, repoDir)
+	case "rails", "rack":
+		rubyParams(&p, repoDir, det.Framework)
+	}
+
+	if settings.NodeVersion != "" {
+		p.NodeVersion = settings.NodeVersion
+	}
+	if settings.BuildCommand != "" {
+		p.BuildCommand = settings.BuildCommand
+	}
+	if settings.OutputDir != "" {
+		p.OutputDir = settings.OutputDir
+	}
+	if settings.StartCommand != "" {
+		p.StartCommand = settings.StartCommand
+	} else if det.Template == "react" {
+		p.StartCommand = fmt.Sprintf("serve -s %s -p %d", p.OutputDir, port)
+	}
+	return p
+}
+
+// DockerfilePlan is the Dockerfile chosen for a source directory.
+type DockerfilePlan struct {
+	Detection  Detection       `json:"detection"`
+	Params     *TemplateParams `json:"params,omitempty"` // nil when the project provides the Dockerfile
+	Dockerfile string          `json:"dockerfile"`
+	// Paths relative to the source directory
+	DockerfilePath string `json:"dockerfilePath"`
+	Context        string `json:"context"`
+}
+
+// planDockerfile picks the Dockerfile for the sources in repoDir. The
+// project's own Dockerfile (build.dockerfile, else Dockerfile in the root
+// directory) is used when it exists and no framework was selected; its
+// context is build.context, else the root directory. Otherwise a template is
+// rendered for the root directory, which is also the context. projectFile
+// tells project files from generated ones; nil trusts every existing file.
+func planDockerfile(spec Spec, repoDir string, projectFile func(string) bool) (DockerfilePlan, error) {
+	settings := spec.Build
+	rootDir := cleanRel(settings.RootDir)
+	if info, err := os.Stat(filepath.Join(repoDir, rootDir)); err != nil || !info.IsDir() {
+		return DockerfilePlan{}, fmt.Errorf("root directory %s not found", rootDir)
+	}
+
+	dockerfilePath := filepath.Join(rootDir, "Dockerfile")
+	if settings.Dockerfile != "" {
+		dockerfilePath = cleanRel(settings.Dockerfile)
+	}
+	_, err := os.Stat(filepath.Join(repoDir, dockerfilePath))
+	provided := err == nil && (projectFile == nil || projectFile(dockerfilePath))
+	if provided && spec.Framework == "" {
+		data, err := os.ReadFile(filepath.Join(repoDir, dockerfilePath))
+		if err != nil {
+			return DockerfilePlan{}, fmt.Errorf("failed to read Dockerfile: %w", err)
+		}
+		context := rootDir
+		if settings.Context != "" {
+			context = cleanRel(settings.Context)
+		}
+		if rel, err := filepath.Rel(context, dockerfilePath); err != nil || strings.HasPrefix(rel, "..") {
+			return DockerfilePlan{}, fmt.Errorf("Dockerfile %s must be inside the build context %s", dockerfilePath, context)
+		}
+		return DockerfilePlan{
+			Detection:      Detection{Template: "dockerfile", DetectedBy: dockerfilePath},
+			Dockerfile:     string(data),
+			DockerfilePath: dockerfilePath,
+			Context:        context,
+		}, nil
+	}
+	if settings.Dockerfile != "" && spec.Framework == "" {
+		return DockerfilePlan{}, fmt.Errorf("Dockerfile %s not found in the repository", dockerfilePath)
+	}
+
+	appDir := filepath.Join(repoDir, rootDir)
+	det := detectFramework(appDir, spec.Framework)
+	params := templateParams(appDir, SanitizeAppName(spec.AppName), spec.Port, det, settings)
+	args, secrets := buildArgs(spec)
+	params.BuildArgs, params.BuildSecrets = sortedNames(args), sortedNames(secrets)
+	if det.Template == "go" && goGitHubToken(spec.RepoURL) != "" {
+		params.GitHubToken = true
+		params.BuildSecrets = append(params.BuildSecrets, githubTokenSecret)
+	}
+	content, err := renderTemplate(det.Template, params)
+	if err != nil {
+		return DockerfilePlan{}, err
+	}
+	return DockerfilePlan{
+		Detection:      det,
+		Params:         &params,
+		Dockerfile:     content,
+		DockerfilePath: filepath.Join(rootDir, "Dockerfile"),
+		Context:        rootDir,
+	}, nil
+}
+
+// cleanRel cleans a path relative to the source directory; empty is ".".
+func cleanRel(p string) string {
+	return filepath.Clean(filepath.FromSlash(p))
+}
+
+// PreviewDockerfile fetches spec.RepoURL at spec.Ref into a temporary
+// directory and returns the Dockerfile a deploy of spec would build with.
+func PreviewDockerfile(spec Spec) (DockerfilePlan, error) {
+	dir, err := os.MkdirTemp("", "vpsmyth-preview-")
+	if err != nil {
+		return DockerfilePlan{}, fmt.Errorf("failed to create directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := stepContext(context.Background(), "clone", "VPSMYTH_CLONE_TIMEOUT", 600)
+	defer cancel()
+	var out bytes.Buffer
+	if err := checkoutRef(ctx, dir, cloneURL(spec.RepoURL), spec.Ref, &out); err != nil {
+		// The output is not returned: git may print the URL with the token
+		return DockerfilePlan{}, fmt.Errorf("failed to fetch repository: %w", err)
+	}
+	spec, _, err = applyManifest(spec, dir)
+	if err != nil {
+		return DockerfilePlan{}, err
+	}
+	return planDockerfile(spec, dir, gitTracked(dir))
+}
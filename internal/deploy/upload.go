@@ -0,0 +1,61 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prashanta0234/vpsmyth/internal/config"
+)
+
+// UploadPrefix marks the RepoURL of apps deployed from an uploaded archive.
+const UploadPrefix = "Upload: "
+
+// FromGit reports whether the app was deployed from a git repository.
+func (m DeploymentMetadata) FromGit() bool {
+	return m.RepoURL != "" && !strings.HasPrefix(m.RepoURL, "Image: ") && !strings.HasPrefix(m.RepoURL, UploadPrefix)
+}
+
+// DeployUpload extracts the archive at spec.ArchivePath into the app's
+// source directory and builds and runs it like a git deployment. The archive
+// is removed afterwards.
+func DeployUpload(spec Spec, rep Reporter) error {
+	defer os.Remove(spec.ArchivePath)
+	ctx, cancel := deployContext(rep)
+	defer cancel()
+
+	sanitizedName := SanitizeAppName(spec.AppName)
+	unlock, err := lockApp(ctx, sanitizedName, rep)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	appDir := filepath.Join("deployments", sanitizedName)
+	repoDir := filepath.Join(appDir, "repo")
+	staging := filepath.Join(appDir, "repo.upload")
+
+	rep.SetState(StateExtracting)
+	fmt.Fprintf(rep, "Extracting %s\n", strings.TrimPrefix(spec.RepoURL, UploadPrefix))
+
+	os.RemoveAll(staging)
+	defer os.RemoveAll(staging)
+	limit := int64(config.EnvInt("VPSMYTH_MAX_EXTRACT_MB", 1024)) << 20
+	if err := extractArchive(spec.ArchivePath, staging, limit); err != nil {
+		return fmt.Errorf("failed to extract archive: %w", err)
+	}
+
+	// The upload replaces the previous sources, including a git checkout
+	if err := os.RemoveAll(repoDir); err != nil {
+		return fmt.Errorf("failed to remove previous sources: %w", err)
+	}
+	if err := os.Rename(sourceRoot(staging), repoDir); err != nil {
+		return fmt.Errorf("failed to move extracted sources: %w", err)
+	}
+
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return buildAndRun(ctx, spec, repoDir, source{RepoURL: spec.RepoURL}, rep)
+}
@@ -0,0 +1,307 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/redact"
+)
+
+// Lifecycle states of a job. Runners report their own intermediate states
+// (e.g. cloning, building) through Job.SetState.
+const (
+	StateQueued      = "queued"
+	StateRunning     = "running"
+	StateSucceeded   = "succeeded"
+	StateFailed      = "failed"
+	StateInterrupted = "interrupted"
+	StateCancelled   = "cancelled"
+)
+
+// Policies for a job submitted while another job of the same app is queued
+// or running.
+const (
+	PolicyQueue  = "queue"  // run after the earlier jobs
+	PolicyReject = "reject" // refuse the new job
+	PolicyCancel = "cancel" // cancel the earlier jobs
+)
+
+var (
+	// ErrCancelled is the cause of the context of a job cancelled by Queue.Cancel.
+	ErrCancelled = errors.New("cancelled by request")
+	// ErrSuperseded is the cause of the context of a job cancelled by a newer
+	// job of the same app under PolicyCancel.
+	ErrSuperseded = errors.New("superseded by a newer deployment")
+	// ErrNotCancellable is returned by Queue.Cancel for jobs that have finished.
+	ErrNotCancellable = errors.New("job has already finished")
+	// ErrAppBusy is returned by Queue.Submit under PolicyReject.
+	ErrAppBusy = errors.New("a deployment of this app is already queued or running")
+)
+
+// Runner executes a single job.
+type Runner func(job *Job) error
+
+// Job is a job being executed by a worker. It implements io.Writer to
+// capture the job's output.
+type Job struct {
+	ID      int64
+	AppName string
+	Payload string
+
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	cancelled bool // set by Queue.Cancel, guarded by Queue.mu
+
+	mu      sync.Mutex
+	partial []byte
+	seq     int
+}
+
+// SetState records an intermediate state of the job.
+func (j *Job) SetState(state string) {
+	j.Logf("==> %s", state)
+	if err := db.UpdateDeployJobState(j.ID, state); err != nil {
+		fmt.Printf("Warning: failed to update state of job %d: %v\n", j.ID, err)
+	}
+}
+
+// SetResult stores v as the JSON result of the job.
+func (j *Job) SetResult(v interface{}) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		err = db.SetDeployJobResult(j.ID, string(data))
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to store result of job %d: %v\n", j.ID, err)
+	}
+}
+
+// Context returns the context of the job, cancelled by Queue.Cancel.
+func (j *Job) Context() context.Context {
+	if j.ctx == nil {
+		return context.Background()
+	}
+	return j.ctx
+}
+
+// Decode unmarshals the job payload into v.
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(j.Payload), v)
+}
+
+// Queue runs submitted jobs on a fixed pool of workers. Jobs are persisted
+// in SQLite, so their state can be polled after the submitting request ends.
+type Queue struct {
+	pending chan int64
+	runner  Runner
+
+	mu      sync.Mutex
+	policy  string
+	queued  map[int64]string // app names of jobs waiting for a worker
+	running map[int64]*Job
+	dropped map[int64]bool // queued jobs cancelled before they started
+}
+
+// NewQueue marks jobs left over from a previous run as interrupted and
+// starts workers goroutines executing jobs with runner.
+func NewQueue(workers int, runner Runner) (*Queue, error) {
+	n, err := db.InterruptDeployJobs(StateInterrupted, StateSucceeded, StateFailed, StateCancelled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover deploy jobs: %w", err)
+	}
+	if n > 0 {
+		fmt.Printf("Marked %d unfinished deploy job(s) as interrupted\n", n)
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	q := &Queue{
+		pending: make(chan int64, 100),
+		runner:  runner,
+		policy:  PolicyQueue,
+		queued:  map[int64]string{},
+		running: map[int64]*Job{},
+		dropped: map[int64]bool{},
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q, nil
+}
+
+// Submit stores a job for appName with payload encoded as JSON and queues it.
+// It returns the job ID immediately.
+func (q *Queue) Submit(appName string, payload interface{}) (int64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	q.mu.Lock()
+	earlier := q.active(appName)
+	if len(earlier) > 0 && q.policy == PolicyReject {
+		q.mu.Unlock()
+		return 0, ErrAppBusy
+	}
+	id, err := db.CreateDeployJob(appName, StateQueued, string(data))
+	if err != nil {
+		q.mu.Unlock()
+		return 0, fmt.Errorf("failed to store job: %w", err)
+	}
+	q.queued[id] = appName
+	if q.policy == PolicyCancel {
+		for _, prev := range earlier {
+			if err := q.cancelLocked(prev, ErrSuperseded); err != nil {
+				fmt.Printf("Warning: failed to cancel job %d: %v\n", prev, err)
+			}
+		}
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.pending <- id:
+	default:
+		// Queue buffer is full; hand the job over without blocking the caller.
+		go func() { q.pending <- id }()
+	}
+	return id, nil
+}
+
+// SetPolicy sets how jobs submitted for an app with a queued or running job
+// are handled: PolicyQueue (the default), PolicyReject or PolicyCancel.
+func (q *Queue) SetPolicy(policy string) error {
+	switch policy {
+	case PolicyQueue, PolicyReject, PolicyCancel:
+	default:
+		return fmt.Errorf("unknown deploy policy %q", policy)
+	}
+	q.mu.Lock()
+	q.policy = policy
+	q.mu.Unlock()
+	return nil
+}
+
+// active returns the IDs of the queued and running jobs of an app. q.mu
+// must be held.
+func (q *Queue) active(appName string) []int64 {
+	var ids []int64
+	for id, name := range q.queued {
+		if name == appName {
+			ids = append(ids, id)
+		}
+	}
+	for id, job := range q.running {
+		if job.AppName == appName {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (q *Queue) work() {
+	for id := range q.pending {
+		q.run(id)
+	}
+}
+
+func (q *Queue) run(id int64) {
+	record, err := db.GetDeployJob(id)
+	if err != nil {
+		fmt.Printf("Warning: failed to load job %d: %v\n", id, err)
+		return
+	}
+
+	job := &Job{ID: record.ID, AppName: record.AppName, Payload: record.Payload}
+	job.ctx, job.cancel = context.WithCancelCause(context.Background())
+	defer job.cancel(nil)
+	q.mu.Lock()
+	delete(q.queued, id)
+	if q.dropped[id] {
+		delete(q.dropped, id)
+		q.mu.Unlock()
+		return
+	}
+	q.running[id] = job
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, id)
+		q.mu.Unlock()
+	}()
+
+	if err := db.StartDeployJob(id, StateRunning); err != nil {
+		fmt.Printf("Warning: failed to start job %d: %v\n", id, err)
+	}
+
+	err = q.safeRun(job)
+	if err != nil {
+		job.Logf("Error: %v", err)
+	}
+	job.flush()
+
+	q.mu.Lock()
+	cancelled := job.cancelled
+	q.mu.Unlock()
+	state, errMsg := StateSucceeded, ""
+	if err != nil && cancelled {
+		state, errMsg = StateCancelled, redact.String(err.Error())
+		fmt.Printf("Job %d for %s was cancelled\n", id, job.AppName)
+	} else if err != nil {
+		state, errMsg = StateFailed, redact.String(err.Error())
+		fmt.Printf("Job %d for %s failed: %s\n", id, job.AppName, errMsg)
+	}
+	if err := db.FinishDeployJob(id, state, errMsg); err != nil {
+		fmt.Printf("Warning: failed to finish job %d: %v\n", id, err)
+	}
+	logs.finish(id)
+}
+
+// Cancel stops a job: a queued job is dropped, and the context of a running
+// job is cancelled; the runner decides how to wind down. It returns
+// ErrNotCancellable for finished jobs.
+func (q *Queue) Cancel(id int64) error {
+	record, err := db.GetDeployJob(id)
+	if err != nil {
+		return fmt.Errorf("failed to load job %d: %w", id, err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.running[id]; !ok && record.State != StateQueued {
+		return ErrNotCancellable
+	}
+	return q.cancelLocked(id, ErrCancelled)
+}
+
+// cancelLocked cancels a queued or running job with cause. q.mu must be held.
+func (q *Queue) cancelLocked(id int64, cause error) error {
+	if job, ok := q.running[id]; ok {
+		job.cancelled = true
+		job.cancel(cause)
+		job.Logf("Cancellation requested: %v", cause)
+		return nil
+	}
+	delete(q.queued, id)
+	q.dropped[id] = true
+	if err := db.FinishDeployJob(id, StateCancelled, cause.Error()+" before it started"); err != nil {
+		return fmt.Errorf("failed to cancel job %d: %w", id, err)
+	}
+	logs.finish(id)
+	return nil
+}
+
+// safeRun calls the runner, turning a panic into a job failure so one bad
+// deployment cannot take a worker down.
+func (q *Queue) safeRun(job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return q.runner(job)
+}
@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/redact"
+)
+
+// LogLine is a line of job output delivered to live subscribers.
+type LogLine struct {
+	Seq  int
+	Line string
+}
+
+// broker fans out live output of running jobs to subscribers.
+type broker struct {
+	mu   sync.Mutex
+	subs map[int64]map[chan LogLine]struct{}
+}
+
+var logs = &broker{subs: make(map[int64]map[chan LogLine]struct{})}
+
+// Subscribe returns a channel receiving the output of a running job as it is
+// produced, and a function to cancel the subscription. The channel is closed
+// when the job finishes. If the job is not running, the returned channel is
+// already closed.
+func Subscribe(jobID int64) (<-chan LogLine, func()) {
+	ch := make(chan LogLine, 256)
+
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+	if !running(jobID) {
+		close(ch)
+		return ch, func() {}
+	}
+	if logs.subs[jobID] == nil {
+		logs.subs[jobID] = make(map[chan LogLine]struct{})
+	}
+	logs.subs[jobID][ch] = struct{}{}
+
+	return ch, func() {
+		logs.mu.Lock()
+		defer logs.mu.Unlock()
+		if _, ok := logs.subs[jobID][ch]; ok {
+			delete(logs.subs[jobID], ch)
+			close(ch)
+		}
+	}
+}
+
+// running reports whether a job is still executing according to the database.
+func running(jobID int64) bool {
+	job, err := db.GetDeployJob(jobID)
+	return err == nil && job.FinishedAt == nil
+}
+
+func (b *broker) publish(jobID int64, line LogLine) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[jobID] {
+		select {
+		case ch <- line:
+		default:
+			// Slow subscriber; drop the line rather than stall the build.
+		}
+	}
+}
+
+func (b *broker) finish(jobID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[jobID] {
+		close(ch)
+	}
+	delete(b.subs, jobID)
+}
+
+// Write captures deployment output. Complete lines are stored in the job log
+// and published to live subscribers; a trailing partial line is buffered
+// until the next write or until the job finishes.
+func (j *Job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.partial = append(j.partial, p...)
+	for {
+		i := bytes.IndexByte(j.partial, '\n')
+		if i < 0 {
+			break
+		}
+		j.appendLine(string(j.partial[:i]))
+		j.partial = j.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Logf writes a formatted line to the job log.
+func (j *Job) Logf(format string, args ...interface{}) {
+	fmt.Fprintf(j, format+"\n", args...)
+}
+
+// flush stores any buffered partial line.
+func (j *Job) flush() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.partial) > 0 {
+		j.appendLine(string(j.partial))
+		j.partial = nil
+	}
+}
+
+// appendLine stores and publishes one line, with secret values masked. The
+// caller must hold j.mu.
+func (j *Job) appendLine(line string) {
+	line = strings.TrimRight(line, "\r")
+	// Progress bars redraw with carriage returns; keep only the final state.
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	line = redact.String(line)
+	j.seq++
+	if err := db.AppendDeployLog(j.ID, j.seq, line); err != nil {
+		fmt.Printf("Warning: failed to store log line for job %d: %v\n", j.ID, err)
+	}
+	logs.publish(j.ID, LogLine{Seq: j.seq, Line: line})
+}
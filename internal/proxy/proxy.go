@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// route forwards the connections accepted on one public port to its current target.
+type route struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	target string
+	active map[string]int // open connections per target address
+}
+
+var (
+	mu     sync.Mutex
+	routes = map[int]*route{}
+)
+
+// Set routes the TCP traffic of the public port to target (host:port). The
+// first call for a port starts listening on it; later calls switch the
+// target for new connections while open ones finish on the old target.
+func Set(port int, target string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if rt, ok := routes[port]; ok {
+		rt.mu.Lock()
+		rt.target = target
+		rt.mu.Unlock()
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %d: %w", port, err)
+	}
+	rt := &route{listener: listener, target: target, active: map[string]int{}}
+	routes[port] = rt
+	go rt.serve()
+	return nil
+}
+
+// Target returns the address the public port is routed to, or "" if the port is not proxied.
+func Target(port int) string {
+	mu.Lock()
+	rt, ok := routes[port]
+	mu.Unlock()
+	if !ok {
+		return ""
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.target
+}
+
+// Remove stops listening on the public port. Open connections are left to finish.
+func Remove(port int) {
+	mu.Lock()
+	defer mu.Unlock()
+	if rt, ok := routes[port]; ok {
+		rt.listener.Close()
+		delete(routes, port)
+	}
+}
+
+// Drain waits until the public port has no open connections to target, or
+// until timeout elapses. It reports whether all connections finished.
+func Drain(port int, target string, timeout time.Duration) bool {
+	mu.Lock()
+	rt, ok := routes[port]
+	mu.Unlock()
+	if !ok {
+		return true
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		rt.mu.Lock()
+		open := rt.active[target]
+		rt.mu.Unlock()
+		if open == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (rt *route) serve() {
+	for {
+		conn, err := rt.listener.Accept()
+		if err != nil {
+			return
+		}
+		go rt.forward(conn)
+	}
+}
+
+func (rt *route) forward(client net.Conn) {
+	defer client.Close()
+
+	rt.mu.Lock()
+	target := rt.target
+	rt.active[target]++
+	rt.mu.Unlock()
+	defer func() {
+		rt.mu.Lock()
+		rt.active[target]--
+		rt.mu.Unlock()
+	}()
+
+	upstream, err := net.DialTimeout("tcp", target, 5*time.Second)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, client)
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, upstream)
+		closeWrite(client)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+// closeWrite signals EOF to the peer while still allowing reads.
+func closeWrite(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+}
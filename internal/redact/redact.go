@@ -0,0 +1,127 @@
+package redact
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+)
+
+// Mask replaces a secret value.
+const Mask = "[redacted]"
+
+// Values shorter than minLength are not masked, so that secrets like "1" or
+// "true" do not garble unrelated output.
+const minLength = 4
+
+var (
+	mu       sync.Mutex
+	version  int64 = -1
+	replacer       = strings.NewReplacer()
+)
+
+// current returns the replacer for the stored secrets, rebuilt when they
+// change.
+func current() *strings.Replacer {
+	mu.Lock()
+	defer mu.Unlock()
+	if db.DB == nil {
+		return replacer
+	}
+	v := db.SecretsVersion()
+	if v == version {
+		return replacer
+	}
+	values, err := db.SecretValues()
+	if err != nil {
+		// Keep the previous values and retry on the next call
+		return replacer
+	}
+	replacer, version = newReplacer(values), v
+	return replacer
+}
+
+// newReplacer masks values and their JSON-escaped forms, longest first so
+// that a secret containing another is masked whole.
+func newReplacer(values []string) *strings.Replacer {
+	seen := make(map[string]bool)
+	var olds []string
+	for _, v := range values {
+		if len(v) < minLength {
+			continue
+		}
+		escaped, _ := json.Marshal(v)
+		for _, form := range []string{v, string(escaped[1 : len(escaped)-1])} {
+			if !seen[form] {
+				seen[form] = true
+				olds = append(olds, form)
+			}
+		}
+	}
+	sort.Slice(olds, func(i, j int) bool { return len(olds[i]) > len(olds[j]) })
+	pairs := make([]string, 0, 2*len(olds))
+	for _, old := range olds {
+		pairs = append(pairs, old, Mask)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// String masks the stored secret values in s.
+func String(s string) string {
+	return current().Replace(s)
+}
+
+// Middleware masks the stored secret values in the bodies of responses to
+// API requests, except for the paths in unmasked, which reveal secrets on
+// purpose.
+func Middleware(next http.Handler, unmasked ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, path := range unmasked {
+			if r.URL.Path == path {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(&responseWriter{ResponseWriter: w}, r)
+	})
+}
+
+// responseWriter masks each write. Handlers write JSON documents and
+// server-sent events whole, so a secret is not split across writes.
+type responseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		// Masking changes the length of the body
+		w.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if _, err := w.ResponseWriter.Write([]byte(String(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush lets server-sent event handlers flush through the writer.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -3,8 +3,9 @@ package stats
 import (
 	"os/exec"
 	"runtime"
-	"strconv"
 	"strings"
+
+	"github.com/prashanta0234/vpsmyth/internal/system"
 )
 
 // Stats represents the system and application statistics.
@@ -77,16 +78,12 @@ func getMemoryUsage() (string, error) {
 }
 
 func getActiveAppsCount() (int, error) {
-	// Count containers with label managed-by=vpsmyth
-	out, err := exec.Command("sh", "-c", "docker ps -q --filter \"label=managed-by=vpsmyth\" | wc -l").Output()
-	if err != nil {
-		return 0, err
-	}
-	count, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	// Count running containers with label managed-by=vpsmyth
+	containers, err := system.Runtime.List(system.ListOptions{Label: system.ManagedLabel})
 	if err != nil {
 		return 0, err
 	}
-	return count, nil
+	return len(containers), nil
 }
 
 func getUptime() (string, error) {
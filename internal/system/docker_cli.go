@@ -0,0 +1,327 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DockerCLI implements ContainerRuntime by invoking the docker binary.
+type DockerCLI struct{}
+
+// Build builds an image from a local build context.
+func (d *DockerCLI) Build(ctx context.Context, opts BuildOptions) error {
+	// --force-rm removes the intermediate containers of failed and cancelled builds
+	args := []string{"build", "--force-rm", "-t", opts.Tag}
+	if opts.Dockerfile != "" {
+		args = append(args, "-f", opts.Dockerfile)
+	}
+	if opts.Target != "" {
+		args = append(args, "--target", opts.Target)
+	}
+	for _, name := range sortedKeys(opts.BuildArgs) {
+		args = append(args, "--build-arg", name+"="+opts.BuildArgs[name])
+	}
+	// Secret values reach the CLI through its environment, not its arguments
+	var secretEnv []string
+	for i, id := range sortedKeys(opts.Secrets) {
+		env := fmt.Sprintf("VPSMYTH_BUILD_SECRET_%d", i)
+		args = append(args, "--secret", "id="+id+",env="+env)
+		secretEnv = append(secretEnv, env+"="+opts.Secrets[id])
+	}
+	args = append(args, opts.ContextDir)
+	cmd := CommandContext(ctx, "docker", args...)
+	if len(secretEnv) > 0 {
+		cmd.Env = append(append(os.Environ(), "DOCKER_BUILDKIT=1"), secretEnv...)
+	}
+	cmd.Stdout = opts.Output
+	cmd.Stderr = opts.Output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to build image %s: %w", opts.Tag, err)
+	}
+	return nil
+}
+
+// Pull pulls an image from its registry, writing progress to output if it is not nil.
+func (d *DockerCLI) Pull(ctx context.Context, image string, output io.Writer) error {
+	cmd := CommandContext(ctx, "docker", "pull", image)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	return nil
+}
+
+// Run creates and starts a detached container and returns its ID.
+func (d *DockerCLI) Run(opts RunOptions) (string, error) {
+	args := []string{"run", "-d", "--name", opts.Name}
+	for _, k := range sortedKeys(opts.Labels) {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", k, opts.Labels[k]))
+	}
+	for _, p := range opts.Ports {
+		args = append(args, "-p", formatPort(p))
+	}
+	if opts.Restart != "" {
+		args = append(args, "--restart", opts.Restart)
+	}
+	for _, v := range opts.Volumes {
+		args = append(args, "-v", v.Source+":"+v.Target)
+	}
+	if opts.Memory > 0 {
+		args = append(args, "--memory", strconv.FormatInt(opts.Memory, 10))
+	}
+	if opts.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(opts.CPUs, 'f', -1, 64))
+	}
+	for _, k := range sortedKeys(opts.Env) {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", k, opts.Env[k]))
+	}
+	args = append(args, opts.Image)
+
+	output, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to run container: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Start starts a stopped container.
+func (d *DockerCLI) Start(id string) error {
+	if err := exec.Command("docker", "start", id).Run(); err != nil {
+		return fmt.Errorf("failed to start container %s: %w", id, err)
+	}
+	return nil
+}
+
+// Stop stops a running container.
+func (d *DockerCLI) Stop(id string) error {
+	if err := exec.Command("docker", "stop", id).Run(); err != nil {
+		return fmt.Errorf("failed to stop container %s: %w", id, err)
+	}
+	return nil
+}
+
+// Restart restarts a container.
+func (d *DockerCLI) Restart(id string) error {
+	if err := exec.Command("docker", "restart", id).Run(); err != nil {
+		return fmt.Errorf("failed to restart container %s: %w", id, err)
+	}
+	return nil
+}
+
+// Remove removes a container. With force, a running container is killed first.
+func (d *DockerCLI) Remove(id string, force bool) error {
+	args := []string{"rm"}
+	if force {
+		args = append(args, "-f")
+	}
+	args = append(args, id)
+	if err := exec.Command("docker", args...).Run(); err != nil {
+		return fmt.Errorf("failed to delete container %s: %w", id, err)
+	}
+	return nil
+}
+
+// Logs returns the last tail lines of a container's output.
+func (d *DockerCLI) Logs(id string, tail int) (string, error) {
+	out, err := exec.Command("docker", "logs", "--tail", strconv.Itoa(tail), id).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to get logs for container %s: %w", id, err)
+	}
+	return string(out), nil
+}
+
+// Exec runs cmd inside a running container and returns its exit code and
+// combined output. The command is killed after timeout.
+func (d *DockerCLI) Exec(id string, cmd []string, timeout time.Duration) (int, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "docker", append([]string{"exec", id}, cmd...)...).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return exitErr.ExitCode(), string(out), nil
+	}
+	if err != nil {
+		return 0, string(out), fmt.Errorf("failed to exec in container %s: %w", id, err)
+	}
+	return 0, string(out), nil
+}
+
+// Inspect returns details about a single container.
+func (d *DockerCLI) Inspect(id string) (Container, error) {
+	out, err := exec.Command("docker", "inspect", "--type", "container", id).Output()
+	if err != nil {
+		return Container{}, fmt.Errorf("failed to inspect container %s: %w", id, err)
+	}
+
+	var details []struct {
+		ID     string `json:"Id"`
+		Name   string `json:"Name"`
+		Config struct {
+			Image  string            `json:"Image"`
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+		State struct {
+			Status  string `json:"Status"`
+			Running bool   `json:"Running"`
+		} `json:"State"`
+	}
+	if err := json.Unmarshal(out, &details); err != nil || len(details) == 0 {
+		return Container{}, fmt.Errorf("failed to parse inspect output for %s", id)
+	}
+
+	c := details[0]
+	return Container{
+		ID:      shortID(c.ID),
+		Name:    strings.TrimPrefix(c.Name, "/"),
+		Image:   c.Config.Image,
+		Status:  c.State.Status,
+		Running: c.State.Running,
+		Labels:  c.Config.Labels,
+	}, nil
+}
+
+// InspectImage returns details about a local image.
+func (d *DockerCLI) InspectImage(ref string) (Image, error) {
+	out, err := exec.Command("docker", "image", "inspect", ref).Output()
+	if err != nil {
+		return Image{}, fmt.Errorf("failed to inspect image %s: %w", ref, err)
+	}
+
+	var details []struct {
+		ID          string    `json:"Id"`
+		RepoTags    []string  `json:"RepoTags"`
+		RepoDigests []string  `json:"RepoDigests"`
+		Size        int64     `json:"Size"`
+		Created     time.Time `json:"Created"`
+	}
+	if err := json.Unmarshal(out, &details); err != nil || len(details) == 0 {
+		return Image{}, fmt.Errorf("failed to parse inspect output for %s", ref)
+	}
+
+	img := details[0]
+	return Image{ID: img.ID, Tags: img.RepoTags, RepoDigests: img.RepoDigests, Size: img.Size, Created: img.Created}, nil
+}
+
+// RemoveImage removes a local image tag.
+func (d *DockerCLI) RemoveImage(ref string) error {
+	if out, err := exec.Command("docker", "rmi", ref).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove image %s: %s: %w", ref, strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// List returns the containers matching opts.
+func (d *DockerCLI) List(opts ListOptions) ([]Container, error) {
+	// Format: ID|Names|Image|Status|Ports|State
+	args := []string{"ps"}
+	if opts.All {
+		args = append(args, "-a")
+	}
+	if opts.Label != "" {
+		args = append(args, "--filter", "label="+opts.Label)
+	}
+	args = append(args, "--format", "{{.ID}}|{{.Names}}|{{.Image}}|{{.Status}}|{{.Ports}}|{{.State}}")
+
+	out, err := exec.Command("docker", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	containers := []Container{}
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, "|")
+		if len(parts) < 6 {
+			continue
+		}
+
+		containers = append(containers, Container{
+			ID:           parts[0],
+			Name:         parts[1],
+			Image:        parts[2],
+			Status:       parts[3],
+			Ports:        parts[4],
+			PortBindings: parsePorts(parts[4]),
+			Running:      parts[5] == "running",
+		})
+	}
+
+	return containers, nil
+}
+
+var publishedPortRe = regexp.MustCompile(`^(?:(.*):)?(\d+)->(\d+)/(\w+)$`)
+
+// parsePorts parses the Ports column of docker ps,
+// e.g. "0.0.0.0:3000->3000/tcp, :::3000->3000/tcp". Unpublished ports are skipped.
+func parsePorts(s string) []Port {
+	var ports []Port
+	for _, field := range strings.Split(s, ",") {
+		m := publishedPortRe.FindStringSubmatch(strings.TrimSpace(field))
+		if m == nil {
+			continue
+		}
+		hostPort, _ := strconv.Atoi(m[2])
+		containerPort, _ := strconv.Atoi(m[3])
+		ports = append(ports, Port{HostIP: m[1], HostPort: hostPort, ContainerPort: containerPort, Protocol: m[4]})
+	}
+	return ports
+}
+
+// formatPorts renders ports the way docker ps prints them.
+func formatPorts(ports []Port) string {
+	parts := make([]string, 0, len(ports))
+	for _, p := range ports {
+		proto := p.Protocol
+		if proto == "" {
+			proto = "tcp"
+		}
+		if p.HostPort == 0 {
+			parts = append(parts, fmt.Sprintf("%d/%s", p.ContainerPort, proto))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d->%d/%s", p.HostIP, p.HostPort, p.ContainerPort, proto))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatPort(p Port) string {
+	s := fmt.Sprintf("%d:%d", p.HostPort, p.ContainerPort)
+	if p.HostIP != "" {
+		s = p.HostIP + ":" + s
+	}
+	if p.Protocol != "" && p.Protocol != "tcp" {
+		s += "/" + p.Protocol
+	}
+	return s
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shortID truncates a container ID to the 12-character form docker prints.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,609 @@
+package system
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDockerSocket is where the Docker daemon listens on most Linux hosts.
+const DefaultDockerSocket = "/var/run/docker.sock"
+
+// APIError is an error reported by the Docker daemon.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// DockerEngine implements ContainerRuntime by talking to the Docker Engine
+// HTTP API over a unix socket.
+type DockerEngine struct {
+	client *http.Client
+}
+
+// NewDockerEngine returns a client for the daemon listening on socketPath.
+func NewDockerEngine(socketPath string) *DockerEngine {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &DockerEngine{client: &http.Client{Transport: transport}}
+}
+
+// DetectRuntime returns a DockerEngine if a Docker socket is reachable and
+// falls back to the docker CLI otherwise. DOCKER_HOST=unix://... is honored.
+func DetectRuntime() ContainerRuntime {
+	socketPath := DefaultDockerSocket
+	if host := os.Getenv("DOCKER_HOST"); strings.HasPrefix(host, "unix://") {
+		socketPath = strings.TrimPrefix(host, "unix://")
+	}
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return &DockerCLI{}
+	}
+	conn.Close()
+	return NewDockerEngine(socketPath)
+}
+
+// do sends a request to the daemon and returns the response if it succeeded.
+// Non-2xx responses are turned into an *APIError carrying the daemon's message.
+func (d *DockerEngine) do(method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	return d.doContext(context.Background(), method, path, query, body, contentType)
+}
+
+// doContext is do with a context that bounds the whole request.
+func (d *DockerEngine) doContext(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	u := "http://docker" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to the Docker daemon: %w", err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	msg := strings.TrimSpace(string(data))
+	if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+		msg = apiErr.Message
+	}
+	if msg == "" {
+		msg = resp.Status
+	}
+	return nil, &APIError{StatusCode: resp.StatusCode, Message: msg}
+}
+
+// doJSON sends a request with an optional JSON body and decodes a JSON response into out.
+func (d *DockerEngine) doJSON(method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	resp, err := d.do(method, path, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// readProgress consumes a streamed JSON progress response (build, pull),
+// copying its text to out if it is not nil, and returns the first error the
+// daemon reported in it.
+func readProgress(r io.Reader, out io.Writer) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg struct {
+			Stream   string `json:"stream"`
+			Status   string `json:"status"`
+			ID       string `json:"id"`
+			Progress string `json:"progress"`
+			Error    string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if out != nil {
+			switch {
+			case msg.Stream != "":
+				io.WriteString(out, msg.Stream)
+			case msg.Status != "" && msg.Progress == "":
+				// Per-layer download progress is too noisy to keep.
+				if msg.ID != "" {
+					fmt.Fprintf(out, "%s: %s\n", msg.ID, msg.Status)
+				} else {
+					fmt.Fprintln(out, msg.Status)
+				}
+			}
+		}
+		if msg.Error != "" {
+			return &APIError{StatusCode: http.StatusOK, Message: strings.TrimSpace(msg.Error)}
+		}
+	}
+}
+
+// Build builds an image by uploading ContextDir as a tar archive. Builds
+// with secrets go through the docker CLI.
+func (d *DockerEngine) Build(ctx context.Context, opts BuildOptions) error {
+	if len(opts.Secrets) > 0 {
+		// Secrets are served over a BuildKit session, which the HTTP API
+		// alone cannot provide; the CLI does.
+		return (&DockerCLI{}).Build(ctx, opts)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeBuildContext(pw, opts.ContextDir, opts.Dockerfile))
+	}()
+
+	query := url.Values{"t": {opts.Tag}, "rm": {"1"}, "forcerm": {"1"}}
+	if opts.Dockerfile != "" {
+		query.Set("dockerfile", filepath.ToSlash(opts.Dockerfile))
+	}
+	if opts.Target != "" {
+		query.Set("target", opts.Target)
+	}
+	if len(opts.BuildArgs) > 0 {
+		buildArgs, _ := json.Marshal(opts.BuildArgs)
+		query.Set("buildargs", string(buildArgs))
+	}
+	// Closing the connection on cancellation stops the build in the daemon
+	resp, err := d.doContext(ctx, http.MethodPost, "/build", query, pr, "application/x-tar")
+	pr.Close()
+	if err != nil {
+		return fmt.Errorf("failed to build image %s: %w", opts.Tag, err)
+	}
+	defer resp.Body.Close()
+	if err := readProgress(resp.Body, opts.Output); err != nil {
+		return fmt.Errorf("failed to build image %s: %w", opts.Tag, err)
+	}
+	return nil
+}
+
+// Pull pulls an image from its registry, writing progress to output if it is not nil.
+func (d *DockerEngine) Pull(ctx context.Context, image string, output io.Writer) error {
+	name, tag := splitImageTag(image)
+	resp, err := d.doContext(ctx, http.MethodPost, "/images/create", url.Values{"fromImage": {name}, "tag": {tag}}, nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	defer resp.Body.Close()
+	if err := readProgress(resp.Body, output); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	return nil
+}
+
+type portBinding struct {
+	HostIP   string `json:"HostIp"`
+	HostPort string `json:"HostPort"`
+}
+
+// Run creates and starts a container and returns its ID.
+func (d *DockerEngine) Run(opts RunOptions) (string, error) {
+	env := make([]string, 0, len(opts.Env))
+	for _, k := range sortedKeys(opts.Env) {
+		env = append(env, k+"="+opts.Env[k])
+	}
+	exposed := make(map[string]struct{})
+	bindings := make(map[string][]portBinding)
+	for _, p := range opts.Ports {
+		proto := p.Protocol
+		if proto == "" {
+			proto = "tcp"
+		}
+		key := fmt.Sprintf("%d/%s", p.ContainerPort, proto)
+		exposed[key] = struct{}{}
+		bindings[key] = append(bindings[key], portBinding{HostIP: p.HostIP, HostPort: strconv.Itoa(p.HostPort)})
+	}
+
+	binds := make([]string, 0, len(opts.Volumes))
+	for _, v := range opts.Volumes {
+		binds = append(binds, v.Source+":"+v.Target)
+	}
+
+	body := map[string]interface{}{
+		"Image":        opts.Image,
+		"Env":          env,
+		"Labels":       opts.Labels,
+		"ExposedPorts": exposed,
+		"HostConfig": map[string]interface{}{
+			"PortBindings":  bindings,
+			"RestartPolicy": map[string]string{"Name": opts.Restart},
+			"Binds":         binds,
+			"Memory":        opts.Memory,
+			"NanoCpus":      int64(opts.CPUs * 1e9),
+		},
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := d.doJSON(http.MethodPost, "/containers/create", url.Values{"name": {opts.Name}}, body, &created); err != nil {
+		return "", fmt.Errorf("failed to run container: %w", err)
+	}
+	if err := d.doJSON(http.MethodPost, "/containers/"+created.ID+"/start", nil, nil, nil); err != nil {
+		return "", fmt.Errorf("failed to run container: %w", err)
+	}
+	return created.ID, nil
+}
+
+// Start starts a stopped container.
+func (d *DockerEngine) Start(id string) error {
+	if err := d.doJSON(http.MethodPost, "/containers/"+url.PathEscape(id)+"/start", nil, nil, nil); err != nil {
+		return fmt.Errorf("failed to start container %s: %w", id, err)
+	}
+	return nil
+}
+
+// Stop stops a running container.
+func (d *DockerEngine) Stop(id string) error {
+	if err := d.doJSON(http.MethodPost, "/containers/"+url.PathEscape(id)+"/stop", nil, nil, nil); err != nil {
+		return fmt.Errorf("failed to stop container %s: %w", id, err)
+	}
+	return nil
+}
+
+// Restart restarts a container.
+func (d *DockerEngine) Restart(id string) error {
+	if err := d.doJSON(http.MethodPost, "/containers/"+url.PathEscape(id)+"/restart", nil, nil, nil); err != nil {
+		return fmt.Errorf("failed to restart container %s: %w", id, err)
+	}
+	return nil
+}
+
+// Remove removes a container. With force, a running container is killed first.
+func (d *DockerEngine) Remove(id string, force bool) error {
+	query := url.Values{"force": {strconv.FormatBool(force)}}
+	if err := d.doJSON(http.MethodDelete, "/containers/"+url.PathEscape(id), query, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete container %s: %w", id, err)
+	}
+	return nil
+}
+
+// Logs returns the last tail lines of a container's stdout and stderr.
+func (d *DockerEngine) Logs(id string, tail int) (string, error) {
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}, "tail": {strconv.Itoa(tail)}}
+	resp, err := d.do(http.MethodGet, "/containers/"+url.PathEscape(id)+"/logs", query, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to get logs for container %s: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to get logs for container %s: %w", id, err)
+	}
+	return demuxLogs(data), nil
+}
+
+// Exec runs cmd inside a running container and returns its exit code and
+// combined output. The command is abandoned after timeout.
+func (d *DockerEngine) Exec(id string, cmd []string, timeout time.Duration) (int, string, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	in := map[string]interface{}{"AttachStdout": true, "AttachStderr": true, "Cmd": cmd}
+	if err := d.doJSON(http.MethodPost, "/containers/"+url.PathEscape(id)+"/exec", nil, in, &created); err != nil {
+		return 0, "", fmt.Errorf("failed to exec in container %s: %w", id, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start, _ := json.Marshal(map[string]bool{"Detach": false, "Tty": false})
+	resp, err := d.doContext(ctx, http.MethodPost, "/exec/"+created.ID+"/start", nil, bytes.NewReader(start), "application/json")
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to exec in container %s: %w", id, err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to exec in container %s: %w", id, err)
+	}
+
+	var inspect struct {
+		ExitCode int
+	}
+	if err := d.doJSON(http.MethodGet, "/exec/"+created.ID+"/json", nil, nil, &inspect); err != nil {
+		return 0, "", fmt.Errorf("failed to exec in container %s: %w", id, err)
+	}
+	return inspect.ExitCode, demuxLogs(data), nil
+}
+
+// demuxLogs strips the 8-byte stream headers Docker adds to the logs of
+// containers started without a TTY. TTY logs are returned unchanged.
+func demuxLogs(data []byte) string {
+	var out bytes.Buffer
+	rest := data
+	for len(rest) >= 8 {
+		stream := rest[0]
+		if stream > 2 || rest[1] != 0 || rest[2] != 0 || rest[3] != 0 {
+			return string(data)
+		}
+		size := int(binary.BigEndian.Uint32(rest[4:8]))
+		if len(rest) < 8+size {
+			return string(data)
+		}
+		out.Write(rest[8 : 8+size])
+		rest = rest[8+size:]
+	}
+	if len(rest) != 0 {
+		return string(data)
+	}
+	return out.String()
+}
+
+type engineInspect struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	State struct {
+		Status  string `json:"Status"`
+		Running bool   `json:"Running"`
+	} `json:"State"`
+	NetworkSettings struct {
+		Ports map[string][]portBinding `json:"Ports"`
+	} `json:"NetworkSettings"`
+}
+
+// Inspect returns details about a single container.
+func (d *DockerEngine) Inspect(id string) (Container, error) {
+	var info engineInspect
+	if err := d.doJSON(http.MethodGet, "/containers/"+url.PathEscape(id)+"/json", nil, nil, &info); err != nil {
+		return Container{}, fmt.Errorf("failed to inspect container %s: %w", id, err)
+	}
+
+	var ports []Port
+	for key, bindings := range info.NetworkSettings.Ports {
+		portStr, proto, _ := strings.Cut(key, "/")
+		containerPort, _ := strconv.Atoi(portStr)
+		for _, b := range bindings {
+			hostPort, _ := strconv.Atoi(b.HostPort)
+			ports = append(ports, Port{HostIP: b.HostIP, HostPort: hostPort, ContainerPort: containerPort, Protocol: proto})
+		}
+	}
+
+	return Container{
+		ID:           shortID(info.ID),
+		Name:         strings.TrimPrefix(info.Name, "/"),
+		Image:        info.Config.Image,
+		Status:       info.State.Status,
+		Ports:        formatPorts(ports),
+		PortBindings: ports,
+		Running:      info.State.Running,
+		Labels:       info.Config.Labels,
+	}, nil
+}
+
+// RemoveImage removes a local image tag.
+func (d *DockerEngine) RemoveImage(ref string) error {
+	if err := d.doJSON(http.MethodDelete, "/images/"+url.PathEscape(ref), nil, nil, nil); err != nil {
+		return fmt.Errorf("failed to remove image %s: %w", ref, err)
+	}
+	return nil
+}
+
+// InspectImage returns details about a local image.
+func (d *DockerEngine) InspectImage(ref string) (Image, error) {
+	var info struct {
+		ID          string   `json:"Id"`
+		RepoTags    []string `json:"RepoTags"`
+		RepoDigests []string `json:"RepoDigests"`
+		Size        int64    `json:"Size"`
+		Created     string   `json:"Created"`
+	}
+	if err := d.doJSON(http.MethodGet, "/images/"+url.PathEscape(ref)+"/json", nil, nil, &info); err != nil {
+		return Image{}, fmt.Errorf("failed to inspect image %s: %w", ref, err)
+	}
+	created, _ := time.Parse(time.RFC3339Nano, info.Created)
+	return Image{
+		ID:          info.ID,
+		Tags:        info.RepoTags,
+		RepoDigests: info.RepoDigests,
+		Size:        info.Size,
+		Created:     created,
+	}, nil
+}
+
+// List returns the containers matching opts.
+func (d *DockerEngine) List(opts ListOptions) ([]Container, error) {
+	query := url.Values{"all": {strconv.FormatBool(opts.All)}}
+	if opts.Label != "" {
+		filters, _ := json.Marshal(map[string][]string{"label": {opts.Label}})
+		query.Set("filters", string(filters))
+	}
+
+	var items []struct {
+		ID     string            `json:"Id"`
+		Names  []string          `json:"Names"`
+		Image  string            `json:"Image"`
+		State  string            `json:"State"`
+		Status string            `json:"Status"`
+		Labels map[string]string `json:"Labels"`
+		Ports  []struct {
+			IP          string `json:"IP"`
+			PrivatePort int    `json:"PrivatePort"`
+			PublicPort  int    `json:"PublicPort"`
+			Type        string `json:"Type"`
+		} `json:"Ports"`
+	}
+	if err := d.doJSON(http.MethodGet, "/containers/json", query, nil, &items); err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	containers := make([]Container, 0, len(items))
+	for _, item := range items {
+		name := ""
+		if len(item.Names) > 0 {
+			name = strings.TrimPrefix(item.Names[0], "/")
+		}
+		var ports []Port
+		for _, p := range item.Ports {
+			ports = append(ports, Port{HostIP: p.IP, HostPort: p.PublicPort, ContainerPort: p.PrivatePort, Protocol: p.Type})
+		}
+		containers = append(containers, Container{
+			ID:           shortID(item.ID),
+			Name:         name,
+			Image:        item.Image,
+			Status:       item.Status,
+			Ports:        formatPorts(ports),
+			PortBindings: ports,
+			Running:      item.State == "running",
+			Labels:       item.Labels,
+		})
+	}
+	return containers, nil
+}
+
+// splitImageTag splits "name:tag" into its parts, defaulting the tag to latest.
+// Registry hosts with ports (host:5000/name) and digests are handled.
+func splitImageTag(image string) (string, string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i], image[i+1:]
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return image, "latest"
+	}
+	return image[:i], image[i+1:]
+}
+
+// writeBuildContext writes contextDir to w as a tar archive, skipping entries
+// matched by the context's .dockerignore. The Dockerfile is always included.
+func writeBuildContext(w io.Writer, contextDir, dockerfile string) error {
+	ignore := readDockerignore(contextDir)
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	dockerfile = filepath.ToSlash(filepath.Clean(dockerfile))
+
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(contextDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(contextDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != dockerfile && ignored(ignore, rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func readDockerignore(contextDir string) []string {
+	f, err := os.Open(filepath.Join(contextDir, ".dockerignore"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		patterns = append(patterns, strings.Trim(filepath.ToSlash(line), "/"))
+	}
+	return patterns
+}
+
+func ignored(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, rel); ok {
+			return true
+		}
+		// A pattern naming a directory excludes everything below it.
+		if strings.HasPrefix(rel, p+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,352 @@
+package system
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeRuntime is an in-memory ContainerRuntime for tests. It keeps track of
+// built or pulled images and of the containers created from them, without
+// talking to a Docker daemon.
+type FakeRuntime struct {
+	mu         sync.Mutex
+	nextID     int
+	images     map[string]bool
+	containers map[string]*Container
+	logs       map[string]string
+	listeners  map[string][]net.Listener
+
+	// Calls records every operation in the form "op target".
+	Calls []string
+	// Builds records the options of every Build call, without Output.
+	Builds []BuildOptions
+	// Runs records the options of every successful Run call.
+	Runs []RunOptions
+	// BuildDelay makes builds take this long, or until they are cancelled.
+	BuildDelay time.Duration
+	// BuildErr, PullErr and RunErr, when set, are returned by the matching operation.
+	BuildErr error
+	PullErr  error
+	RunErr   error
+	// ServePorts makes running containers accept connections on their
+	// published host ports and answer HTTP requests with their name.
+	ServePorts bool
+	// Unhealthy lists images whose containers run but never accept connections.
+	Unhealthy map[string]bool
+	// ExecFunc, when set, answers Exec calls; by default commands exit with 0.
+	ExecFunc func(name string, cmd []string) (int, string)
+}
+
+// NewFakeRuntime returns an empty FakeRuntime.
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		images:     make(map[string]bool),
+		containers: make(map[string]*Container),
+		logs:       make(map[string]string),
+		listeners:  make(map[string][]net.Listener),
+		Unhealthy:  make(map[string]bool),
+	}
+}
+
+// HasImage reports whether an image with the given reference was built or pulled.
+func (f *FakeRuntime) HasImage(ref string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.images[ref]
+}
+
+// SetLogs sets the output returned by Logs for the named container.
+func (f *FakeRuntime) SetLogs(name, logs string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logs[name] = logs
+}
+
+func (f *FakeRuntime) record(op, target string) {
+	f.Calls = append(f.Calls, op+" "+target)
+}
+
+// lookup finds a container by name or ID prefix. The caller must hold f.mu.
+func (f *FakeRuntime) lookup(id string) (*Container, error) {
+	if c, ok := f.containers[id]; ok {
+		return c, nil
+	}
+	for _, c := range f.containers {
+		if id != "" && strings.HasPrefix(c.ID, id) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("no such container: %s", id)
+}
+
+func (f *FakeRuntime) Build(ctx context.Context, opts BuildOptions) error {
+	f.mu.Lock()
+	f.record("build", opts.Tag)
+	recorded := opts
+	recorded.Output = nil
+	f.Builds = append(f.Builds, recorded)
+	if opts.Output != nil {
+		fmt.Fprintf(opts.Output, "Building %s from %s\n", opts.Tag, opts.ContextDir)
+	}
+	delay := f.BuildDelay
+	f.mu.Unlock()
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return fmt.Errorf("failed to build image %s: %w", opts.Tag, ctx.Err())
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.BuildErr != nil {
+		return f.BuildErr
+	}
+	f.images[opts.Tag] = true
+	return nil
+}
+
+func (f *FakeRuntime) Pull(ctx context.Context, image string, output io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("pull", image)
+	if output != nil {
+		fmt.Fprintf(output, "Pulling %s\n", image)
+	}
+	if f.PullErr != nil {
+		return f.PullErr
+	}
+	f.images[image] = true
+	return nil
+}
+
+func (f *FakeRuntime) Run(opts RunOptions) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("run", opts.Name)
+	if f.RunErr != nil {
+		return "", f.RunErr
+	}
+	if !f.images[opts.Image] {
+		return "", fmt.Errorf("no such image: %s", opts.Image)
+	}
+	if _, exists := f.containers[opts.Name]; exists {
+		return "", fmt.Errorf("container name %s is already in use", opts.Name)
+	}
+	f.Runs = append(f.Runs, opts)
+
+	f.nextID++
+	labels := make(map[string]string, len(opts.Labels))
+	for k, v := range opts.Labels {
+		labels[k] = v
+	}
+	ports := append([]Port(nil), opts.Ports...)
+	for i := range ports {
+		if ports[i].HostIP == "" {
+			ports[i].HostIP = "0.0.0.0"
+		}
+	}
+	c := &Container{
+		ID:           fmt.Sprintf("%064x", f.nextID),
+		Name:         opts.Name,
+		Image:        opts.Image,
+		Status:       "running",
+		Ports:        formatPorts(ports),
+		PortBindings: ports,
+		Running:      true,
+		Labels:       labels,
+	}
+	f.containers[opts.Name] = c
+	if err := f.serve(c); err != nil {
+		delete(f.containers, opts.Name)
+		return "", err
+	}
+	return c.ID, nil
+}
+
+// serve listens on the published ports of c when ServePorts is set. The
+// caller must hold f.mu.
+func (f *FakeRuntime) serve(c *Container) error {
+	if !f.ServePorts || f.Unhealthy[c.Image] || len(f.listeners[c.Name]) > 0 {
+		return nil
+	}
+	for _, p := range c.PortBindings {
+		l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", p.HostIP, p.HostPort))
+		if err != nil {
+			f.unserve(c.Name)
+			return fmt.Errorf("port %d is already allocated: %w", p.HostPort, err)
+		}
+		f.listeners[c.Name] = append(f.listeners[c.Name], l)
+		go acceptFake(l, c.Name)
+	}
+	return nil
+}
+
+// unserve closes the listeners of the named container. The caller must hold f.mu.
+func (f *FakeRuntime) unserve(name string) {
+	for _, l := range f.listeners[name] {
+		l.Close()
+	}
+	delete(f.listeners, name)
+}
+
+func acceptFake(l net.Listener, name string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == "\r\n" || line == "\n" {
+					break
+				}
+			}
+			fmt.Fprintf(conn, "HTTP/1.0 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(name), name)
+		}()
+	}
+}
+
+func (f *FakeRuntime) Start(id string) error {
+	return f.setRunning("start", id, true)
+}
+
+func (f *FakeRuntime) Stop(id string) error {
+	return f.setRunning("stop", id, false)
+}
+
+func (f *FakeRuntime) Restart(id string) error {
+	return f.setRunning("restart", id, true)
+}
+
+func (f *FakeRuntime) setRunning(op, id string, running bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record(op, id)
+	c, err := f.lookup(id)
+	if err != nil {
+		return err
+	}
+	c.Running = running
+	if running {
+		c.Status = "running"
+		return f.serve(c)
+	}
+	c.Status = "exited"
+	f.unserve(c.Name)
+	return nil
+}
+
+func (f *FakeRuntime) Remove(id string, force bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("remove", id)
+	c, err := f.lookup(id)
+	if err != nil {
+		return err
+	}
+	if c.Running && !force {
+		return fmt.Errorf("cannot remove running container %s", id)
+	}
+	f.unserve(c.Name)
+	delete(f.containers, c.Name)
+	return nil
+}
+
+func (f *FakeRuntime) Logs(id string, tail int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.lookup(id)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(f.logs[c.Name], "\n")
+	if tail > 0 && len(lines) > tail {
+		lines = lines[len(lines)-tail:]
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (f *FakeRuntime) Exec(id string, cmd []string, timeout time.Duration) (int, string, error) {
+	f.mu.Lock()
+	f.record("exec", id)
+	c, err := f.lookup(id)
+	if err != nil {
+		f.mu.Unlock()
+		return 0, "", err
+	}
+	name, running, execFunc := c.Name, c.Running, f.ExecFunc
+	f.mu.Unlock()
+
+	if !running {
+		return 0, "", fmt.Errorf("container %s is not running", id)
+	}
+	if execFunc == nil {
+		return 0, "", nil
+	}
+	code, out := execFunc(name, cmd)
+	return code, out, nil
+}
+
+func (f *FakeRuntime) Inspect(id string) (Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.lookup(id)
+	if err != nil {
+		return Container{}, err
+	}
+	return *c, nil
+}
+
+func (f *FakeRuntime) RemoveImage(ref string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("rmi", ref)
+	if !f.images[ref] {
+		return fmt.Errorf("no such image: %s", ref)
+	}
+	delete(f.images, ref)
+	return nil
+}
+
+func (f *FakeRuntime) InspectImage(ref string) (Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.images[ref] {
+		return Image{}, fmt.Errorf("no such image: %s", ref)
+	}
+	return Image{ID: "sha256:" + fmt.Sprintf("%064x", len(ref)), Tags: []string{ref}}, nil
+}
+
+func (f *FakeRuntime) List(opts ListOptions) ([]Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("list", opts.Label)
+
+	key, value, _ := strings.Cut(opts.Label, "=")
+	containers := []Container{}
+	for _, c := range f.containers {
+		if !opts.All && !c.Running {
+			continue
+		}
+		if key != "" && c.Labels[key] != value {
+			continue
+		}
+		containers = append(containers, *c)
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+	return containers, nil
+}
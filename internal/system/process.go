@@ -0,0 +1,21 @@
+package system
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// commandWaitDelay bounds how long a cancelled command may keep its output
+// pipes open, e.g. through a grandchild that survived the kill.
+const commandWaitDelay = 5 * time.Second
+
+// CommandContext is exec.CommandContext for long-running steps: the command
+// runs in its own process group, and cancelling ctx kills the whole group,
+// so children like npm or git-remote-https do not outlive it.
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	killProcessGroup(cmd)
+	cmd.WaitDelay = commandWaitDelay
+	return cmd
+}
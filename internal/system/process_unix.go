@@ -0,0 +1,17 @@
+//go:build !windows
+
+package system
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup starts cmd as the leader of a new process group and makes
+// cancellation kill the group.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package system
+
+import "os/exec"
+
+// killProcessGroup keeps the default cancellation on Windows, which kills
+// the process itself; there are no process groups to signal.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,96 @@
+package system
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Every container VPSMyth creates carries the label managed-by=vpsmyth.
+const (
+	ManagedLabelKey   = "managed-by"
+	ManagedLabelValue = "vpsmyth"
+	ManagedLabel      = ManagedLabelKey + "=" + ManagedLabelValue
+)
+
+// ManagedLabels returns a fresh label set marking a container as managed by VPSMyth.
+func ManagedLabels() map[string]string {
+	return map[string]string{ManagedLabelKey: ManagedLabelValue}
+}
+
+// Port describes a container port published on the host.
+type Port struct {
+	HostIP        string `json:"hostIP,omitempty"`
+	HostPort      int    `json:"hostPort"`
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+// Image describes a local container image.
+type Image struct {
+	ID          string    `json:"id"`
+	Tags        []string  `json:"tags"`
+	RepoDigests []string  `json:"repoDigests"`
+	Size        int64     `json:"size"`
+	Created     time.Time `json:"created"`
+}
+
+// BuildOptions describes an image build.
+type BuildOptions struct {
+	Tag        string
+	ContextDir string
+	Dockerfile string            // optional, relative to ContextDir
+	BuildArgs  map[string]string // optional, values for ARG instructions
+	Secrets    map[string]string // optional, BuildKit secrets by id, for RUN --mount=type=secret
+	Target     string            // optional, stage of a multi-stage Dockerfile to build
+	Output     io.Writer         // optional, receives the build output
+}
+
+// RunOptions describes a container to create and start.
+type RunOptions struct {
+	Name    string
+	Image   string
+	Env     map[string]string
+	Ports   []Port
+	Labels  map[string]string
+	Restart string // e.g. "always"; empty means no restart policy
+
+	Volumes []Volume // optional, named volumes mounted into the container
+	Memory  int64    // optional, memory limit in bytes
+	CPUs    float64  // optional, number of CPUs the container may use
+}
+
+// Volume mounts the named volume Source at Target inside a container.
+type Volume struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// ListOptions filters the containers returned by List.
+type ListOptions struct {
+	All   bool   // include stopped containers
+	Label string // e.g. "managed-by=vpsmyth"
+}
+
+// ContainerRuntime is the set of container operations VPSMyth relies on.
+// Implementations must be safe for concurrent use.
+type ContainerRuntime interface {
+	// Build and Pull stop when ctx is cancelled.
+	Build(ctx context.Context, opts BuildOptions) error
+	Pull(ctx context.Context, image string, output io.Writer) error
+	Run(opts RunOptions) (string, error)
+	Start(id string) error
+	Stop(id string) error
+	Restart(id string) error
+	Remove(id string, force bool) error
+	Logs(id string, tail int) (string, error)
+	Exec(id string, cmd []string, timeout time.Duration) (int, string, error)
+	Inspect(id string) (Container, error)
+	InspectImage(ref string) (Image, error)
+	RemoveImage(ref string) error
+	List(opts ListOptions) ([]Container, error)
+}
+
+// Runtime is the container runtime used by the rest of VPSMyth.
+// It defaults to the docker CLI and can be replaced, e.g. in tests.
+var Runtime ContainerRuntime = &DockerCLI{}
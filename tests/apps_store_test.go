@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/system"
+)
+
+func TestImportMetadataFiles(t *testing.T) {
+	initTestDB(t, "test_apps_store.db")
+	fake := useFakeRuntime(t)
+
+	os.MkdirAll("deployments", 0755)
+	legacy := filepath.Join("deployments", "legacy-app.json")
+	os.WriteFile(legacy, []byte(`{
+  "app_name": "Legacy App",
+  "port": 4100,
+  "env": {"MODE": "prod"},
+  "repo_url": "https://example.com/legacy.git",
+  "framework": "nodejs",
+  "image": "vpsmyth/legacy-app:r3",
+  "release": 3,
+  "health_check": {"type": "tcp"},
+  "build": {"rootDir": "web"}
+}`), 0644)
+	defer os.Remove(legacy + ".imported")
+	defer deploy.DeleteApp("legacy-app")
+
+	n, err := deploy.ImportMetadataFiles()
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 imported app, got %d (%v)", n, err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("expected the metadata file to be renamed")
+	}
+	if n, _ := deploy.ImportMetadataFiles(); n != 0 {
+		t.Errorf("expected the import to run once, got %d", n)
+	}
+
+	app, err := deploy.GetApp("legacy-app")
+	if err != nil {
+		t.Fatalf("GetApp failed: %v", err)
+	}
+	if app.AppName != "Legacy App" || app.Port != 4100 || app.Env["MODE"] != "prod" || app.Release != 3 ||
+		app.HealthCheck == nil || app.HealthCheck.Type != "tcp" || app.Build.RootDir != "web" {
+		t.Errorf("unexpected imported app %+v", app)
+	}
+
+	// Stored apps are reconciled with the managed containers
+	apps, err := deploy.ListApps()
+	if err != nil || len(apps) != 1 || apps[0].Status != deploy.StatusMissing {
+		t.Fatalf("expected the app without a container to be missing, got %+v (%v)", apps, err)
+	}
+	fake.Pull(context.Background(), "vpsmyth/legacy-app:r3", nil)
+	fake.Run(system.RunOptions{Name: "legacy-app", Image: "vpsmyth/legacy-app:r3", Labels: system.ManagedLabels()})
+	fake.Run(system.RunOptions{Name: "orphan", Image: "vpsmyth/legacy-app:r3", Labels: system.ManagedLabels(),
+		Ports: []system.Port{{HostPort: 4200, ContainerPort: 4200}}})
+	defer fake.Remove("orphan", true)
+	apps, _ = deploy.ListApps()
+	if len(apps) != 2 || apps[0].AppName != "Legacy App" || apps[0].ContainerID == "" || apps[0].Status == deploy.StatusMissing ||
+		apps[1].AppName != "orphan" || apps[1].Port != 4200 {
+		t.Errorf("unexpected app list %+v", apps)
+	}
+
+	// Deleting the app removes it with its env vars
+	deploy.DeleteApp("legacy-app")
+	if _, err := deploy.GetApp("legacy-app"); err == nil {
+		t.Error("expected the app to be deleted")
+	}
+	var envRows int
+	db.DB.QueryRow("SELECT COUNT(*) FROM app_env WHERE app_name = 'legacy-app'").Scan(&envRows)
+	if envRows != 0 {
+		t.Errorf("expected the env vars to be deleted, found %d", envRows)
+	}
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/proxy"
+)
+
+// testReporter collects deployment output.
+type testReporter struct {
+	strings.Builder
+	states []string
+}
+
+func (r *testReporter) SetState(state string) {
+	r.states = append(r.states, state)
+}
+
+func freeTestPort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// serving returns the body served on the public port, or "" if nothing answers.
+func serving(port int) string {
+	resp, err := http.Get("http://127.0.0.1:" + strconv.Itoa(port))
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestBlueGreenDeploy(t *testing.T) {
+	initTestDB(t, "test_bluegreen.db")
+	fake := useFakeRuntime(t)
+	fake.ServePorts = true
+	t.Setenv("VPSMYTH_HEALTH_TIMEOUT", "1")
+	t.Setenv("VPSMYTH_DRAIN_TIMEOUT", "1")
+	defer os.Remove("deployments/bg-app.json")
+
+	port := freeTestPort(t)
+	spec := deploy.Spec{AppName: "bg-app", ImageName: "nginx:1", Port: port, Strategy: deploy.StrategyBlueGreen}
+
+	if err := deploy.DeployImage(spec, &testReporter{}); err != nil {
+		t.Fatalf("first deploy failed: %v", err)
+	}
+	if got := serving(port); got != "bg-app-blue" {
+		t.Fatalf("expected blue to serve, got %q", got)
+	}
+
+	spec.ImageName = "nginx:2"
+	if err := deploy.DeployImage(spec, &testReporter{}); err != nil {
+		t.Fatalf("second deploy failed: %v", err)
+	}
+	if got := serving(port); got != "bg-app-green" {
+		t.Errorf("expected green to serve, got %q", got)
+	}
+	if _, err := fake.Inspect("bg-app-blue"); err == nil {
+		t.Error("expected the blue container to be retired")
+	}
+
+	// A release whose container never becomes healthy must not take over.
+	fake.Unhealthy["nginx:3"] = true
+	spec.ImageName = "nginx:3"
+	rep := &testReporter{}
+	if err := deploy.DeployImage(spec, rep); err == nil {
+		t.Fatal("expected unhealthy deploy to fail")
+	}
+	if got := serving(port); got != "bg-app-green" {
+		t.Errorf("expected green to keep serving, got %q", got)
+	}
+	if _, err := fake.Inspect("bg-app-blue"); err == nil {
+		t.Error("expected the unhealthy container to be removed")
+	}
+	if releases, _ := deploy.ListReleases("bg-app"); releases[0].Status != deploy.ReleaseFailed {
+		t.Errorf("expected failed release, got %+v", releases[0])
+	}
+
+	// Env changes go through the same switch.
+	if err := deploy.UpdateAppEnv("bg-app", map[string]string{"A": "1"}); err != nil {
+		t.Fatalf("UpdateAppEnv failed: %v", err)
+	}
+	if got := serving(port); got != "bg-app-blue" {
+		t.Errorf("expected blue to serve after env change, got %q", got)
+	}
+
+	apps, _ := deploy.ListApps()
+	if len(apps) != 1 || apps[0].AppName != "bg-app" || apps[0].Port != port {
+		t.Errorf("unexpected apps: %+v", apps)
+	}
+
+	if err := deploy.DeleteApp("bg-app"); err != nil {
+		t.Fatalf("DeleteApp failed: %v", err)
+	}
+	if proxy.Target(port) != "" || serving(port) != "" {
+		t.Error("expected the proxy to stop after delete")
+	}
+}
+
+func TestBlueGreenSwitchKeepsLegacyContainerWhenProxyFails(t *testing.T) {
+	initTestDB(t, "test_bluegreen_legacy.db")
+	fake := useFakeRuntime(t)
+	t.Setenv("VPSMYTH_HEALTH_TIMEOUT", "1")
+
+	port := freeTestPort(t)
+	spec := deploy.Spec{AppName: "bg-legacy", ImageName: "nginx:1", Port: port}
+	if err := deploy.DeployImage(spec, &testReporter{}); err != nil {
+		t.Fatalf("recreate deploy failed: %v", err)
+	}
+	defer deploy.DeleteApp("bg-legacy")
+
+	// Something else grabs the public port, so the proxy cannot listen on it
+	blocker, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blocker.Close()
+	fake.ServePorts = true
+
+	spec.ImageName, spec.Strategy = "nginx:2", deploy.StrategyBlueGreen
+	if err := deploy.DeployImage(spec, &testReporter{}); err == nil || !strings.Contains(err.Error(), "failed to listen") {
+		t.Fatalf("expected the switch to fail on the proxy, got %v", err)
+	}
+	if c, err := fake.Inspect("bg-legacy"); err != nil || !c.Running {
+		t.Errorf("expected the recreate container to be restarted, got %+v, %v", c, err)
+	}
+	if _, err := fake.Inspect("bg-legacy-blue"); err == nil {
+		t.Error("expected the new container to be removed")
+	}
+	if proxy.Target(port) != "" {
+		t.Error("expected no proxy route")
+	}
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+)
+
+func TestBuildArgsAndSecrets(t *testing.T) {
+	initTestDB(t, "test_buildenv.db")
+	fake := useFakeRuntime(t)
+
+	src := t.TempDir()
+	gitRepo(t, src, "init", "-q", "-b", "main")
+	commitFile(t, src, "package.json", `{"dependencies": {"next": "14"}}`, "init")
+
+	spec := deploy.Spec{AppName: "build-env-app", RepoURL: src, Port: freeTestPort(t),
+		Env: map[string]string{"NEXT_PUBLIC_API_URL": "https://api.example.com", "NPM_TOKEN": "npm_secret", "DATABASE_URL": "postgres://db"},
+		EnvOptions: map[string]deploy.EnvVarOptions{
+			"NEXT_PUBLIC_API_URL": {Scope: deploy.EnvScopeBoth},
+			"NPM_TOKEN":           {Scope: deploy.EnvScopeBuild, Secret: true},
+		},
+		Build: deploy.BuildSettings{BuildArgs: map[string]string{"APP_VERSION": "1.2.3"}},
+	}
+	if err := deploy.ValidateEnvOptions(spec.Env, spec.EnvOptions); err != nil {
+		t.Fatalf("valid env options rejected: %v", err)
+	}
+	if err := deploy.DeployGit(spec, &testReporter{}); err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	defer deploy.DeleteApp("build-env-app")
+
+	build := fake.Builds[len(fake.Builds)-1]
+	if build.BuildArgs["NEXT_PUBLIC_API_URL"] != "https://api.example.com" || build.BuildArgs["APP_VERSION"] != "1.2.3" || len(build.BuildArgs) != 2 {
+		t.Errorf("unexpected build args %v", build.BuildArgs)
+	}
+	if build.Secrets["NPM_TOKEN"] != "npm_secret" || len(build.Secrets) != 1 {
+		t.Errorf("unexpected build secrets %v", build.Secrets)
+	}
+
+	data, _ := os.ReadFile(filepath.Join("deployments", "build-env-app", "repo", "Dockerfile"))
+	for _, want := range []string{"ARG APP_VERSION\nARG NEXT_PUBLIC_API_URL\n", `RUN --mount=type=secret,id=NPM_TOKEN export NPM_TOKEN="$(cat /run/secrets/NPM_TOKEN)" && npm run build`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Dockerfile is missing %q:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "npm_secret") {
+		t.Errorf("secret value written to the Dockerfile:\n%s", data)
+	}
+
+	run := fake.Runs[len(fake.Runs)-1]
+	if _, ok := run.Env["NPM_TOKEN"]; ok || run.Env["NEXT_PUBLIC_API_URL"] == "" || run.Env["DATABASE_URL"] == "" {
+		t.Errorf("unexpected runtime env %v", run.Env)
+	}
+
+	// Restarts keep build-only variables out of the container
+	if err := deploy.UpdateAppEnv("build-env-app", map[string]string{"NPM_TOKEN": "rotated", "DATABASE_URL": "postgres://db2"}); err != nil {
+		t.Fatalf("UpdateAppEnv failed: %v", err)
+	}
+	if run := fake.Runs[len(fake.Runs)-1]; run.Env["NPM_TOKEN"] != "" || run.Env["DATABASE_URL"] != "postgres://db2" {
+		t.Errorf("unexpected runtime env after update %v", run.Env)
+	}
+
+	for _, options := range []map[string]deploy.EnvVarOptions{
+		{"MISSING": {Scope: deploy.EnvScopeBuild}},
+		{"DATABASE_URL": {Scope: "deploy"}},
+	} {
+		if err := deploy.ValidateEnvOptions(spec.Env, options); err == nil {
+			t.Errorf("expected %v to be rejected", options)
+		}
+	}
+	if err := (deploy.BuildSettings{BuildArgs: map[string]string{"BAD NAME": "x"}}).Validate(); err == nil {
+		t.Error("expected invalid build arg name to be rejected")
+	}
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prashanta0234/vpsmyth/internal/api"
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/jobs"
+)
+
+func TestCancelDeploy(t *testing.T) {
+	initTestDB(t, "test_cancel.db")
+	fake := useFakeRuntime(t)
+	if err := api.StartDeployWorkers(1); err != nil {
+		t.Fatalf("StartDeployWorkers failed: %v", err)
+	}
+
+	src := t.TempDir()
+	gitRepo(t, src, "init", "-q", "-b", "main")
+	commitFile(t, src, "index.html", "<h1>v1</h1>", "v1")
+	port := freeTestPort(t)
+	if err := deploy.DeployGit(deploy.Spec{AppName: "cancel-app", RepoURL: src, Port: port}, &testReporter{}); err != nil {
+		t.Fatalf("first deploy failed: %v", err)
+	}
+	defer deploy.DeleteApp("cancel-app")
+
+	cancel := func(id int64) int {
+		rec := httptest.NewRecorder()
+		api.HandleCancelDeployJob(rec, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/apps/deploy/cancel?id=%d", id), nil))
+		return rec.Code
+	}
+
+	// A build cancelled while it runs leaves release 1 serving
+	fake.BuildDelay = time.Minute
+	commitFile(t, src, "index.html", "<h1>v2</h1>", "v2")
+	body := fmt.Sprintf(`{"appName":"cancel-app","deployType":"git","repoURL":%q,"port":%d}`, src, port)
+	rec := httptest.NewRecorder()
+	api.HandleDeploy(rec, httptest.NewRequest(http.MethodPost, "/api/apps/deploy", strings.NewReader(body)))
+	var resp struct {
+		JobID int64 `json:"jobId"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.JobID == 0 {
+		t.Fatalf("deploy was not queued: %d %s", rec.Code, rec.Body.String())
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, _ := db.GetDeployJob(resp.JobID)
+		if job.State == deploy.StateBuilding {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not start building: %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if code := cancel(resp.JobID); code != http.StatusOK {
+		t.Fatalf("expected cancel to succeed, got %d", code)
+	}
+	job := waitForJob(t, resp.JobID)
+	if job.State != jobs.StateCancelled || !strings.Contains(job.Error, "cancelled by request") {
+		t.Errorf("expected a cancelled job, got %s (%s)", job.State, job.Error)
+	}
+	if fake.HasImage("vpsmyth/cancel-app:r2") || !strings.Contains(strings.Join(fake.Calls, "\n"), "rmi vpsmyth/cancel-app:r2") {
+		t.Errorf("expected the partial image to be removed, calls: %v", fake.Calls)
+	}
+	if c, err := fake.Inspect("cancel-app"); err != nil || !c.Running || c.Image != "vpsmyth/cancel-app:r1" {
+		t.Errorf("expected release 1 to keep running, got %+v (%v)", c, err)
+	}
+	if releases, _ := deploy.ListReleases("cancel-app"); len(releases) != 2 || releases[0].Status != deploy.ReleaseFailed {
+		t.Errorf("expected release 2 to be marked failed, got %+v", releases)
+	}
+
+	if code := cancel(resp.JobID); code != http.StatusConflict {
+		t.Errorf("expected 409 for a finished job, got %d", code)
+	}
+	if code := cancel(resp.JobID + 100); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown job, got %d", code)
+	}
+
+	// A build running past its step timeout fails the same way
+	t.Setenv("VPSMYTH_BUILD_TIMEOUT", "1")
+	err := deploy.DeployGit(deploy.Spec{AppName: "cancel-app", RepoURL: src, Port: port}, &testReporter{})
+	if err == nil || !strings.Contains(err.Error(), "build timed out after 1s") {
+		t.Errorf("expected a build timeout, got %v", err)
+	}
+	if c, _ := fake.Inspect("cancel-app"); !c.Running || c.Image != "vpsmyth/cancel-app:r1" {
+		t.Errorf("expected release 1 to keep running after the timeout, got %+v", c)
+	}
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+)
+
+// rawColumn reads a stored value without decrypting it.
+func rawColumn(t *testing.T, query string, args ...interface{}) string {
+	t.Helper()
+	var value string
+	if err := db.DB.QueryRow(query, args...).Scan(&value); err != nil {
+		t.Fatalf("failed to read raw value: %v", err)
+	}
+	return value
+}
+
+func testKey() string {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func TestEncryptedSecrets(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "vpsmyth.db")
+	if err := db.InitDB(dbPath); err != nil {
+		t.Fatalf("Failed to init DB: %v", err)
+	}
+	defer func() { db.DB.Close() }()
+
+	// The key file is created on first run, readable only by its owner
+	keyFile := filepath.Join(dir, "vpsmyth.key")
+	info, err := os.Stat(keyFile)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected a 0600 key file, got %v (%v)", info, err)
+	}
+
+	db.SaveSecret("API_KEY", "secret123")
+	db.SaveGitHubCredentials("gh_token_123")
+	db.SaveDockerHubCredentials("hubuser", "hubpass")
+	for _, raw := range []string{
+		rawColumn(t, "SELECT value FROM secrets WHERE key = 'API_KEY'"),
+		rawColumn(t, "SELECT password FROM credentials WHERE service = 'github'"),
+		rawColumn(t, "SELECT password FROM credentials WHERE service = 'dockerhub'"),
+	} {
+		if !strings.HasPrefix(raw, "enc:v1:") || strings.Contains(raw, "secret123") || strings.Contains(raw, "gh_token") {
+			t.Errorf("expected an encrypted value, got %q", raw)
+		}
+	}
+	if secrets, _ := db.GetGlobalSecrets(); secrets["API_KEY"] != "secret123" {
+		t.Errorf("expected the secret to decrypt, got %v", secrets)
+	}
+
+	// A value copied to another row does not decrypt
+	db.DB.Exec("INSERT INTO secrets (key, value) SELECT 'COPY', value FROM secrets WHERE key = 'API_KEY'")
+	if _, err := db.GetGlobalSecrets(); err == nil {
+		t.Error("expected a value moved to another row to be refused")
+	}
+	db.DeleteSecret("COPY")
+
+	// Plaintext rows of earlier versions are encrypted at startup
+	db.DB.Exec("INSERT INTO secrets (key, value) VALUES ('LEGACY', 'plain-value')")
+	db.DB.Close()
+	if err := db.InitDB(dbPath); err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	if raw := rawColumn(t, "SELECT value FROM secrets WHERE key = 'LEGACY'"); !strings.HasPrefix(raw, "enc:v1:") {
+		t.Errorf("expected the plaintext row to be encrypted, got %q", raw)
+	}
+	if secrets, _ := db.GetGlobalSecrets(); secrets["LEGACY"] != "plain-value" {
+		t.Errorf("expected the migrated secret to decrypt, got %v", secrets)
+	}
+
+	// Rotation re-encrypts every row and replaces the key file
+	oldKey, _ := os.ReadFile(keyFile)
+	oldRaw := rawColumn(t, "SELECT value FROM secrets WHERE key = 'API_KEY'")
+	n, err := db.RotateKey()
+	if err != nil || n != 4 {
+		t.Fatalf("expected 4 re-encrypted values, got %d (%v)", n, err)
+	}
+	if newKey, _ := os.ReadFile(keyFile); string(newKey) == string(oldKey) {
+		t.Error("expected the key file to be replaced")
+	}
+	if raw := rawColumn(t, "SELECT value FROM secrets WHERE key = 'API_KEY'"); raw == oldRaw {
+		t.Error("expected the secret to be re-encrypted")
+	}
+	db.DB.Close()
+	if err := db.InitDB(dbPath); err != nil {
+		t.Fatalf("Failed to reopen DB with the new key: %v", err)
+	}
+	if user, pass, _ := db.GetDockerHubCredentials(); user != "hubuser" || pass != "hubpass" {
+		t.Errorf("expected the credentials to survive the rotation, got %s/%s", user, pass)
+	}
+	if token, _ := db.GetGitHubCredentials(); token != "gh_token_123" {
+		t.Errorf("expected the token to survive the rotation, got %q", token)
+	}
+}
+
+func TestEncryptionKeyFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "vpsmyth.db")
+	key := testKey()
+	t.Setenv(db.SecretKeyEnv, key)
+	if err := db.InitDB(dbPath); err != nil {
+		t.Fatalf("Failed to init DB: %v", err)
+	}
+	db.SaveSecret("API_KEY", "secret123")
+	if _, err := os.Stat(filepath.Join(dir, "vpsmyth.key")); !os.IsNotExist(err) {
+		t.Error("expected no key file with the key in the environment")
+	}
+
+	// Rotating a key from the environment needs the new key
+	if _, err := db.RotateKey(); err == nil {
+		t.Error("expected the rotation to need the new key")
+	}
+	newKey := testKey()
+	t.Setenv(db.NewSecretKeyEnv, newKey)
+	if n, err := db.RotateKey(); err != nil || n != 1 {
+		t.Fatalf("expected 1 re-encrypted value, got %d (%v)", n, err)
+	}
+	db.DB.Close()
+
+	// The old key no longer decrypts the database
+	if err := db.InitDB(dbPath); err == nil {
+		t.Error("expected the old key to be refused")
+	}
+	db.DB.Close()
+	t.Setenv(db.SecretKeyEnv, newKey)
+	if err := db.InitDB(dbPath); err != nil {
+		t.Fatalf("Failed to open DB with the new key: %v", err)
+	}
+	defer db.DB.Close()
+	if secrets, _ := db.GetGlobalSecrets(); secrets["API_KEY"] != "secret123" {
+		t.Errorf("expected the secret to decrypt with the new key, got %v", secrets)
+	}
+}
@@ -27,15 +27,13 @@ func TestDeployNodeDocker(t *testing.T) {
 		t.Fatalf("DeployNodeDocker failed: %v", err)
 	}
 
-	// Verify metadata file exists
-	metaFile := "deployments/test-node-app.json"
-	if _, err := os.Stat(metaFile); os.IsNotExist(err) {
-		t.Errorf("Metadata file not found: %s", metaFile)
+	// Verify the app was stored
+	if _, err := deploy.GetApp(appName); err != nil {
+		t.Errorf("App metadata not stored: %v", err)
 	}
 
 	// Cleanup
-	os.RemoveAll("deployments/test-node-app")
-	os.Remove(metaFile)
+	deploy.DeleteApp(appName)
 }
 
 func TestDeployFromImage(t *testing.T) {
@@ -54,13 +52,12 @@ func TestDeployFromImage(t *testing.T) {
 	}
 
 	// Verify metadata
-	metaFile := "deployments/test-nginx-image.json"
-	if _, err := os.Stat(metaFile); os.IsNotExist(err) {
-		t.Errorf("Metadata file not found: %s", metaFile)
+	if _, err := deploy.GetApp(appName); err != nil {
+		t.Errorf("App metadata not stored: %v", err)
 	}
 
 	// Cleanup
 	exec.Command("docker", "stop", appName).Run()
 	exec.Command("docker", "rm", appName).Run()
-	os.Remove(metaFile)
+	deploy.DeleteApp(appName)
 }
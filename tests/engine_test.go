@@ -0,0 +1,251 @@
+package tests
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prashanta0234/vpsmyth/internal/system"
+)
+
+// startStubDaemon serves handler on a unix socket and returns the socket path.
+func startStubDaemon(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "dockerd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socketPath := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen on unix socket: %v", err)
+	}
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	t.Cleanup(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+	return socketPath
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestEngineListContainers(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("all") != "true" {
+			t.Errorf("expected all=true, got %q", r.URL.Query().Get("all"))
+		}
+		if !strings.Contains(r.URL.Query().Get("filters"), "managed-by=vpsmyth") {
+			t.Errorf("expected label filter, got %q", r.URL.Query().Get("filters"))
+		}
+		writeJSON(w, http.StatusOK, []map[string]interface{}{{
+			"Id":     "0123456789abcdef0123",
+			"Names":  []string{"/my|app"},
+			"Image":  "vpsmyth/my-app:latest",
+			"State":  "running",
+			"Status": "Up 5 minutes",
+			"Labels": map[string]string{"managed-by": "vpsmyth"},
+			"Ports":  []map[string]interface{}{{"IP": "0.0.0.0", "PrivatePort": 3000, "PublicPort": 3001, "Type": "tcp"}},
+		}})
+	})
+	engine := system.NewDockerEngine(startStubDaemon(t, mux))
+
+	containers, err := engine.List(system.ListOptions{All: true, Label: system.ManagedLabel})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("expected 1 container, got %d", len(containers))
+	}
+	c := containers[0]
+	if c.Name != "my|app" || c.ID != "0123456789ab" || !c.Running {
+		t.Errorf("unexpected container: %+v", c)
+	}
+	if len(c.PortBindings) != 1 || c.PortBindings[0].HostPort != 3001 || c.PortBindings[0].ContainerPort != 3000 {
+		t.Errorf("unexpected ports: %+v", c.PortBindings)
+	}
+	if c.Labels["managed-by"] != "vpsmyth" {
+		t.Errorf("expected managed-by label, got %v", c.Labels)
+	}
+}
+
+func TestEngineRunAndDaemonErrors(t *testing.T) {
+	var created map[string]interface{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") == "taken" {
+			writeJSON(w, http.StatusConflict, map[string]string{"message": `Conflict. The container name "/taken" is already in use`})
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&created)
+		writeJSON(w, http.StatusCreated, map[string]string{"Id": "abc123"})
+	})
+	mux.HandleFunc("/containers/abc123/start", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/containers/missing/stop", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "No such container: missing"})
+	})
+	engine := system.NewDockerEngine(startStubDaemon(t, mux))
+
+	id, err := engine.Run(system.RunOptions{
+		Name:    "web",
+		Image:   "nginx:alpine",
+		Env:     map[string]string{"PORT": "8080"},
+		Ports:   []system.Port{{HostPort: 8080, ContainerPort: 8080}},
+		Labels:  system.ManagedLabels(),
+		Restart: "always",
+	})
+	if err != nil || id != "abc123" {
+		t.Fatalf("Run = %q, %v", id, err)
+	}
+	if created["Image"] != "nginx:alpine" {
+		t.Errorf("unexpected create body: %v", created)
+	}
+	hostConfig := created["HostConfig"].(map[string]interface{})
+	bindings := hostConfig["PortBindings"].(map[string]interface{})
+	if _, ok := bindings["8080/tcp"]; !ok {
+		t.Errorf("expected 8080/tcp binding, got %v", bindings)
+	}
+
+	_, err = engine.Run(system.RunOptions{Name: "taken", Image: "nginx:alpine"})
+	if err == nil || !strings.Contains(err.Error(), "is already in use") {
+		t.Errorf("expected daemon conflict message, got %v", err)
+	}
+
+	err = engine.Stop("missing")
+	var apiErr *system.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "No such container: missing" {
+		t.Errorf("expected APIError 404, got %v", err)
+	}
+}
+
+func TestEngineLogsDemux(t *testing.T) {
+	frame := func(stream byte, s string) []byte {
+		hdr := make([]byte, 8)
+		hdr[0] = stream
+		binary.BigEndian.PutUint32(hdr[4:], uint32(len(s)))
+		return append(hdr, s...)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/web/logs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("tail") != "100" {
+			t.Errorf("expected tail=100, got %q", r.URL.Query().Get("tail"))
+		}
+		w.Write(frame(1, "hello\n"))
+		w.Write(frame(2, "oops\n"))
+	})
+	engine := system.NewDockerEngine(startStubDaemon(t, mux))
+
+	logs, err := engine.Logs("web", 100)
+	if err != nil {
+		t.Fatalf("Logs failed: %v", err)
+	}
+	if logs != "hello\noops\n" {
+		t.Errorf("unexpected logs: %q", logs)
+	}
+}
+
+func TestEngineExec(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/web/exec", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Cmd []string }
+		json.NewDecoder(r.Body).Decode(&body)
+		if strings.Join(body.Cmd, " ") != "pg_isready -q" {
+			t.Errorf("unexpected exec command: %v", body.Cmd)
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"Id": "exec1"})
+	})
+	mux.HandleFunc("/exec/exec1/start", func(w http.ResponseWriter, r *http.Request) {
+		hdr := make([]byte, 8)
+		hdr[0] = 2
+		binary.BigEndian.PutUint32(hdr[4:], 9)
+		w.Write(append(hdr, "no reply\n"...))
+	})
+	mux.HandleFunc("/exec/exec1/json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ExitCode": 2, "Running": false})
+	})
+	engine := system.NewDockerEngine(startStubDaemon(t, mux))
+
+	code, out, err := engine.Exec("web", []string{"pg_isready", "-q"}, 5*time.Second)
+	if err != nil || code != 2 || out != "no reply\n" {
+		t.Errorf("Exec = %d, %q, %v", code, out, err)
+	}
+}
+
+func TestEngineBuildAndPull(t *testing.T) {
+	var files []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/build", func(w http.ResponseWriter, r *http.Request) {
+		tr := tar.NewReader(r.Body)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("bad build context: %v", err)
+				return
+			}
+			files = append(files, hdr.Name)
+		}
+		w.Write([]byte(`{"stream":"Step 1/2 : FROM alpine\n"}` + "\n"))
+		w.Write([]byte(`{"errorDetail":{"message":"npm ERR! missing script: build"},"error":"npm ERR! missing script: build"}` + "\n"))
+	})
+	mux.HandleFunc("/images/create", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fromImage") != "nginx" || r.URL.Query().Get("tag") != "alpine" {
+			t.Errorf("unexpected pull query: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"status":"Pulling from library/nginx"}` + "\n"))
+	})
+	mux.HandleFunc("/images/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/images/ghcr.io%2Facme%2Fweb:1.0/json" {
+			t.Errorf("unexpected inspect path: %s", r.URL.EscapedPath())
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"Id": "sha256:abc", "RepoTags": []string{"ghcr.io/acme/web:1.0"}})
+	})
+	engine := system.NewDockerEngine(startStubDaemon(t, mux))
+
+	contextDir := t.TempDir()
+	os.WriteFile(filepath.Join(contextDir, "Dockerfile"), []byte("FROM alpine\n"), 0644)
+	os.WriteFile(filepath.Join(contextDir, ".dockerignore"), []byte("node_modules\n"), 0644)
+	os.MkdirAll(filepath.Join(contextDir, "node_modules", "x"), 0755)
+	os.WriteFile(filepath.Join(contextDir, "node_modules", "x", "index.js"), []byte(""), 0644)
+
+	err := engine.Build(context.Background(), system.BuildOptions{Tag: "vpsmyth/app:latest", ContextDir: contextDir})
+	if err == nil || !strings.Contains(err.Error(), "missing script: build") {
+		t.Errorf("expected build error from daemon stream, got %v", err)
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f, "node_modules") {
+			t.Errorf("ignored path %s was sent in build context", f)
+		}
+	}
+	if len(files) == 0 {
+		t.Error("expected Dockerfile in build context")
+	}
+
+	if err := engine.Pull(context.Background(), "nginx:alpine", nil); err != nil {
+		t.Errorf("Pull failed: %v", err)
+	}
+
+	if img, err := engine.InspectImage("ghcr.io/acme/web:1.0"); err != nil || img.ID != "sha256:abc" {
+		t.Errorf("InspectImage = %+v, %v", img, err)
+	}
+}
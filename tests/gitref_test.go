@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+)
+
+// gitRepo runs git in dir and returns its trimmed output.
+func gitRepo(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func commitFile(t *testing.T, dir, name, content, message string) string {
+	t.Helper()
+	os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	gitRepo(t, dir, "add", ".")
+	gitRepo(t, dir, "commit", "-q", "-m", message)
+	return gitRepo(t, dir, "rev-parse", "HEAD")
+}
+
+func deployedApp(t *testing.T, name string) deploy.DeploymentMetadata {
+	t.Helper()
+	apps, err := deploy.ListApps()
+	if err != nil {
+		t.Fatalf("ListApps failed: %v", err)
+	}
+	for _, app := range apps {
+		if app.AppName == name {
+			return app
+		}
+	}
+	t.Fatalf("app %s not found in %+v", name, apps)
+	return deploy.DeploymentMetadata{}
+}
+
+func TestDeployGitRef(t *testing.T) {
+	initTestDB(t, "test_gitref.db")
+	useFakeRuntime(t)
+
+	src := t.TempDir()
+	gitRepo(t, src, "init", "-q", "-b", "main")
+	first := commitFile(t, src, "index.js", "console.log(1)\n", "first")
+	gitRepo(t, src, "tag", "v1")
+	second := commitFile(t, src, "index.js", "console.log(2)\n", "second")
+
+	spec := deploy.Spec{AppName: "ref-app", RepoURL: src, Port: freeTestPort(t), Ref: "v1"}
+	if err := deploy.DeployGit(spec, &testReporter{}); err != nil {
+		t.Fatalf("deploy of tag failed: %v", err)
+	}
+	defer deploy.DeleteApp("ref-app")
+	if app := deployedApp(t, "ref-app"); app.CommitSHA != first || app.CommitMsg != "first" || app.Ref != "v1" {
+		t.Errorf("unexpected metadata for tag: %+v", app)
+	}
+
+	spec.Ref = "main"
+	if err := deploy.DeployGit(spec, &testReporter{}); err != nil {
+		t.Fatalf("deploy of branch failed: %v", err)
+	}
+	if app := deployedApp(t, "ref-app"); app.CommitSHA != second {
+		t.Errorf("expected %s, got %s", second, app.CommitSHA)
+	}
+
+	// A force-pushed branch replaces the local history instead of failing like git pull.
+	gitRepo(t, src, "reset", "-q", "--hard", "v1")
+	rewritten := commitFile(t, src, "index.js", "console.log(3)\n", "rewritten")
+	if err := deploy.DeployGit(spec, &testReporter{}); err != nil {
+		t.Fatalf("deploy of force-pushed branch failed: %v", err)
+	}
+	if app := deployedApp(t, "ref-app"); app.CommitSHA != rewritten || app.CommitMsg != "rewritten" {
+		t.Errorf("expected rewritten commit, got %+v", app)
+	}
+
+	spec.Ref = first
+	if err := deploy.DeployGit(spec, &testReporter{}); err != nil {
+		t.Fatalf("deploy of commit failed: %v", err)
+	}
+	if app := deployedApp(t, "ref-app"); app.CommitSHA != first {
+		t.Errorf("expected %s, got %s", first, app.CommitSHA)
+	}
+
+	spec.Ref = "no-such-branch"
+	if err := deploy.DeployGit(spec, &testReporter{}); err == nil {
+		t.Error("expected unknown ref to fail")
+	}
+}
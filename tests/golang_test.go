@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+)
+
+func TestDeployGoApp(t *testing.T) {
+	initTestDB(t, "test_golang.db")
+	fake := useFakeRuntime(t)
+
+	src := t.TempDir()
+	gitRepo(t, src, "init", "-q", "-b", "main")
+	os.MkdirAll(filepath.Join(src, "cmd", "api"), 0755)
+	os.MkdirAll(filepath.Join(src, "cmd", "worker"), 0755)
+	os.WriteFile(filepath.Join(src, "cmd", "worker", "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	os.WriteFile(filepath.Join(src, "lib.go"), []byte("// Package lib is shared code.\npackage lib\n"), 0644)
+	commitFile(t, src, "cmd/api/main.go", "package main\n\nfunc main() {}\n", "add commands")
+	commitFile(t, src, "go.mod", "module example.com/shop\n\ngo 1.22.3\n", "add go.mod")
+
+	dockerfile := func(app string) string {
+		data, err := os.ReadFile(filepath.Join("deployments", app, "repo", "Dockerfile"))
+		if err != nil {
+			t.Fatalf("failed to read Dockerfile: %v", err)
+		}
+		return string(data)
+	}
+
+	// Without a framework go.mod is detected; the first cmd/ package is built statically.
+	goPort := freeTestPort(t)
+	spec := deploy.Spec{AppName: "go-app", RepoURL: src, Port: goPort}
+	if err := deploy.DeployGit(spec, &testReporter{}); err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	defer deploy.DeleteApp("go-app")
+	content := dockerfile("go-app")
+	for _, want := range []string{"FROM golang:1.22-alpine AS builder", "CGO_ENABLED=0", "./cmd/api", "FROM gcr.io/distroless/static-debian12:nonroot", "RUN go mod download"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Dockerfile is missing %q:\n%s", want, content)
+		}
+	}
+	if args := fake.Builds[len(fake.Builds)-1].BuildArgs; args["GOPRIVATE"] != "" {
+		t.Errorf("unexpected build args %v", args)
+	}
+
+	// A cmd/ package named after the app wins; CGO switches to glibc images.
+	// The stored GitHub token is kept from repositories outside GitHub.
+	db.SaveGitHubCredentials("ghp_test")
+	spec = deploy.Spec{AppName: "worker", RepoURL: src, Port: freeTestPort(t), Framework: "go",
+		Build: deploy.BuildSettings{CGO: true, GoPrivate: "github.com/acme/*"}}
+	if err := deploy.DeployGit(spec, &testReporter{}); err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	defer deploy.DeleteApp("worker")
+	content = dockerfile("worker")
+	for _, want := range []string{"FROM golang:1.22-bookworm AS builder", "CGO_ENABLED=1", "./cmd/worker", "FROM debian:bookworm-slim"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Dockerfile is missing %q:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "GIT_CONFIG") {
+		t.Errorf("unexpected GitHub credentials in the Dockerfile:\n%s", content)
+	}
+	build := fake.Builds[len(fake.Builds)-1]
+	if build.BuildArgs["GOPRIVATE"] != "github.com/acme/*" || len(build.Secrets) != 0 {
+		t.Errorf("unexpected build args %v and secrets %v", build.BuildArgs, build.Secrets)
+	}
+	if app := deployedApp(t, "worker"); !app.Build.CGO || app.Build.GoMain != "" {
+		t.Errorf("build settings not stored as requested: %+v", app.Build)
+	}
+
+	// An explicit main package is used as given.
+	spec = deploy.Spec{AppName: "go-app", RepoURL: src, Port: goPort, Build: deploy.BuildSettings{GoMain: "cmd/worker"}}
+	if err := deploy.DeployGit(spec, &testReporter{}); err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	if content := dockerfile("go-app"); !strings.Contains(content, "-o /out/app ./cmd/worker\n") {
+		t.Errorf("configured main package not built:\n%s", content)
+	}
+
+	// For a GitHub repository the token is mounted as a build secret into the
+	// download and build steps, and never passed as a build arg.
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "url."+src+".insteadOf")
+	t.Setenv("GIT_CONFIG_VALUE_0", "https://ghp_test@github.com/acme/shop")
+	spec = deploy.Spec{AppName: "private-go", RepoURL: "https://github.com/acme/shop", Port: freeTestPort(t)}
+	if err := deploy.DeployGit(spec, &testReporter{}); err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	defer deploy.DeleteApp("private-go")
+	content = dockerfile("private-go")
+	if strings.Count(content, "--mount=type=secret,id=VPSMYTH_GITHUB_TOKEN") != 2 || !strings.Contains(content, "x-access-token:${VPSMYTH_GITHUB_TOKEN}@github.com/") || strings.Contains(content, "ghp_test") {
+		t.Errorf("expected the token to be mounted as a secret:\n%s", content)
+	}
+	build = fake.Builds[len(fake.Builds)-1]
+	if build.Secrets["VPSMYTH_GITHUB_TOKEN"] != "ghp_test" || build.BuildArgs["GOPRIVATE"] != "github.com/acme" {
+		t.Errorf("unexpected build args %v and secrets %v", build.BuildArgs, build.Secrets)
+	}
+	for _, v := range build.BuildArgs {
+		if v == "ghp_test" {
+			t.Errorf("token passed as a build arg: %v", build.BuildArgs)
+		}
+	}
+}
+
+func TestBuildSettingsValidate(t *testing.T) {
+	for _, main := range []string{"../other", "/abs/cmd", "cmd/../../x"} {
+		if err := (deploy.BuildSettings{GoMain: main}).Validate(); err == nil {
+			t.Errorf("expected %q to be rejected", main)
+		}
+	}
+	if err := (deploy.BuildSettings{GoMain: "./cmd/api", GoPrivate: "github.com/acme/*,gitlab.com/acme"}).Validate(); err != nil {
+		t.Errorf("valid settings rejected: %v", err)
+	}
+	if err := (deploy.BuildSettings{RootDir: "apps/web", Dockerfile: "docker/web.Dockerfile", Context: ".", Target: "prod", WatchPaths: []string{"apps/*/src"}}).Validate(); err != nil {
+		t.Errorf("valid monorepo settings rejected: %v", err)
+	}
+	for _, b := range []deploy.BuildSettings{{RootDir: "/srv/app"}, {Context: "../.."}, {Target: "prod --push"}, {WatchPaths: []string{"apps/[web"}}} {
+		if err := b.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", b)
+		}
+	}
+
+	watch := deploy.BuildSettings{WatchPaths: []string{"apps/web", "packages/*/src"}}
+	if !watch.Watches([]string{"README.md", "apps/web/index.js"}) || !watch.Watches([]string{"packages/ui/src"}) || watch.Watches([]string{"apps/website/x"}) {
+		t.Errorf("unexpected watch path matching")
+	}
+}
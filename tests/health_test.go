@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/api"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+)
+
+func TestAppHealthChecks(t *testing.T) {
+	initTestDB(t, "test_health.db")
+	fake := useFakeRuntime(t)
+	fake.ServePorts = true
+	defer os.Remove("deployments/health-app.json")
+
+	port := freeTestPort(t)
+	spec := deploy.Spec{
+		AppName:     "health-app",
+		ImageName:   "nginx:alpine",
+		Port:        port,
+		HealthCheck: &deploy.HealthCheck{Type: "http", Path: "/healthz", Retries: 2},
+	}
+	if err := deploy.DeployImage(spec, &testReporter{}); err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	defer deploy.DeleteApp("health-app")
+
+	deploy.RunHealthChecks()
+	if h := deploy.AppHealth("health-app"); h == nil || h.Status != deploy.HealthHealthy {
+		t.Fatalf("expected healthy, got %+v", h)
+	}
+	apps, _ := deploy.ListApps()
+	if len(apps) != 1 || apps[0].Health == nil || apps[0].Health.Status != deploy.HealthHealthy {
+		t.Errorf("expected health in app list, got %+v", apps)
+	}
+
+	// A crashed container only turns unhealthy once its retries are used up.
+	fake.Stop("health-app")
+	deploy.RunHealthChecks()
+	if h := deploy.AppHealth("health-app"); h.Status != deploy.HealthHealthy || h.FailingStreak != 1 {
+		t.Errorf("expected healthy with one failure, got %+v", h)
+	}
+	deploy.RunHealthChecks()
+	if h := deploy.AppHealth("health-app"); h.Status != deploy.HealthUnhealthy || !strings.Contains(h.Message, "not running") {
+		t.Errorf("expected unhealthy, got %+v", h)
+	}
+
+	history, err := deploy.HealthHistory("health-app", 10)
+	if err != nil || len(history) != 3 || history[0].OK || !history[2].OK {
+		t.Errorf("unexpected history: %+v, %v", history, err)
+	}
+
+	// Command checks run inside the container.
+	fake.Start("health-app")
+	fake.ExecFunc = func(name string, cmd []string) (int, string) {
+		return 1, "db unreachable"
+	}
+	if err := deploy.SetHealthCheck("health-app", &deploy.HealthCheck{Type: "cmd", Command: []string{"check"}, Retries: 1}); err != nil {
+		t.Fatalf("SetHealthCheck failed: %v", err)
+	}
+	deploy.RunHealthChecks()
+
+	rec := httptest.NewRecorder()
+	api.HandleAppHealth(rec, httptest.NewRequest(http.MethodGet, "/api/apps/health?appName=health-app", nil))
+	if !strings.Contains(rec.Body.String(), `"status":"unhealthy"`) || !strings.Contains(rec.Body.String(), "db unreachable") {
+		t.Errorf("unexpected health response: %s", rec.Body.String())
+	}
+
+	if err := deploy.SetHealthCheck("health-app", &deploy.HealthCheck{Type: "ping"}); err == nil {
+		t.Error("expected unknown check type to be rejected")
+	}
+}
@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prashanta0234/vpsmyth/internal/api"
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/jobs"
+)
+
+func initTestDB(t *testing.T, path string) {
+	t.Helper()
+	os.Remove(path)
+	if err := db.InitDB(path); err != nil {
+		t.Fatalf("Failed to init DB: %v", err)
+	}
+	t.Cleanup(func() { os.Remove(path) })
+}
+
+// waitForJob polls a job until it reaches a final state.
+func waitForJob(t *testing.T, id int64) db.DeployJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := db.GetDeployJob(id)
+		if err != nil {
+			t.Fatalf("GetDeployJob failed: %v", err)
+		}
+		if job.FinishedAt != nil {
+			return job
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %d did not finish in time", id)
+	return db.DeployJob{}
+}
+
+func TestJobQueue(t *testing.T) {
+	initTestDB(t, "test_jobs.db")
+
+	// A job left running by a previous process must be marked interrupted.
+	staleID, _ := db.CreateDeployJob("stale-app", "building", "{}")
+
+	var seen []string
+	q, err := jobs.NewQueue(1, func(job *jobs.Job) error {
+		var payload map[string]string
+		job.Decode(&payload)
+		seen = append(seen, payload["step"])
+		job.SetState("building")
+		if payload["step"] == "fail" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+
+	stale, _ := db.GetDeployJob(staleID)
+	if stale.State != jobs.StateInterrupted {
+		t.Errorf("expected stale job to be interrupted, got %s", stale.State)
+	}
+
+	okID, _ := q.Submit("app", map[string]string{"step": "ok"})
+	failID, _ := q.Submit("app", map[string]string{"step": "fail"})
+
+	if job := waitForJob(t, okID); job.State != jobs.StateSucceeded {
+		t.Errorf("expected succeeded, got %s (%s)", job.State, job.Error)
+	}
+	if job := waitForJob(t, failID); job.State != jobs.StateFailed || job.Error != "boom" {
+		t.Errorf("expected failed with boom, got %s (%s)", job.State, job.Error)
+	}
+	if len(seen) != 2 {
+		t.Errorf("expected 2 runs, got %v", seen)
+	}
+
+	list, err := db.ListDeployJobs("app", 10)
+	if err != nil || len(list) != 2 || list[0].ID != failID {
+		t.Errorf("unexpected job list: %+v, %v", list, err)
+	}
+}
+
+func TestHandleDeployQueuesJob(t *testing.T) {
+	initTestDB(t, "test_deploy_api.db")
+	fake := useFakeRuntime(t)
+	defer os.Remove("deployments/queued-app.json")
+
+	if err := api.StartDeployWorkers(1); err != nil {
+		t.Fatalf("StartDeployWorkers failed: %v", err)
+	}
+
+	body := `{"appName":"queued-app","deployType":"image","repoURL":"n/a","imageName":"nginx:alpine","port":8090}`
+	rec := httptest.NewRecorder()
+	api.HandleDeploy(rec, httptest.NewRequest(http.MethodPost, "/api/apps/deploy", strings.NewReader(body)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		JobID int64 `json:"jobId"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.JobID == 0 {
+		t.Fatal("expected a job ID in the response")
+	}
+
+	job := waitForJob(t, resp.JobID)
+	if job.State != jobs.StateSucceeded {
+		t.Fatalf("expected job to succeed, got %s (%s)", job.State, job.Error)
+	}
+	if !fake.HasImage("nginx:alpine") {
+		t.Error("expected image to be pulled by the worker")
+	}
+
+	rec = httptest.NewRecorder()
+	api.HandleDeployLogs(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/apps/deploy/logs?id=%d", resp.JobID), nil))
+	if rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "data: Pulling nginx:alpine") || !strings.Contains(rec.Body.String(), "event: done") {
+		t.Errorf("unexpected log stream: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	api.HandleListDeployJobs(rec, httptest.NewRequest(http.MethodGet, "/api/apps/deploy/jobs?appName=queued-app", nil))
+	if !strings.Contains(rec.Body.String(), `"state":"succeeded"`) {
+		t.Errorf("unexpected job list response: %s", rec.Body.String())
+	}
+}
+
+func TestJobLogCapture(t *testing.T) {
+	initTestDB(t, "test_job_logs.db")
+
+	release := make(chan struct{})
+	q, err := jobs.NewQueue(1, func(job *jobs.Job) error {
+		<-release
+		fmt.Fprint(job, "line1\npart")
+		fmt.Fprint(job, "ial\r\nno newline")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+
+	id, _ := q.Submit("log-app", map[string]string{})
+	// Wait until the worker picked the job up so the subscription is live.
+	for {
+		job, _ := db.GetDeployJob(id)
+		if job.StartedAt != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	live, cancel := jobs.Subscribe(id)
+	defer cancel()
+	close(release)
+
+	var got []string
+	for l := range live {
+		got = append(got, l.Line)
+	}
+	want := []string{"line1", "partial", "no newline"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("live lines = %q, want %q", got, want)
+	}
+
+	stored, err := db.GetDeployLogs(id)
+	if err != nil || len(stored) != 3 || stored[2].Seq != 3 {
+		t.Errorf("unexpected stored logs: %+v, %v", stored, err)
+	}
+}
@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prashanta0234/vpsmyth/internal/api"
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/jobs"
+)
+
+// submitDeploy posts a git deploy of src and returns the status and job ID.
+func submitDeploy(t *testing.T, appName, src string, port int) (int, int64) {
+	t.Helper()
+	body := fmt.Sprintf(`{"appName":%q,"deployType":"git","repoURL":%q,"port":%d}`, appName, src, port)
+	rec := httptest.NewRecorder()
+	api.HandleDeploy(rec, httptest.NewRequest(http.MethodPost, "/api/apps/deploy", strings.NewReader(body)))
+	var resp struct {
+		JobID int64 `json:"jobId"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	return rec.Code, resp.JobID
+}
+
+// waitForState polls a job until it reaches state.
+func waitForState(t *testing.T, id int64, state string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, _ := db.GetDeployJob(id)
+		if job.State == state {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d did not reach %s: %+v", id, state, job)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func jobLogs(id int64) string {
+	lines, _ := db.GetDeployLogs(id)
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(l.Line + "\n")
+	}
+	return b.String()
+}
+
+func TestDeployPolicies(t *testing.T) {
+	initTestDB(t, "test_policies.db")
+	fake := useFakeRuntime(t)
+	src := t.TempDir()
+	gitRepo(t, src, "init", "-q", "-b", "main")
+	commitFile(t, src, "index.html", "<h1>hi</h1>", "init")
+	port := freeTestPort(t)
+	defer deploy.DeleteApp("locked-app")
+
+	// reject: a second deploy and other operations are refused while one runs
+	t.Setenv("VPSMYTH_DEPLOY_POLICY", "reject")
+	if err := api.StartDeployWorkers(2); err != nil {
+		t.Fatalf("StartDeployWorkers failed: %v", err)
+	}
+	fake.BuildDelay = time.Minute
+	code, first := submitDeploy(t, "locked-app", src, port)
+	if code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", code)
+	}
+	waitForState(t, first, deploy.StateBuilding)
+	if code, _ := submitDeploy(t, "locked-app", src, freeTestPort(t)); code != http.StatusConflict {
+		t.Errorf("expected the second deploy to be rejected, got %d", code)
+	}
+	if reserved, _ := db.GetAppPort("locked-app"); reserved != port {
+		t.Errorf("expected the rejected deploy to leave port %d reserved, got %d", port, reserved)
+	}
+	rec := httptest.NewRecorder()
+	api.HandleAppAction("stop")(rec, httptest.NewRequest(http.MethodPost, "/api/apps/stop", strings.NewReader(`{"appName":"locked-app"}`)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected stop to be refused during a deploy, got %d", rec.Code)
+	}
+	if err := deploy.UpdateAppEnv("locked-app", nil); err != deploy.ErrAppBusy {
+		t.Errorf("expected env update to be refused during a deploy, got %v", err)
+	}
+	rec = httptest.NewRecorder()
+	api.HandleSetHealthCheck(rec, httptest.NewRequest(http.MethodPost, "/api/apps/health-check", strings.NewReader(`{"appName":"locked-app","healthCheck":null}`)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected the health check update to be refused during a deploy, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	api.HandleCancelDeployJob(rec, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/apps/deploy/cancel?id=%d", first), nil))
+	waitForJob(t, first)
+
+	// cancel: a newer deploy cancels the running one and takes over
+	t.Setenv("VPSMYTH_DEPLOY_POLICY", "cancel")
+	if err := api.StartDeployWorkers(2); err != nil {
+		t.Fatalf("StartDeployWorkers failed: %v", err)
+	}
+	fake.BuildDelay = time.Minute
+	_, older := submitDeploy(t, "locked-app", src, port)
+	waitForState(t, older, deploy.StateBuilding)
+	for deadline := time.Now().Add(5 * time.Second); !strings.Contains(jobLogs(older), "Building vpsmyth/locked-app"); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("build of job %d did not start:\n%s", older, jobLogs(older))
+		}
+	}
+	fake.BuildDelay = 0
+	_, newer := submitDeploy(t, "locked-app", src, port)
+	if job := waitForJob(t, older); job.State != jobs.StateCancelled || !strings.Contains(job.Error, "superseded") {
+		t.Errorf("expected the older deploy to be superseded, got %s (%s)", job.State, job.Error)
+	}
+	if job := waitForJob(t, newer); job.State != jobs.StateSucceeded {
+		t.Errorf("expected the newer deploy to succeed, got %s (%s)", job.State, job.Error)
+	}
+
+	// queue: deploys of the same app run one after the other
+	t.Setenv("VPSMYTH_DEPLOY_POLICY", "queue")
+	if err := api.StartDeployWorkers(2); err != nil {
+		t.Fatalf("StartDeployWorkers failed: %v", err)
+	}
+	fake.BuildDelay = 200 * time.Millisecond
+	_, a := submitDeploy(t, "locked-app", src, port)
+	_, b := submitDeploy(t, "locked-app", src, port)
+	for _, id := range []int64{a, b} {
+		if job := waitForJob(t, id); job.State != jobs.StateSucceeded {
+			t.Errorf("expected queued deploy %d to succeed, got %s (%s)", id, job.State, job.Error)
+		}
+	}
+	if !strings.Contains(jobLogs(a)+jobLogs(b), "Waiting for another operation on locked-app") {
+		t.Errorf("expected one deploy to wait for the other:\n%s\n%s", jobLogs(a), jobLogs(b))
+	}
+
+	t.Setenv("VPSMYTH_DEPLOY_POLICY", "sometimes")
+	if err := api.StartDeployWorkers(1); err == nil {
+		t.Error("expected an unknown policy to be refused")
+	}
+}
+
+func TestBuildConcurrencyLimit(t *testing.T) {
+	initTestDB(t, "test_build_limit.db")
+	fake := useFakeRuntime(t)
+	fake.BuildDelay = 300 * time.Millisecond
+	t.Setenv("VPSMYTH_MAX_BUILDS", "1")
+
+	src := t.TempDir()
+	gitRepo(t, src, "init", "-q", "-b", "main")
+	commitFile(t, src, "index.html", "<h1>hi</h1>", "init")
+
+	var wg sync.WaitGroup
+	reps := []*testReporter{{}, {}}
+	for i, rep := range reps {
+		name := fmt.Sprintf("limit-app-%d", i)
+		spec := deploy.Spec{AppName: name, RepoURL: src, Port: freeTestPort(t)}
+		defer deploy.DeleteApp(name)
+		wg.Add(1)
+		go func(rep *testReporter) {
+			defer wg.Done()
+			if err := deploy.DeployGit(spec, rep); err != nil {
+				t.Errorf("deploy of %s failed: %v", spec.AppName, err)
+			}
+		}(rep)
+	}
+	wg.Wait()
+	if !strings.Contains(reps[0].String()+reps[1].String(), "Waiting for a build slot") {
+		t.Errorf("expected one build to wait for the other:\n%s\n%s", reps[0].String(), reps[1].String())
+	}
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/system"
+)
+
+func TestParseManifest(t *testing.T) {
+	m, err := deploy.ParseManifest([]byte(`
+framework: nestjs
+startCommand: node dist/main.js
+port: 8080
+healthCheck:
+  type: http
+  path: /healthz
+env:
+  required: [DATABASE_URL]
+cron:
+  - name: cleanup
+    schedule: "*/15 * * * *"
+    command: node dist/cleanup.js
+volumes:
+  - name: uploads
+    path: /app/uploads
+resources:
+  memory: 512m
+  cpus: 0.5
+`))
+	if err != nil {
+		t.Fatalf("valid manifest rejected: %v", err)
+	}
+	if m.Framework != "nestjs" || m.Port != 8080 || m.HealthCheck.Path != "/healthz" || m.Cron[0].Schedule != "*/15 * * * *" || m.Resources.CPUs != 0.5 {
+		t.Errorf("unexpected manifest %+v", m)
+	}
+
+	if _, err := deploy.ParseManifest([]byte("framwork: nextjs\n")); err == nil || !strings.Contains(err.Error(), "field framwork not found") {
+		t.Errorf("expected unknown key to be reported, got %v", err)
+	}
+	_, err = deploy.ParseManifest([]byte(`
+port: 70000
+cron:
+  - name: report
+    schedule: "0 3 * *"
+    command: ./report
+volumes:
+  - name: Data
+    path: relative/dir
+resources:
+  memory: lots
+`))
+	if err == nil {
+		t.Fatal("expected invalid manifest to be rejected")
+	}
+	for _, want := range []string{"port: must be between 1 and 65535", "cron[0].schedule: expected 5 fields", "volumes[0].name", "volumes[0].path", "resources.memory"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error is missing %q: %v", want, err)
+		}
+	}
+}
+
+func TestDeployWithManifest(t *testing.T) {
+	initTestDB(t, "test_manifest.db")
+	fake := useFakeRuntime(t)
+
+	port := freeTestPort(t)
+	src := t.TempDir()
+	gitRepo(t, src, "init", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(src, "package.json"), []byte(`{"scripts": {"start": "node index.js"}}`), 0644)
+	commitFile(t, src, ".vpsmyth.yml", fmt.Sprintf(`
+port: %d
+startCommand: node server.js
+env:
+  required: [API_KEY]
+cron:
+  - name: digest
+    schedule: "@daily"
+    command: node digest.js
+volumes:
+  - name: data
+    path: /app/data
+resources:
+  memory: 256m
+  cpus: 1.5
+`, port), "add manifest")
+
+	spec := deploy.Spec{AppName: "manifest-app", RepoURL: src, Port: freeTestPort(t)}
+	if err := deploy.DeployGit(spec, &testReporter{}); err == nil || !strings.Contains(err.Error(), "missing required environment variables: API_KEY") {
+		t.Fatalf("expected missing env to fail the deploy, got %v", err)
+	}
+
+	spec.Env = map[string]string{"API_KEY": "secret"}
+	rep := &testReporter{}
+	if err := deploy.DeployGit(spec, rep); err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	defer deploy.DeleteApp("manifest-app")
+	if !strings.Contains(rep.String(), "cron job digest declared but not scheduled") {
+		t.Errorf("expected a warning about unscheduled cron jobs:\n%s", rep.String())
+	}
+
+	// The manifest wins over the request
+	run := fake.Runs[len(fake.Runs)-1]
+	if run.Ports[0].HostPort != port || run.Memory != 256<<20 || run.CPUs != 1.5 {
+		t.Errorf("unexpected run options %+v", run)
+	}
+	if len(run.Volumes) != 1 || run.Volumes[0] != (system.Volume{Source: "vpsmyth-manifest-app-data", Target: "/app/data"}) {
+		t.Errorf("unexpected volumes %+v", run.Volumes)
+	}
+	if data, _ := os.ReadFile(filepath.Join("deployments", "manifest-app", "repo", "Dockerfile")); !strings.Contains(string(data), `CMD ["node","server.js"]`) {
+		t.Errorf("manifest start command not used:\n%s", data)
+	}
+	app := deployedApp(t, "manifest-app")
+	if app.Port != port || len(app.Cron) != 1 || app.Cron[0].Name != "digest" || app.Build.StartCommand != "" {
+		t.Errorf("unexpected metadata %+v", app)
+	}
+
+	// The manifest port is the one reserved, and refused to other apps
+	if reserved, _ := db.GetAppPort("manifest-app"); reserved != port {
+		t.Errorf("expected the manifest port %d to be reserved, got %d", port, reserved)
+	}
+	other := deploy.Spec{AppName: "manifest-other", RepoURL: src, Port: freeTestPort(t), Env: spec.Env}
+	err := deploy.DeployGit(other, &testReporter{})
+	defer deploy.DeleteApp("manifest-other")
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("port %d is already in use by app manifest-app", port)) {
+		t.Errorf("expected the manifest port to conflict, got %v", err)
+	}
+
+	// Updating the env keeps the manifest's volumes and limits
+	if err := deploy.UpdateAppEnv("manifest-app", map[string]string{"API_KEY": "rotated"}); err != nil {
+		t.Fatalf("UpdateAppEnv failed: %v", err)
+	}
+	if run := fake.Runs[len(fake.Runs)-1]; len(run.Volumes) != 1 || run.Memory != 256<<20 {
+		t.Errorf("container settings lost on restart: %+v", run)
+	}
+}
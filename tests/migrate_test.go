@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/db"
+)
+
+// openFixtureDB creates a database from an SQL fixture in testdata without
+// migrating it.
+func openFixtureDB(t *testing.T, path, fixture string, extra ...string) {
+	t.Helper()
+	os.Remove(path)
+	t.Cleanup(func() { os.Remove(path) })
+	schema, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range append([]string{string(schema)}, extra...) {
+		if _, err := db.DB.Exec(stmt); err != nil {
+			t.Fatalf("failed to load fixture: %v", err)
+		}
+	}
+	db.DB.Close()
+}
+
+// appliedVersions returns the versions recorded in schema_migrations.
+func appliedVersions(t *testing.T) []int {
+	t.Helper()
+	migrations, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus failed: %v", err)
+	}
+	var versions []int
+	for _, m := range migrations {
+		if m.AppliedAt != nil {
+			versions = append(versions, m.Version)
+		}
+	}
+	return versions
+}
+
+func TestMigrateBaselineFixture(t *testing.T) {
+	openFixtureDB(t, "test_migrate_baseline.db", "testdata/baseline.sql")
+
+	// Nothing is applied before startup
+	db.Open("test_migrate_baseline.db")
+	if versions := appliedVersions(t); len(versions) != 0 {
+		t.Errorf("expected no applied migrations, got %v", versions)
+	}
+	db.DB.Close()
+
+	if err := db.InitDB("test_migrate_baseline.db"); err != nil {
+		t.Fatalf("Failed to migrate the fixture: %v", err)
+	}
+	defer db.DB.Close()
+	migrations, _ := db.MigrationStatus()
+	if len(migrations) < 2 || len(appliedVersions(t)) != len(migrations) {
+		t.Fatalf("expected every migration to be applied, got %+v", migrations)
+	}
+
+	// Existing rows are kept
+	if token, _ := db.GetGitHubCredentials(); token != "ghp_fixture" {
+		t.Errorf("expected the GitHub token to be kept, got %q", token)
+	}
+	if secrets, _ := db.GetGlobalSecrets(); secrets["DATABASE_URL"] != "postgres://fixture" {
+		t.Errorf("expected the secrets to be kept, got %v", secrets)
+	}
+	if user, err := db.GetUserByUsername("admin"); err != nil || user.Username != "admin" {
+		t.Errorf("expected the admin user to be kept, got %+v (%v)", user, err)
+	}
+
+	// Tables and columns of later migrations work
+	if err := db.SetDeployJobResult(1, `{"port":3000}`); err != nil {
+		t.Errorf("expected deploy_jobs.result to be added: %v", err)
+	}
+	if job, err := db.GetDeployJob(1); err != nil || job.AppName != "fixture-app" || string(job.Result) != `{"port":3000}` {
+		t.Errorf("unexpected deploy job %+v (%v)", job, err)
+	}
+	if err := db.SaveApp(db.App{Name: "fixture-app", Port: 3000}); err != nil {
+		t.Errorf("expected the apps table to be created: %v", err)
+	}
+
+	// Migrating again is a no-op
+	db.DB.Close()
+	if err := db.InitDB("test_migrate_baseline.db"); err != nil {
+		t.Fatalf("Failed to reopen the migrated DB: %v", err)
+	}
+	var rows int
+	db.DB.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&rows)
+	if rows != len(migrations) {
+		t.Errorf("expected %d schema_migrations rows, got %d", len(migrations), rows)
+	}
+}
+
+func TestMigrateUserVersionFixture(t *testing.T) {
+	// Databases versioned by PRAGMA user_version keep their applied migrations
+	openFixtureDB(t, "test_migrate_user_version.db", "testdata/baseline.sql",
+		"ALTER TABLE deploy_jobs ADD COLUMN result TEXT", "PRAGMA user_version = 1")
+
+	if err := db.InitDB("test_migrate_user_version.db"); err != nil {
+		t.Fatalf("Failed to migrate the fixture: %v", err)
+	}
+	defer db.DB.Close()
+	if versions := appliedVersions(t); len(versions) < 2 || versions[0] != 1 || versions[1] != 2 {
+		t.Errorf("expected migrations 1 and 2 to be applied, got %v", versions)
+	}
+	if err := db.SaveApp(db.App{Name: "fixture-app", Port: 3000}); err != nil {
+		t.Errorf("expected the apps table to be created: %v", err)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	initTestDB(t, "test_schema.db")
+	db.DB.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (999, 'future', CURRENT_TIMESTAMP)")
+	db.DB.Close()
+
+	if err := db.InitDB("test_schema.db"); err == nil {
+		t.Error("expected a newer schema to be refused")
+	}
+	migrations, err := db.MigrationStatus()
+	if err != nil || len(migrations) == 0 || migrations[len(migrations)-1].Version != 999 || migrations[len(migrations)-1].Known {
+		t.Errorf("expected the status to list the unknown migration, got %+v (%v)", migrations, err)
+	}
+	db.DB.Close()
+}
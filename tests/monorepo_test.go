@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/api"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+)
+
+func TestMonorepoBuild(t *testing.T) {
+	initTestDB(t, "test_monorepo.db")
+	fake := useFakeRuntime(t)
+	if err := api.StartDeployWorkers(1); err != nil {
+		t.Fatalf("StartDeployWorkers failed: %v", err)
+	}
+
+	src := t.TempDir()
+	gitRepo(t, src, "init", "-q", "-b", "main")
+	os.MkdirAll(filepath.Join(src, "apps", "web"), 0755)
+	os.MkdirAll(filepath.Join(src, "apps", "api"), 0755)
+	os.WriteFile(filepath.Join(src, "apps", "web", "package.json"), []byte(`{"scripts": {"start": "node index.js"}}`), 0644)
+	os.WriteFile(filepath.Join(src, "apps", "api", "Dockerfile"), []byte("FROM alpine AS base\nFROM base AS prod\nCOPY apps/api /app\n"), 0644)
+	commitFile(t, src, "go.mod", "module example.com/mono\n\ngo 1.22\n", "init")
+
+	// The root directory is detected and built on its own
+	spec := deploy.Spec{AppName: "hook-app", RepoURL: src, Port: freeTestPort(t),
+		Build: deploy.BuildSettings{RootDir: "apps/web", WatchPaths: []string{"apps/web", "packages/*"}}}
+	if err := deploy.DeployGit(spec, &testReporter{}); err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	defer deploy.DeleteApp("hook-app")
+	build := fake.Builds[len(fake.Builds)-1]
+	if !strings.HasSuffix(build.ContextDir, filepath.Join("repo", "apps", "web")) || build.Dockerfile != "Dockerfile" {
+		t.Errorf("unexpected build options %+v", build)
+	}
+	if data, _ := os.ReadFile(filepath.Join("deployments", "hook-app", "repo", "apps", "web", "Dockerfile")); !strings.Contains(string(data), "FROM node:") {
+		t.Errorf("expected a node Dockerfile in the root directory, got:\n%s", data)
+	}
+
+	// The project's Dockerfile with the repository root as context and a target stage
+	apiSpec := deploy.Spec{AppName: "mono-api", RepoURL: src, Port: freeTestPort(t),
+		Build: deploy.BuildSettings{RootDir: "apps/api", Context: ".", Target: "prod"}}
+	if err := deploy.DeployGit(apiSpec, &testReporter{}); err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	defer deploy.DeleteApp("mono-api")
+	build = fake.Builds[len(fake.Builds)-1]
+	if !strings.HasSuffix(build.ContextDir, "repo") || build.Dockerfile != filepath.Join("apps", "api", "Dockerfile") || build.Target != "prod" {
+		t.Errorf("unexpected build options %+v", build)
+	}
+
+	missing := deploy.Spec{AppName: "mono-missing", RepoURL: src, Port: freeTestPort(t), Build: deploy.BuildSettings{RootDir: "apps/docs"}}
+	defer deploy.DeleteApp("mono-missing")
+	if err := deploy.DeployGit(missing, &testReporter{}); err == nil || !strings.Contains(err.Error(), "root directory") {
+		t.Errorf("expected missing root directory to fail, got %v", err)
+	}
+	outside := deploy.Spec{AppName: "mono-outside", RepoURL: src, Port: freeTestPort(t),
+		Build: deploy.BuildSettings{Dockerfile: "apps/api/Dockerfile", Context: "apps/web"}}
+	defer deploy.DeleteApp("mono-outside")
+	if err := deploy.DeployGit(outside, &testReporter{}); err == nil || !strings.Contains(err.Error(), "build context") {
+		t.Errorf("expected Dockerfile outside the context to fail, got %v", err)
+	}
+
+	// Pushes only redeploy when they change watched files
+	rec := httptest.NewRecorder()
+	api.HandleAppWebhook(rec, httptest.NewRequest(http.MethodPost, "/api/apps/webhook", strings.NewReader(`{"appName":"hook-app","branch":"main"}`)))
+	var hook struct {
+		Secret string `json:"secret"`
+	}
+	json.NewDecoder(rec.Body).Decode(&hook)
+
+	push := func(files string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"ref":"refs/heads/main","after":"%s","commits":[{"added":[],"removed":[],"modified":%s}]}`, strings.Repeat("a", 40), files)
+		return sendWebhook(map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + signBody(hook.Secret, body)}, body)
+	}
+	if rec := push(`["apps/api/main.go","README.md"]`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "no changes under watched paths") {
+		t.Errorf("expected push outside the watched paths to be ignored, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = push(`["packages/ui"]`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected push under a watched path to be queued, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var queued struct {
+		JobID int64 `json:"jobId"`
+	}
+	json.NewDecoder(rec.Body).Decode(&queued)
+	waitForJob(t, queued.JobID)
+}
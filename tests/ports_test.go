@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/api"
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/system"
+)
+
+func TestPortAllocation(t *testing.T) {
+	initTestDB(t, "test_ports.db")
+	fake := useFakeRuntime(t)
+	first := freeTestPort(t)
+	t.Setenv("VPSMYTH_PORT_RANGE", fmt.Sprintf("%d-%d", first, first+20))
+
+	a, err := deploy.AllocatePort("port-a", 0)
+	if err != nil || a < first || a > first+20 {
+		t.Fatalf("expected a port in range, got %d (%v)", a, err)
+	}
+	if again, _ := deploy.AllocatePort("port-a", 0); again != a {
+		t.Errorf("expected the reservation of port-a to be kept, got %d and %d", a, again)
+	}
+	b, _ := deploy.AllocatePort("port-b", 0)
+	if b == a || b == 0 {
+		t.Errorf("expected port-b to get another port, got %d", b)
+	}
+
+	var conflict *deploy.PortConflictError
+	if _, err := deploy.AllocatePort("port-b", a); !errors.As(err, &conflict) || conflict.Owner != "app port-a" {
+		t.Errorf("expected a conflict with port-a, got %v", err)
+	}
+
+	// Ports bound on the host are skipped and refused
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	busy := l.Addr().(*net.TCPAddr).Port
+	if _, err := deploy.AllocatePort("port-c", busy); err == nil || !strings.Contains(err.Error(), "another process on the host") {
+		t.Errorf("expected a conflict with the listener, got %v", err)
+	}
+	published := freeTestPort(t)
+	fake.Pull(context.Background(), "redis:7", nil)
+	fake.Run(system.RunOptions{Name: "redis", Image: "redis:7", Ports: []system.Port{{HostPort: published, ContainerPort: 6379}}})
+	if _, err := deploy.AllocatePort("port-c", published); err == nil || !strings.Contains(err.Error(), "container redis") {
+		t.Errorf("expected a conflict with the container, got %v", err)
+	}
+
+	// Containers are listed once per allocation, not once per candidate port
+	t.Setenv("VPSMYTH_PORT_RANGE", fmt.Sprintf("%d-%d", min(busy, published), max(busy, published)))
+	calls := len(fake.Calls)
+	if _, err := deploy.AllocatePort("port-d", 0); err != nil {
+		t.Fatalf("AllocatePort failed: %v", err)
+	}
+	lists := 0
+	for _, call := range fake.Calls[calls:] {
+		if strings.HasPrefix(call, "list") {
+			lists++
+		}
+	}
+	if lists != 1 {
+		t.Errorf("expected the containers to be listed once, got %d times", lists)
+	}
+	deploy.DeleteApp("port-d")
+	t.Setenv("VPSMYTH_PORT_RANGE", fmt.Sprintf("%d-%d", first, first+20))
+
+	// Deploy requests allocate or refuse ports
+	if err := api.StartDeployWorkers(1); err != nil {
+		t.Fatalf("StartDeployWorkers failed: %v", err)
+	}
+	deployImage := func(appName string, port int) (int, map[string]interface{}) {
+		body := fmt.Sprintf(`{"appName":%q,"deployType":"image","repoURL":"n/a","imageName":"nginx:alpine","port":%d}`, appName, port)
+		rec := httptest.NewRecorder()
+		api.HandleDeploy(rec, httptest.NewRequest(http.MethodPost, "/api/apps/deploy", strings.NewReader(body)))
+		var resp map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if rec.Code != http.StatusAccepted {
+			resp = map[string]interface{}{"error": rec.Body.String()}
+		}
+		return rec.Code, resp
+	}
+	code, resp := deployImage("port-web", 0)
+	if code != http.StatusAccepted {
+		t.Fatalf("expected the deploy to be accepted, got %d: %v", code, resp)
+	}
+	defer deploy.DeleteApp("port-web")
+	waitForJob(t, int64(resp["jobId"].(float64)))
+	webPort := int(resp["port"].(float64))
+	if webPort < first || webPort > first+20 || webPort == a || webPort == b {
+		t.Errorf("unexpected allocated port %d", webPort)
+	}
+	if code, resp := deployImage("port-other", webPort); code != http.StatusConflict || !strings.Contains(resp["error"].(string), "app port-web") {
+		t.Errorf("expected 409 naming port-web, got %d: %v", code, resp)
+	}
+	if code, resp := deployImage("port-web", webPort); code != http.StatusAccepted {
+		t.Errorf("expected a redeploy on the app's own port to be accepted, got %d", code)
+	} else {
+		waitForJob(t, int64(resp["jobId"].(float64)))
+	}
+
+	// Deleting an app frees its port
+	deploy.DeleteApp("port-a")
+	if _, err := deploy.AllocatePort("port-b", a); err != nil {
+		t.Errorf("expected the port of the deleted app to be free, got %v", err)
+	}
+
+	// Apps deployed before ports were reserved get their reservation
+	legacy := freeTestPort(t)
+	if err := deploy.DeployImage(deploy.Spec{AppName: "port-legacy", ImageName: "nginx:alpine", Port: legacy}, &testReporter{}); err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	defer deploy.DeleteApp("port-legacy")
+	deploy.ReservePorts()
+	if reservations, _ := db.ListPortReservations(); reservations[legacy] != "port-legacy" {
+		t.Errorf("expected port %d to be reserved for port-legacy, got %v", legacy, reservations)
+	}
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/api"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+)
+
+func TestReleasesAndRollback(t *testing.T) {
+	initTestDB(t, "test_releases.db")
+	fake := useFakeRuntime(t)
+	defer os.Remove("deployments/release-app.json")
+
+	if err := deploy.DeployFromImage("release-app", "nginx:1", 8095, map[string]string{"V": "1"}); err != nil {
+		t.Fatalf("first deploy failed: %v", err)
+	}
+	if err := deploy.DeployFromImage("release-app", "nginx:2", 8095, map[string]string{"V": "2"}); err != nil {
+		t.Fatalf("second deploy failed: %v", err)
+	}
+	fake.PullErr = errors.New("manifest unknown")
+	if err := deploy.DeployFromImage("release-app", "nginx:3", 8095, nil); err == nil {
+		t.Fatal("expected third deploy to fail")
+	}
+	fake.PullErr = nil
+
+	releases, err := deploy.ListReleases("release-app")
+	if err != nil || len(releases) != 3 {
+		t.Fatalf("expected 3 releases, got %+v, %v", releases, err)
+	}
+	if releases[0].Number != 3 || releases[0].Status != deploy.ReleaseFailed {
+		t.Errorf("expected r3 to be failed, got %+v", releases[0])
+	}
+	if releases[2].Image != "nginx:1" || releases[2].Env["V"] != "1" || releases[2].ImageDigest == "" {
+		t.Errorf("unexpected r1: %+v", releases[2])
+	}
+
+	if _, err := deploy.Rollback("release-app", 3); err == nil {
+		t.Error("expected rollback to a failed release to be refused")
+	}
+
+	number, err := deploy.Rollback("release-app", 1)
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if number != 4 {
+		t.Errorf("expected rollback to be recorded as r4, got r%d", number)
+	}
+	c, err := fake.Inspect("release-app")
+	if err != nil || c.Image != "nginx:1" || !c.Running {
+		t.Errorf("expected nginx:1 running after rollback, got %+v, %v", c, err)
+	}
+	pulls := 0
+	for _, call := range fake.Calls {
+		if strings.HasPrefix(call, "pull ") || strings.HasPrefix(call, "build ") {
+			pulls++
+		}
+	}
+	if pulls != 3 {
+		t.Errorf("rollback should not pull or rebuild, calls: %v", fake.Calls)
+	}
+
+	rec := httptest.NewRecorder()
+	api.HandleListReleases(rec, httptest.NewRequest(http.MethodGet, "/api/apps/releases?appName=release-app", nil))
+	if !strings.Contains(rec.Body.String(), `"rollbackOf":1`) {
+		t.Errorf("unexpected releases response: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	api.HandleRollback(rec, httptest.NewRequest(http.MethodPost, "/api/apps/rollback", strings.NewReader(`{"appName":"release-app","release":2}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"release":5`) {
+		t.Errorf("unexpected rollback response: %d %s", rec.Code, rec.Body.String())
+	}
+
+	if err := deploy.DeleteApp("release-app"); err != nil {
+		t.Fatalf("DeleteApp failed: %v", err)
+	}
+	if releases, _ := deploy.ListReleases("release-app"); len(releases) != 0 {
+		t.Errorf("expected release history to be removed, got %d", len(releases))
+	}
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/system"
+)
+
+// useFakeRuntime swaps in an in-memory container runtime for the duration of a test.
+func useFakeRuntime(t *testing.T) *system.FakeRuntime {
+	t.Helper()
+	fake := system.NewFakeRuntime()
+	prev := system.Runtime
+	system.Runtime = fake
+	t.Cleanup(func() { system.Runtime = prev })
+	return fake
+}
+
+func TestDeployFromImageWithFakeRuntime(t *testing.T) {
+	initTestDB(t, "test_runtime.db")
+	fake := useFakeRuntime(t)
+	defer os.Remove("deployments/fake-image-app.json")
+
+	err := deploy.DeployFromImage("fake-image-app", "nginx:alpine", 8082, map[string]string{"A": "1"})
+	if err != nil {
+		t.Fatalf("DeployFromImage failed: %v", err)
+	}
+	if !fake.HasImage("nginx:alpine") {
+		t.Error("expected image to be pulled")
+	}
+
+	apps, err := deploy.ListApps()
+	if err != nil {
+		t.Fatalf("ListApps failed: %v", err)
+	}
+	if len(apps) != 1 || apps[0].AppName != "fake-image-app" || apps[0].Port != 8082 {
+		t.Fatalf("unexpected apps: %+v", apps)
+	}
+
+	if err := deploy.StopApp("fake-image-app"); err != nil {
+		t.Fatalf("StopApp failed: %v", err)
+	}
+	c, err := fake.Inspect("fake-image-app")
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if c.Running {
+		t.Error("container should be stopped")
+	}
+
+	if err := deploy.StartApp("fake-image-app"); err != nil {
+		t.Fatalf("StartApp failed: %v", err)
+	}
+	fake.SetLogs("fake-image-app", "line1\nline2")
+	logs, err := deploy.GetLogs("fake-image-app")
+	if err != nil || logs != "line1\nline2" {
+		t.Errorf("GetLogs = %q, %v", logs, err)
+	}
+
+	if err := deploy.DeleteApp("fake-image-app"); err != nil {
+		t.Fatalf("DeleteApp failed: %v", err)
+	}
+	containers, _ := system.ListContainers()
+	if len(containers) != 0 {
+		t.Errorf("expected no containers after delete, got %d", len(containers))
+	}
+}
+
+func TestFakeRuntimeLabelFilter(t *testing.T) {
+	fake := useFakeRuntime(t)
+	fake.Pull(context.Background(), "redis:7", nil)
+
+	if _, err := fake.Run(system.RunOptions{Name: "managed", Image: "redis:7", Labels: system.ManagedLabels()}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if _, err := fake.Run(system.RunOptions{Name: "other", Image: "redis:7"}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if _, err := fake.Run(system.RunOptions{Name: "other", Image: "redis:7"}); err == nil {
+		t.Error("expected name conflict error")
+	}
+
+	managed, _ := fake.List(system.ListOptions{Label: system.ManagedLabel})
+	if len(managed) != 1 || managed[0].Name != "managed" {
+		t.Errorf("unexpected managed containers: %+v", managed)
+	}
+
+	fake.Stop("other")
+	running, _ := fake.List(system.ListOptions{})
+	all, _ := fake.List(system.ListOptions{All: true})
+	if len(running) != 1 || len(all) != 2 {
+		t.Errorf("expected 1 running and 2 total, got %d and %d", len(running), len(all))
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/api"
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+)
+
+func TestScopedSecrets(t *testing.T) {
+	initTestDB(t, "test_secrets.db")
+	fake := useFakeRuntime(t)
+
+	db.SaveSecret("SHARED", "global-value")
+	db.SaveScopedSecret(db.SecretScopeGroup, "payments", "prod_db_url", "postgres://v1")
+	db.SaveScopedSecret(db.SecretScopeApp, "other-app", "OTHER_TOKEN", "not-for-you")
+
+	spec := deploy.Spec{AppName: "secret-app", ImageName: "nginx:alpine", Port: freeTestPort(t),
+		Env:          map[string]string{"DB_URL": "${secret:prod_db_url}?sslmode=require", "MODE": "prod", "SHARED_URL": "${secret:SHARED}"},
+		SecretGroups: []string{"payments"},
+	}
+	if err := deploy.DeployImage(spec, &testReporter{}); err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	defer deploy.DeleteApp("secret-app")
+
+	// The container gets its resolved references, not every secret it could reference
+	run := fake.Runs[len(fake.Runs)-1]
+	if run.Env["DB_URL"] != "postgres://v1?sslmode=require" || run.Env["SHARED_URL"] != "global-value" || run.Env["MODE"] != "prod" {
+		t.Errorf("unexpected container env %v", run.Env)
+	}
+	for _, name := range []string{"SHARED", "prod_db_url", "OTHER_TOKEN"} {
+		if _, ok := run.Env[name]; ok {
+			t.Errorf("expected the unreferenced secret %s to stay out of the container", name)
+		}
+	}
+
+	// The app and its releases keep the reference, not the value
+	app, _ := deploy.GetApp("secret-app")
+	if app.Env["DB_URL"] != "${secret:prod_db_url}?sslmode=require" || len(app.SecretGroups) != 1 {
+		t.Errorf("unexpected stored app %+v", app)
+	}
+	if releases, _ := db.ListReleases("secret-app"); len(releases) == 0 || strings.Contains(releases[0].Env["DB_URL"], "postgres://") {
+		t.Errorf("expected the release to keep the reference, got %+v", releases)
+	}
+
+	// References to unknown secrets are refused
+	if err := deploy.ValidateSecretRefs("secret-app", nil, map[string]string{"X": "${secret:missing}"}); err == nil || !strings.Contains(err.Error(), "unknown secret missing") {
+		t.Errorf("expected an unknown reference to be refused, got %v", err)
+	}
+	if err := deploy.ValidateSecretRefs("secret-app", []string{}, spec.Env); err == nil {
+		t.Error("expected the group secret to be invisible without the group")
+	}
+
+	// Rotating the secret restarts the apps using it
+	body := `{"action":"save","scope":"group","scopeName":"payments","key":"prod_db_url","value":"postgres://v2","restart":true}`
+	rec := httptest.NewRecorder()
+	api.HandleSecretsSettings(rec, httptest.NewRequest(http.MethodPost, "/api/system/settings/secrets", strings.NewReader(body)))
+	var resp struct {
+		Apps      []string `json:"apps"`
+		Restarted bool     `json:"restarted"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || len(resp.Apps) != 1 || resp.Apps[0] != "secret-app" || !resp.Restarted {
+		t.Fatalf("unexpected rotation response %d: %s", rec.Code, rec.Body.String())
+	}
+	if run := fake.Runs[len(fake.Runs)-1]; run.Env["DB_URL"] != "postgres://v2?sslmode=require" {
+		t.Errorf("expected the app to be restarted with the new value, got %v", run.Env)
+	}
+
+	// Only the apps referencing a secret use it
+	if users, _ := deploy.SecretUsers(db.SecretScopeGlobal, "", "SHARED"); len(users) != 1 || users[0] != "secret-app" {
+		t.Errorf("expected the referencing app to use SHARED, got %v", users)
+	}
+	db.SaveSecret("UNUSED", "x")
+	if users, _ := deploy.SecretUsers(db.SecretScopeGlobal, "", "UNUSED"); len(users) != 0 {
+		t.Errorf("expected an unreferenced secret to be unused, got %v", users)
+	}
+
+	// A secret of the app overrides the group one
+	db.SaveScopedSecret(db.SecretScopeApp, "secret-app", "prod_db_url", "postgres://own")
+	if users, _ := deploy.SecretUsers(db.SecretScopeGroup, "payments", "prod_db_url"); len(users) != 0 {
+		t.Errorf("expected the overridden group secret to be unused, got %v", users)
+	}
+	if users, _ := deploy.SecretUsers(db.SecretScopeApp, "secret-app", "prod_db_url"); len(users) != 1 {
+		t.Errorf("expected the app secret to be used, got %v", users)
+	}
+
+	rec = httptest.NewRecorder()
+	api.HandleSecretsSettings(rec, httptest.NewRequest(http.MethodGet, "/api/system/settings/secrets?scope=app&name=secret-app", nil))
+	if !strings.Contains(rec.Body.String(), "prod_db_url") || strings.Contains(rec.Body.String(), "SHARED") {
+		t.Errorf("unexpected app secrets %s", rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	api.HandleSecretsSettings(rec, httptest.NewRequest(http.MethodGet, "/api/system/settings/secrets?scope=group", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a group without name to be refused, got %d", rec.Code)
+	}
+
+	// Deleting the app deletes its secrets
+	deploy.DeleteApp("secret-app")
+	if secrets, _ := db.GetSecrets(db.SecretScopeApp, "secret-app"); len(secrets) != 0 {
+		t.Errorf("expected the app secrets to be deleted, got %v", secrets)
+	}
+}
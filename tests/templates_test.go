@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/api"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/jobs"
+)
+
+func TestDetectLanguageTemplates(t *testing.T) {
+	initTestDB(t, "test_templates.db")
+	useFakeRuntime(t)
+
+	cases := []struct {
+		name      string
+		files     map[string]string
+		framework string
+		by        string
+		want      []string
+	}{
+		{"fastapi-app", map[string]string{
+			"requirements.txt": "fastapi==0.110\nuvicorn\n",
+			"app/main.py":      "from fastapi import FastAPI\n\napi = FastAPI()\n",
+		}, "fastapi", "requirements.txt", []string{"FROM python:3.12-slim", "pip install --no-cache-dir -r requirements.txt", "exec uvicorn 'app.main:api' --host 0.0.0.0 --port ${PORT}"}},
+		{"django-app", map[string]string{
+			"requirements.txt": "Django>=5\n",
+			"manage.py":        "",
+			"mysite/wsgi.py":   "application = get_wsgi_application()\n",
+			".python-version":  "3.11.8\n",
+		}, "django", "requirements.txt", []string{"FROM python:3.11-slim", "collectstatic", "exec gunicorn mysite.wsgi:application --bind 0.0.0.0:${PORT}"}},
+		{"flask-app", map[string]string{
+			"Pipfile":      "[packages]\nflask = \"*\"\n",
+			"package.json": `{"dependencies": {"tailwindcss": "3"}}`,
+			"app.py":       "from flask import Flask\nserver = Flask(__name__)\n",
+		}, "flask", "Pipfile", []string{"pipenv install --system\n", "exec gunicorn 'app:server' --bind 0.0.0.0:${PORT}"}},
+		{"rust-app", map[string]string{
+			"Cargo.toml":  "[package]\nname = \"svc\"\nversion = \"0.1.0\"\n\n[dependencies]\n",
+			"Cargo.lock":  "",
+			"src/main.rs": "fn main() {}\n",
+		}, "rust", "Cargo.toml", []string{"FROM rust:1-bookworm AS builder", "cargo build --release --locked", "cp target/release/svc /out/app", "ENV PORT"}},
+		{"rails-app", map[string]string{
+			"Gemfile": "source \"https://rubygems.org\"\ngem \"rails\", \"~> 7.1\"\n",
+		}, "rails", "Gemfile", []string{"FROM ruby:3.3-slim", "RAILS_ENV production", "exec bundle exec rails server -b 0.0.0.0 -p ${PORT}"}},
+		{"rack-app", map[string]string{
+			"Gemfile":   "gem 'sinatra'\ngem 'puma'\n",
+			"config.ru": "run Sinatra::Application\n",
+		}, "ruby", "Gemfile", []string{"exec bundle exec puma -b tcp://0.0.0.0:${PORT}"}},
+	}
+
+	q, err := jobs.NewQueue(1, func(job *jobs.Job) error {
+		var spec deploy.Spec
+		job.Decode(&spec)
+		return deploy.DeployGit(spec, job)
+	})
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+
+	for _, tc := range cases {
+		src := t.TempDir()
+		gitRepo(t, src, "init", "-q", "-b", "main")
+		for name, content := range tc.files {
+			os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0755)
+			os.WriteFile(filepath.Join(src, name), []byte(content), 0644)
+		}
+		gitRepo(t, src, "add", ".")
+		gitRepo(t, src, "commit", "-q", "-m", "init")
+
+		id, err := q.Submit(tc.name, deploy.Spec{AppName: tc.name, RepoURL: src, Port: freeTestPort(t)})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		job := waitForJob(t, id)
+		defer deploy.DeleteApp(tc.name)
+		if job.State != jobs.StateSucceeded {
+			t.Errorf("%s: deploy failed: %s", tc.name, job.Error)
+			continue
+		}
+
+		var result deploy.Result
+		if err := json.Unmarshal(job.Result, &result); err != nil || result.Detection == nil {
+			t.Errorf("%s: job has no detection result: %s", tc.name, job.Result)
+			continue
+		}
+		if result.Detection.Framework != tc.framework || result.Detection.DetectedBy != tc.by || result.Release != 1 {
+			t.Errorf("%s: unexpected result %s", tc.name, job.Result)
+		}
+
+		data, _ := os.ReadFile(filepath.Join("deployments", tc.name, "repo", "Dockerfile"))
+		for _, want := range tc.want {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%s: Dockerfile is missing %q:\n%s", tc.name, want, data)
+			}
+		}
+	}
+}
+
+func TestTemplateRegistry(t *testing.T) {
+	initTestDB(t, "test_registry.db")
+	dir := t.TempDir()
+	t.Setenv("VPSMYTH_TEMPLATE_DIR", dir)
+
+	src := t.TempDir()
+	gitRepo(t, src, "init", "-q", "-b", "main")
+	commitFile(t, src, "package.json", `{"dependencies": {"react-scripts": "5"}}`, "init")
+
+	preview := func(body string) (int, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		api.HandlePreviewTemplate(rec, httptest.NewRequest(http.MethodPost, "/api/templates/preview", strings.NewReader(body)))
+		var resp map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	// Built-in template with parameters from the request
+	code, resp := preview(`{"repoURL": "` + src + `", "port": 3000, "build": {"nodeVersion": "20", "startCommand": "node server.js"}}`)
+	if code != http.StatusOK {
+		t.Fatalf("preview failed with %d", code)
+	}
+	dockerfile, _ := resp["dockerfile"].(string)
+	for _, want := range []string{"FROM node:20-alpine", "RUN npm run build", `CMD ["node","server.js"]`} {
+		if !strings.Contains(dockerfile, want) {
+			t.Errorf("preview is missing %q:\n%s", want, dockerfile)
+		}
+	}
+	if det, _ := resp["detection"].(map[string]interface{}); det["template"] != "react" || det["detectedBy"] != "package.json" {
+		t.Errorf("unexpected detection %v", resp["detection"])
+	}
+	if code, _ := preview(`{"repoURL": "` + src + `", "port": 3000, "build": {"buildCommand": "npm ci\nRUN curl evil"}}`); code != http.StatusBadRequest {
+		t.Errorf("expected multi-line command to be rejected, got %d", code)
+	}
+
+	// Overrides in the template directory replace built-ins and add frameworks
+	os.WriteFile(filepath.Join(dir, "react.Dockerfile.tmpl"), []byte("FROM custom:{{.NodeVersion}}\nCMD {{cmd .StartCommand}}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "elixir.Dockerfile.tmpl"), []byte("FROM elixir\nEXPOSE {{.Port}}\n"), 0644)
+	if _, resp := preview(`{"repoURL": "` + src + `", "port": 3000}`); resp["dockerfile"] != "FROM custom:18\nCMD [\"serve\",\"-s\",\"build\",\"-p\",\"3000\"]\n" {
+		t.Errorf("override not used: %q", resp["dockerfile"])
+	}
+	if _, resp := preview(`{"repoURL": "` + src + `", "port": 4000, "framework": "elixir"}`); resp["dockerfile"] != "FROM elixir\nEXPOSE 4000\n" {
+		t.Errorf("custom template not used: %q", resp["dockerfile"])
+	}
+
+	rec := httptest.NewRecorder()
+	api.HandleListTemplates(rec, httptest.NewRequest(http.MethodGet, "/api/templates", nil))
+	var list struct {
+		Templates []deploy.Template `json:"templates"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	sources := map[string]string{}
+	for _, tmpl := range list.Templates {
+		sources[tmpl.Name] = tmpl.Source
+	}
+	if sources["react"] != "custom" || sources["elixir"] != "custom" || sources["go"] != "builtin" || sources["python"] != "builtin" {
+		t.Errorf("unexpected template sources %v", sources)
+	}
+}
+
+func TestNodePackageManagers(t *testing.T) {
+	initTestDB(t, "test_node_pm.db")
+
+	cases := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{"npm lockfile", map[string]string{
+			"package.json":      `{"scripts": {"start": "node index.js"}}`,
+			"package-lock.json": "{}",
+		}, []string{"FROM node:18-alpine", "COPY package.json package-lock.json ./", "RUN npm ci", `CMD ["npm","start"]`}},
+		{"no lockfile", map[string]string{
+			"package.json": `{"engines": {"node": ">=20.5.0"}}`,
+		}, []string{"FROM node:20-alpine", "COPY package.json ./", "RUN npm install\n"}},
+		{"pnpm", map[string]string{
+			"package.json":   `{"dependencies": {"next": "14"}, "engines": {"node": "^18 || ^22.1"}}`,
+			"pnpm-lock.yaml": "",
+		}, []string{"FROM node:22-alpine", "RUN npm install -g pnpm@latest", "COPY package.json pnpm-lock.yaml ./", "RUN pnpm install --frozen-lockfile", "RUN pnpm run build", `CMD ["pnpm","run","start"]`}},
+		{"yarn classic", map[string]string{
+			"package.json": `{"dependencies": {"@nestjs/core": "10"}, "engines": {"node": "~20.11.1"}}`,
+			"yarn.lock":    "",
+		}, []string{"FROM node:20.11-alpine", "COPY package.json yarn.lock ./", "RUN yarn install --frozen-lockfile", `CMD ["yarn","run","start:prod"]`}},
+		{"yarn berry", map[string]string{
+			"package.json":     `{"packageManager": "yarn@4.1.0"}`,
+			"yarn.lock":        "",
+			".yarnrc.yml":      "nodeLinker: node-modules\n",
+			".yarn/releases/x": "",
+		}, []string{"corepack enable", "COPY package.json yarn.lock .yarnrc.yml ./", "COPY .yarn ./.yarn", "RUN yarn install --immutable"}},
+		{"bun", map[string]string{
+			"package.json": `{"packageManager": "bun@1.1.8", "dependencies": {"vite": "5"}}`,
+			"bun.lockb":    "",
+		}, []string{"RUN npm install -g bun@1.1.8", "COPY package.json bun.lockb ./", "RUN bun install --frozen-lockfile", "RUN bun run build"}},
+		{"packageManager without its lockfile", map[string]string{
+			"package.json":      `{"packageManager": "pnpm@9.0.0+sha256.abc"}`,
+			"package-lock.json": "{}",
+		}, []string{"RUN npm install -g pnpm@9.0.0\n", "COPY package.json ./", "RUN pnpm install\n"}},
+	}
+
+	for _, tc := range cases {
+		src := t.TempDir()
+		gitRepo(t, src, "init", "-q", "-b", "main")
+		for name, content := range tc.files {
+			os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0755)
+			os.WriteFile(filepath.Join(src, name), []byte(content), 0644)
+		}
+		gitRepo(t, src, "add", ".")
+		gitRepo(t, src, "commit", "-q", "-m", "init")
+
+		plan, err := deploy.PreviewDockerfile(deploy.Spec{AppName: "node-app", RepoURL: src, Port: 3000})
+		if err != nil {
+			t.Fatalf("%s: preview failed: %v", tc.name, err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(plan.Dockerfile, want) {
+				t.Errorf("%s: Dockerfile is missing %q:\n%s", tc.name, want, plan.Dockerfile)
+			}
+		}
+	}
+}
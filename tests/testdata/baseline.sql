@@ -0,0 +1,46 @@
+-- A database created before schema migrations were tracked: the tables
+-- created at startup by those releases, without deploy_jobs.result.
+CREATE TABLE credentials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    service TEXT UNIQUE,
+    username TEXT,
+    password TEXT,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE secrets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    key TEXT UNIQUE,
+    value TEXT,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT UNIQUE,
+    password_hash TEXT,
+    failed_attempts INTEGER DEFAULT 0,
+    locked_until DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE deploy_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    app_name TEXT,
+    state TEXT,
+    payload TEXT,
+    error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    started_at DATETIME,
+    finished_at DATETIME
+);
+CREATE TABLE deploy_logs (
+    job_id INTEGER,
+    seq INTEGER,
+    line TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (job_id, seq)
+);
+
+INSERT INTO credentials (service, username, password) VALUES ('github', 'github_token', 'ghp_fixture');
+INSERT INTO secrets (key, value) VALUES ('DATABASE_URL', 'postgres://fixture');
+INSERT INTO users (username, password_hash) VALUES ('admin', '$2a$10$fixturehash');
+INSERT INTO deploy_jobs (app_name, state, payload) VALUES ('fixture-app', 'succeeded', '{}');
+INSERT INTO deploy_logs (job_id, seq, line) VALUES (1, 1, 'Deployed fixture-app');
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/api"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/jobs"
+)
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+// tarEntry is a file, or a symlink when link is set.
+type tarEntry struct {
+	name, content, link string
+}
+
+func tarGzArchive(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if e.link != "" {
+			hdr = &tar.Header{Name: e.name, Mode: 0777, Linkname: e.link, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestUploadDeploy(t *testing.T) {
+	initTestDB(t, "test_upload.db")
+	fake := useFakeRuntime(t)
+	uploads := t.TempDir()
+	t.Setenv("VPSMYTH_UPLOAD_DIR", uploads)
+	if err := api.StartDeployWorkers(1); err != nil {
+		t.Fatalf("StartDeployWorkers failed: %v", err)
+	}
+
+	dockerfile := "FROM node:20-alpine\nCOPY . .\nCMD [\"node\", \"index.js\"]\n"
+	archive := zipArchive(t, map[string]string{
+		"app-main/package.json": `{"name":"app"}`,
+		"app-main/index.js":     "console.log('hi')\n",
+		"app-main/Dockerfile":   dockerfile,
+	})
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("appName", "upload-app")
+	mw.WriteField("port", "8097")
+	mw.WriteField("env", `{"A":"1"}`)
+	part, _ := mw.CreateFormFile("archive", "app.zip")
+	part.Write(archive)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/apps/deploy/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	api.HandleDeployUpload(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	t.Cleanup(func() { deploy.DeleteApp("upload-app") })
+
+	var resp struct {
+		JobID int64 `json:"jobId"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if job := waitForJob(t, resp.JobID); job.State != jobs.StateSucceeded {
+		t.Fatalf("expected upload deploy to succeed, got %s (%s)", job.State, job.Error)
+	}
+
+	// The wrapping folder is stripped and the project's Dockerfile is kept
+	got, err := os.ReadFile("deployments/upload-app/repo/Dockerfile")
+	if err != nil || string(got) != dockerfile {
+		t.Errorf("expected the uploaded Dockerfile to be used, got %q, %v", got, err)
+	}
+	if !fake.HasImage("vpsmyth/upload-app:r1") {
+		t.Error("expected the uploaded sources to be built")
+	}
+	if app, _ := deploy.GetApp("upload-app"); app.RepoURL != "Upload: app.zip" || app.Env["A"] != "1" {
+		t.Errorf("unexpected metadata: %+v", app)
+	}
+	if leftovers, _ := os.ReadDir(uploads); len(leftovers) != 0 {
+		t.Errorf("expected the archive to be removed, found %d files", len(leftovers))
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/api/apps/deploy", strings.NewReader(`{"appName":"x","deployType":"upload","repoURL":"x","port":1,"archivePath":"/etc/passwd"}`))
+	api.HandleDeploy(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected archive paths to be refused on the JSON endpoint, got %d", rec.Code)
+	}
+}
+
+func TestUploadRejectsUnsafeArchives(t *testing.T) {
+	initTestDB(t, "test_upload_unsafe.db")
+	useFakeRuntime(t)
+	t.Setenv("VPSMYTH_MAX_EXTRACT_MB", "1")
+	t.Cleanup(func() { os.RemoveAll("deployments/unsafe-app") })
+
+	cases := []struct {
+		name    string
+		archive []byte
+		want    string
+	}{
+		{"zip slip", zipArchive(t, map[string]string{"../../escaped.txt": "x"}), "illegal path"},
+		{"absolute symlink", tarGzArchive(t, []tarEntry{{name: "etc", link: "/etc"}}), "points outside"},
+		{"relative symlink", tarGzArchive(t, []tarEntry{{name: "a/up", link: "../../.."}}), "points outside"},
+		{"symlink chain", tarGzArchive(t, []tarEntry{{name: "here", link: "."}, {name: "out", link: "here/.."}}), "passes through another link"},
+		// Looks local as text, but s is dest itself, so x is next to the app directory
+		{"symlink through symlink", tarGzArchive(t, []tarEntry{{name: "a/b/s", link: "../.."}, {name: "Dockerfile", link: "a/b/s/../../../x"}}), "passes through another link"},
+		{"dangling symlink", tarGzArchive(t, []tarEntry{{name: "Dockerfile", link: "missing"}}), "does not exist"},
+		{"oversized", tarGzArchive(t, []tarEntry{{name: "big.bin", content: strings.Repeat("0", 2<<20)}}), "expands to more than"},
+		{"not an archive", []byte("just some text"), "unsupported archive format"},
+	}
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), "upload.tar.gz")
+		os.WriteFile(path, c.archive, 0644)
+
+		err := deploy.DeployUpload(deploy.Spec{AppName: "unsafe-app", Port: 8098, ArchivePath: path, RepoURL: "Upload: x"}, &testReporter{})
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected error containing %q, got %v", c.name, c.want, err)
+		}
+	}
+	if _, err := os.Stat("escaped.txt"); err == nil {
+		os.Remove("escaped.txt")
+		t.Error("zip slip wrote outside the app directory")
+	}
+	if _, err := os.Stat("deployments/unsafe-app/repo"); err == nil {
+		t.Error("rejected archives must not replace the app sources")
+	}
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prashanta0234/vpsmyth/internal/api"
+	"github.com/prashanta0234/vpsmyth/internal/db"
+	"github.com/prashanta0234/vpsmyth/internal/deploy"
+	"github.com/prashanta0234/vpsmyth/internal/jobs"
+)
+
+func signBody(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhook posts a push payload to the app's webhook and returns the response.
+func sendWebhook(headers map[string]string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, api.WebhookPathPrefix+"hook-app", strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	api.AuthMiddleware(http.HandlerFunc(api.HandleWebhook)).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPushWebhooks(t *testing.T) {
+	initTestDB(t, "test_webhooks.db")
+	useFakeRuntime(t)
+	if err := api.StartDeployWorkers(1); err != nil {
+		t.Fatalf("StartDeployWorkers failed: %v", err)
+	}
+
+	src := t.TempDir()
+	gitRepo(t, src, "init", "-q", "-b", "main")
+	commitFile(t, src, "index.js", "console.log(1)\n", "first")
+	if err := deploy.DeployGit(deploy.Spec{AppName: "hook-app", RepoURL: src, Port: freeTestPort(t)}, &testReporter{}); err != nil {
+		t.Fatalf("initial deploy failed: %v", err)
+	}
+	defer deploy.DeleteApp("hook-app")
+
+	rec := httptest.NewRecorder()
+	api.HandleAppWebhook(rec, httptest.NewRequest(http.MethodPost, "/api/apps/webhook", strings.NewReader(`{"appName":"hook-app","branch":"main"}`)))
+	var hook struct {
+		URL    string `json:"url"`
+		Secret string `json:"secret"`
+	}
+	json.NewDecoder(rec.Body).Decode(&hook)
+	if hook.Secret == "" || hook.URL != "/api/webhooks/hook-app" {
+		t.Fatalf("unexpected webhook config: %d %+v", rec.Code, hook)
+	}
+
+	second := commitFile(t, src, "index.js", "console.log(2)\n", "second")
+	push := fmt.Sprintf(`{"ref":"refs/heads/main","after":"%s","repository":{"default_branch":"main"}}`, second)
+
+	// GitHub: HMAC of the body, unauthenticated by session cookie
+	rec = sendWebhook(map[string]string{
+		"X-GitHub-Event":      "push",
+		"X-GitHub-Delivery":   "d1",
+		"X-Hub-Signature-256": "sha256=" + signBody(hook.Secret, push),
+	}, push)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var queued struct {
+		JobID int64 `json:"jobId"`
+	}
+	json.NewDecoder(rec.Body).Decode(&queued)
+	if job := waitForJob(t, queued.JobID); job.State != jobs.StateSucceeded {
+		t.Fatalf("expected redeploy to succeed, got %s (%s)", job.State, job.Error)
+	}
+	if app, _ := deploy.GetApp("hook-app"); app.CommitSHA != second {
+		t.Errorf("expected %s to be deployed, got %s", second, app.CommitSHA)
+	}
+
+	rec = sendWebhook(map[string]string{
+		"X-GitHub-Event":      "push",
+		"X-Hub-Signature-256": "sha256=" + signBody("wrong", push),
+	}, push)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a bad signature, got %d", rec.Code)
+	}
+
+	other := `{"ref":"refs/heads/feature","after":"abc"}`
+	rec = sendWebhook(map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": hook.Secret}, other)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"ignored"`) {
+		t.Errorf("expected other branch to be ignored, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = sendWebhook(map[string]string{"X-Gitea-Event": "push", "X-Gitea-Signature": signBody(hook.Secret, push)}, push)
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("expected Gitea push to be queued, got %d: %s", rec.Code, rec.Body.String())
+	}
+	json.NewDecoder(rec.Body).Decode(&queued)
+	waitForJob(t, queued.JobID)
+
+	deliveries, err := db.ListWebhookDeliveries("hook-app", 10)
+	if err != nil || len(deliveries) != 4 {
+		t.Fatalf("expected 4 deliveries, got %+v, %v", deliveries, err)
+	}
+	if deliveries[0].Provider != "gitea" || deliveries[1].Status != "ignored" || deliveries[2].Status != "rejected" || deliveries[3].DeliveryID != "d1" {
+		t.Errorf("unexpected delivery log: %+v", deliveries)
+	}
+
+	// Deliveries to apps without a webhook are refused without being logged
+	req := httptest.NewRequest(http.MethodPost, api.WebhookPathPrefix+"no-such-app", strings.NewReader(push))
+	req.Header.Set("X-GitHub-Event", "push")
+	rec = httptest.NewRecorder()
+	api.HandleWebhook(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an app without a webhook, got %d", rec.Code)
+	}
+	if deliveries, _ := db.ListWebhookDeliveries("no-such-app", 10); len(deliveries) != 0 {
+		t.Errorf("expected no delivery to be logged, got %+v", deliveries)
+	}
+}
@@ -24,6 +24,7 @@ function renderApps(config) {
             <div class="app-details">
                 <p><strong>Port:</strong> ${app.port}</p>
                 <p><strong>Container ID:</strong> ${app.container_id}</p>
+                ${app.health ? `<p><strong>Health:</strong> ${app.health.status}${app.health.message ? ` (${app.health.message})` : ''}</p>` : ''}
             </div>
             <div class="app-actions" style="display: grid; grid-template-columns: 1fr 1fr; gap: 0.5rem;">
                 <button class="btn-outline" onclick="handleAction('${app.app_name}', 'restart')">Restart</button>
@@ -92,6 +93,37 @@ async function showLogs(appName) {
     }
 }
 
+function streamDeployLogs(jobId) {
+    const modal = document.getElementById('logs-modal');
+    const content = document.getElementById('logs-content');
+    modal.style.display = 'flex';
+    content.textContent = '';
+
+    const footer = document.getElementById('cancel-job-footer');
+    const cancelJob = document.getElementById('cancel-job');
+    footer.style.display = 'flex';
+    cancelJob.onclick = async () => {
+        const response = await fetch(`/api/apps/deploy/cancel?id=${jobId}`, { method: 'POST' });
+        if (response.status === 401) return handleAuthError();
+        if (!response.ok) alert(`Failed to cancel deployment: ${await response.text()}`);
+    };
+
+    const source = new EventSource(`/api/apps/deploy/logs?id=${jobId}`);
+    source.onmessage = (event) => {
+        content.textContent += event.data + '\n';
+        content.scrollTop = content.scrollHeight;
+    };
+    source.addEventListener('done', (event) => {
+        const result = JSON.parse(event.data);
+        content.textContent += `\nDeployment ${result.state}${result.error ? ': ' + result.error : ''}\n`;
+        content.scrollTop = content.scrollHeight;
+        footer.style.display = 'none';
+        source.close();
+        fetchApps();
+    });
+    source.onerror = () => source.close();
+}
+
 function showEditEnv(appName, env) {
     const modal = document.getElementById('edit-env-modal');
     const appNameInput = document.getElementById('edit-env-app-name');
@@ -137,16 +169,16 @@ document.addEventListener('DOMContentLoaded', () => {
     const deployTypeRadios = document.getElementsByName('deployType');
     const gitFields = document.getElementById('git-fields');
     const imageFields = document.getElementById('image-fields');
+    const repoFields = document.getElementById('repo-fields');
+    const uploadFields = document.getElementById('upload-fields');
 
     deployTypeRadios.forEach(radio => {
         radio.addEventListener('change', (e) => {
-            if (e.target.value === 'git') {
-                gitFields.style.display = 'block';
-                imageFields.style.display = 'none';
-            } else {
-                gitFields.style.display = 'none';
-                imageFields.style.display = 'block';
-            }
+            const type = e.target.value;
+            gitFields.style.display = type === 'image' ? 'none' : 'block';
+            imageFields.style.display = type === 'image' ? 'block' : 'none';
+            repoFields.style.display = type === 'git' ? 'block' : 'none';
+            uploadFields.style.display = type === 'upload' ? 'block' : 'none';
         });
     });
 
@@ -224,7 +256,15 @@ document.addEventListener('DOMContentLoaded', () => {
         backend: [
             { value: 'nestjs', label: 'NestJS' },
             { value: 'express', label: 'Express' },
-            { value: 'nodejs', label: 'Generic Node.js' }
+            { value: 'nodejs', label: 'Generic Node.js' },
+            { value: 'go', label: 'Go' },
+            { value: 'django', label: 'Django' },
+            { value: 'flask', label: 'Flask' },
+            { value: 'fastapi', label: 'FastAPI' },
+            { value: 'python', label: 'Generic Python' },
+            { value: 'rust', label: 'Rust' },
+            { value: 'rails', label: 'Ruby on Rails' },
+            { value: 'ruby', label: 'Ruby (Rack)' }
         ]
     };
 
@@ -239,6 +279,11 @@ document.addEventListener('DOMContentLoaded', () => {
                 frameworkSelect.appendChild(option);
             });
         }
+        document.getElementById('go-fields').style.display = 'none';
+    });
+
+    frameworkSelect.addEventListener('change', () => {
+        document.getElementById('go-fields').style.display = frameworkSelect.value === 'go' ? 'block' : 'none';
     });
 
     deployForm.addEventListener('submit', async (e) => {
@@ -249,11 +294,17 @@ document.addEventListener('DOMContentLoaded', () => {
         const submitBtn = document.getElementById('submit-deploy');
 
         let env = {};
+        let envOptions = {};
+        let buildArgs = {};
         try {
             const envText = formData.get('env').trim();
             if (envText) env = JSON.parse(envText);
+            const optionsText = formData.get('envOptions').trim();
+            if (optionsText) envOptions = JSON.parse(optionsText);
+            const argsText = formData.get('buildArgs').trim();
+            if (argsText) buildArgs = JSON.parse(argsText);
         } catch (err) {
-            alert('Invalid JSON in environment variables');
+            alert('Invalid JSON in environment variables or build args');
             return;
         }
 
@@ -263,31 +314,66 @@ document.addEventListener('DOMContentLoaded', () => {
             category: formData.get('category'),
             framework: formData.get('framework'),
             repoURL: formData.get('repoURL'),
+            ref: formData.get('ref'),
             imageName: formData.get('imageName'),
-            port: parseInt(formData.get('port')),
-            env: env
+            port: parseInt(formData.get('port')) || 0,
+            strategy: formData.get('strategy'),
+            env: env,
+            envOptions: envOptions,
+            secretGroups: (formData.get('secretGroups') || '').split(',').map(g => g.trim()).filter(g => g),
+            build: {
+                buildArgs: buildArgs,
+                goMain: formData.get('goMain') || '',
+                cgo: formData.get('cgo') === 'on',
+                rootDir: formData.get('rootDir') || '',
+                dockerfile: formData.get('dockerfile') || '',
+                context: formData.get('buildContext') || '',
+                target: formData.get('target') || '',
+                watchPaths: (formData.get('watchPaths') || '').split(',').map(p => p.trim()).filter(p => p)
+            }
         };
+        if (!data.secretGroups.length) delete data.secretGroups;
 
         submitBtn.disabled = true;
         btnText.style.display = 'none';
         btnSpinner.style.display = 'block';
 
         try {
-            const response = await fetch('/api/apps/deploy', {
-                method: 'POST',
-                headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify(data)
-            });
+            let response;
+            if (data.deployType === 'upload') {
+                // The archive goes as multipart form data; env stays JSON
+                const upload = new FormData();
+                ['appName', 'category', 'framework', 'port', 'strategy'].forEach(key => upload.append(key, data[key] || ''));
+                upload.append('env', JSON.stringify(env));
+                upload.append('envOptions', JSON.stringify(envOptions));
+                if (data.secretGroups) upload.append('secretGroups', JSON.stringify(data.secretGroups));
+                upload.append('build', JSON.stringify(data.build));
+                upload.append('archive', formData.get('archive'));
+                response = await fetch('/api/apps/deploy/upload', { method: 'POST', body: upload });
+            } else {
+                response = await fetch('/api/apps/deploy', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify(data)
+                });
+            }
 
             if (response.status === 401) return handleAuthError();
             if (response.ok) {
-                alert('Deployment started successfully!');
+                const result = await response.json();
                 toggleModal(false);
                 deployForm.reset();
+                if (result.jobId) {
+                    streamDeployLogs(result.jobId);
+                } else {
+                    alert('Deployment started successfully!');
+                }
                 fetchApps();
             } else {
-                const result = await response.json();
-                alert('Deployment failed: ' + (result.error || 'Unknown error'));
+                const text = await response.text();
+                let message = text;
+                try { message = JSON.parse(text).error || text; } catch (err) { /* plain-text error */ }
+                alert('Deployment failed: ' + (message || 'Unknown error'));
             }
         } catch (err) {
             alert('Error connecting to server: ' + err.message);
@@ -66,7 +66,15 @@ document.addEventListener('DOMContentLoaded', () => {
         backend: [
             { value: 'nestjs', label: 'NestJS' },
             { value: 'express', label: 'Express' },
-            { value: 'nodejs', label: 'Generic Node.js' }
+            { value: 'nodejs', label: 'Generic Node.js' },
+            { value: 'go', label: 'Go' },
+            { value: 'django', label: 'Django' },
+            { value: 'flask', label: 'Flask' },
+            { value: 'fastapi', label: 'FastAPI' },
+            { value: 'python', label: 'Generic Python' },
+            { value: 'rust', label: 'Rust' },
+            { value: 'rails', label: 'Ruby on Rails' },
+            { value: 'ruby', label: 'Ruby (Rack)' }
         ]
     };
 
@@ -9,6 +9,11 @@ document.addEventListener('DOMContentLoaded', () => {
     const secretKey = document.getElementById('secret-key');
     const secretValue = document.getElementById('secret-value');
     const addSecretBtn = document.getElementById('add-secret');
+    const secretScope = document.getElementById('secret-scope');
+    const secretScopeName = document.getElementById('secret-scope-name');
+    const secretRestart = document.getElementById('secret-restart');
+
+    const scopeParams = () => ({ scope: secretScope.value, scopeName: secretScope.value === 'global' ? '' : secretScopeName.value.trim() });
 
     const fetchSettings = async () => {
         // Fetch DockerHub username
@@ -35,9 +40,17 @@ document.addEventListener('DOMContentLoaded', () => {
             }
         } catch (err) { console.error(err); }
 
-        // Fetch Secrets
+        fetchSecrets();
+    };
+
+    const fetchSecrets = async () => {
+        const { scope, scopeName } = scopeParams();
+        if (scope !== 'global' && !scopeName) {
+            secretsList.innerHTML = '';
+            return;
+        }
         try {
-            const res = await fetch('/api/system/settings/secrets');
+            const res = await fetch(`/api/system/settings/secrets?scope=${scope}&name=${encodeURIComponent(scopeName)}`);
             if (res.status === 401) return handleAuthError();
             if (res.ok) {
                 const secrets = await res.json();
@@ -46,20 +59,29 @@ document.addEventListener('DOMContentLoaded', () => {
         } catch (err) { console.error(err); }
     };
 
+    secretScope.addEventListener('change', () => {
+        secretScopeName.disabled = secretScope.value === 'global';
+        fetchSecrets();
+    });
+    secretScopeName.addEventListener('change', fetchSecrets);
+
     const renderSecrets = (secrets) => {
         secretsList.innerHTML = '';
-        Object.entries(secrets).forEach(([key, value]) => {
+        Object.keys(secrets).forEach((key) => {
             const item = document.createElement('div');
             item.className = 'secret-item';
             item.style = 'display: flex; justify-content: space-between; align-items: center; background: var(--bg-secondary); padding: 0.5rem 1rem; border-radius: 8px; margin-bottom: 0.5rem; font-size: 0.875rem;';
             item.innerHTML = `
                 <div>
                     <span style="font-weight: 600; color: var(--text-primary);">${key}</span>
-                    <span style="color: var(--text-secondary); margin-left: 0.5rem;">••••••••</span>
+                    <span id="secret-value-${key}" style="color: var(--text-secondary); margin-left: 0.5rem;">••••••••</span>
                 </div>
+                <div>
+                <button onclick="revealSecret('${key}')" style="color: var(--text-secondary); background: none; border: none; cursor: pointer; font-size: 0.75rem;">Reveal</button>
                 <button onclick="deleteSecret('${key}')" style="color: #ef4444; background: none; border: none; cursor: pointer;">
                     <svg width="18" height="18" fill="none" stroke="currentColor" viewBox="0 0 24 24"><path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M19 7l-.867 12.142A2 2 0 0116.138 21H7.862a2 2 0 01-1.995-1.858L5 7m5 4v6m4-6v6m1-10V4a1 1 0 00-1-1h-4a1 1 0 00-1 1v3M4 7h16"></path></svg>
                 </button>
+                </div>
             `;
             secretsList.appendChild(item);
         });
@@ -115,27 +137,51 @@ document.addEventListener('DOMContentLoaded', () => {
             const res = await fetch('/api/system/settings/secrets', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ action: 'save', key: secretKey.value, value: secretValue.value })
+                body: JSON.stringify({ action: 'save', key: secretKey.value, value: secretValue.value, restart: secretRestart.checked, ...scopeParams() })
             });
             if (res.status === 401) return handleAuthError();
             if (res.ok) {
+                const data = await res.json();
                 secretKey.value = '';
                 secretValue.value = '';
-                fetchSettings();
+                if (data.apps && data.apps.length) {
+                    alert(`Used by: ${data.apps.join(', ')}` + (data.restarted ? ' (restarted)' : ' (applied when they are next deployed or their env is updated)'));
+                }
+                fetchSecrets();
+            } else {
+                alert(await res.text());
             }
         } catch (err) { alert(err.message); }
     });
 
+    // Revealing a value is recorded in the audit log
+    window.revealSecret = async (key) => {
+        try {
+            const res = await fetch('/api/system/settings/secrets/reveal', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ key, ...scopeParams() })
+            });
+            if (res.status === 401) return handleAuthError();
+            if (res.ok) {
+                const data = await res.json();
+                document.getElementById(`secret-value-${key}`).textContent = data.value;
+            } else {
+                alert(await res.text());
+            }
+        } catch (err) { alert(err.message); }
+    };
+
     window.deleteSecret = async (key) => {
         if (!confirm(`Delete secret ${key}?`)) return;
         try {
             const res = await fetch('/api/system/settings/secrets', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ action: 'delete', key })
+                body: JSON.stringify({ action: 'delete', key, ...scopeParams() })
             });
             if (res.status === 401) return handleAuthError();
-            if (res.ok) fetchSettings();
+            if (res.ok) fetchSecrets();
         } catch (err) { alert(err.message); }
     };
 